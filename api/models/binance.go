@@ -0,0 +1,49 @@
+package models
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// BinanceStream is the envelope of the messages of a Binance combined stream.
+/**
+Sample:
+{
+    "stream": "btcusdt@trade",
+    "data": {
+        "e": "trade",
+        "E": 1653124324863,
+        "s": "BTCUSDT",
+        "t": 1380339443,
+        "p": "29303.35000000",
+        "q": "0.00029900",
+        "b": 10602839853,
+        "a": 10602839885,
+        "T": 1653124324862,
+        "m": true,
+        "M": true
+    }
+}
+*/
+type BinanceStream struct {
+	Stream string       `json:"stream"`
+	Data   BinanceTrade `json:"data"`
+}
+
+// BinanceTrade is the payload of the Binance <symbol>@trade stream.
+// Every single-letter field is declared: encoding/json would otherwise match "M" to "m" and "E" to "e".
+type BinanceTrade struct {
+	EventType     string `json:"e"`
+	EventTime     int64  `json:"E"`
+	Symbol        string `json:"s"`
+	TradeID       int    `json:"t"`
+	Price         string `json:"p"`
+	Quantity      string `json:"q"`
+	BuyerOrderID  int64  `json:"b"`
+	SellerOrderID int64  `json:"a"`
+	// TradeTime is the exchange time of the trade, in milliseconds since the epoch.
+	TradeTime int64 `json:"T"`
+	// BuyerIsMaker tells whether the buyer order was resting on the book, i.e. the taker sold.
+	BuyerIsMaker bool `json:"m"`
+	Ignore       bool `json:"M"`
+}
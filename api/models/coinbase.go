@@ -41,4 +41,8 @@ type CoinbaseResponse struct {
 	Time      string `json:"time"`
 	TradeID   int    `json:"trade_id"`
 	Side      string `json:"side"`
+	// Reason details the Message of an error.
+	Reason string `json:"reason,omitempty"`
+	// LastTradeID is the latest trade ID of the product of a heartbeat.
+	LastTradeID int `json:"last_trade_id,omitempty"`
 }
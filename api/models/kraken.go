@@ -0,0 +1,70 @@
+package models
+
+import "encoding/json"
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// KrakenRequest is the payload of the Kraken v2 subscribe and unsubscribe requests.
+/**
+Sample:
+{
+    "method": "subscribe",
+    "params": {
+        "channel": "trade",
+        "symbol": ["BTC/USD", "ETH/USD"],
+        "snapshot": false
+    }
+}
+*/
+type KrakenRequest struct {
+	Method string       `json:"method"`
+	Params KrakenParams `json:"params"`
+}
+
+// KrakenParams are the parameters of a Kraken v2 subscription.
+type KrakenParams struct {
+	Channel  string   `json:"channel"`
+	Symbol   []string `json:"symbol"`
+	Snapshot bool     `json:"snapshot"`
+}
+
+// KrakenMessage is a message of the Kraken v2 websocket: a channel message (trade, heartbeat, status)
+// or the response of a request.
+/**
+Sample:
+{
+    "channel": "trade",
+    "type": "update",
+    "data": [
+        {"symbol": "BTC/USD", "side": "sell", "price": 29303.3, "qty": 0.000299, "ord_type": "market",
+         "trade_id": 52463742, "timestamp": "2022-05-21T09:12:04.862866Z"},
+        {"symbol": "BTC/USD", "side": "sell", "price": 29303.2, "qty": 0.01, "ord_type": "market",
+         "trade_id": 52463743, "timestamp": "2022-05-21T09:12:04.862866Z"}
+    ]
+}
+*/
+type KrakenMessage struct {
+	Channel string        `json:"channel"`
+	Type    string        `json:"type"`
+	Data    []KrakenTrade `json:"data"`
+	// Method, Success and Error are set on the responses of requests, Symbol on those of a single symbol.
+	Method  string `json:"method"`
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+	Symbol  string `json:"symbol"`
+}
+
+// KrakenTrade is a trade of the Kraken v2 trade channel. Prices and quantities are JSON numbers,
+// kept as written to parse them exactly.
+type KrakenTrade struct {
+	Symbol    string      `json:"symbol"`
+	Side      string      `json:"side"`
+	Price     json.Number `json:"price"`
+	Qty       json.Number `json:"qty"`
+	OrdType   string      `json:"ord_type"`
+	TradeID   int         `json:"trade_id"`
+	Timestamp string      `json:"timestamp"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Side is the side of the maker order of a trade, as in the Coinbase matches channel:
+// a buy maker means the taker sold.
+type Side string
+
+const (
+	SideBuy  Side = "buy"
+	SideSell Side = "sell"
+)
+
+// Trade is a trade normalized by the exchange adapters, whatever the venue it was received from.
+/**
+Sample:
+{
+    "venue": "coinbase",
+    "product_id": "BTC-USD",
+    "price": "29303.35",
+    "size": "0.0000299",
+    "side": "sell",
+    "trade_id": 341498074,
+    "time": "2022-05-21T09:12:04.862866Z",
+    "received_at": "2022-05-21T09:12:04.86345Z"
+}
+*/
+type Trade struct {
+	// Venue is the exchange the trade was received from, e.g. coinbase.
+	Venue string `json:"venue"`
+	// ProductID is the canonical trading pair of the trade, e.g. BTC-USD, whatever the venue's symbol.
+	ProductID string `json:"product_id"`
+	// Price and Size are decimal strings as published by the venue, so they can be parsed exactly.
+	Price string `json:"price"`
+	Size  string `json:"size"`
+	Side  Side   `json:"side"`
+	// TradeID is the venue's trade ID, sequential per product.
+	TradeID int `json:"trade_id"`
+	// Time is the exchange time of the trade, zero when the venue doesn't publish it.
+	Time time.Time `json:"time"`
+	// ReceivedAt is the time the trade was received by the engine.
+	ReceivedAt time.Time `json:"received_at"`
+	// PushedAt is the time the trade was pushed onto the VWAP storage, PublishedAt the time the updated VWAPs were
+	// published. Both are zero until then.
+	PushedAt    time.Time `json:"pushed_at"`
+	PublishedAt time.Time `json:"published_at"`
+	// Snapshot marks a trade that happened before the subscription, sent with it as a starting point
+	// (e.g. the Coinbase last_match), rather than a live trade.
+	Snapshot bool `json:"snapshot,omitempty"`
+}
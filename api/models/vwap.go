@@ -0,0 +1,101 @@
+package models
+
+import "time"
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Vwap is the JSON payload returned by the HTTP query API for a trading pair.
+// With several venues, it is the VWAP consolidated across venues, next to the VWAP of each venue.
+/**
+Sample:
+{
+    "product_id": "BTC-USD",
+    "vwap": 29303.34,
+    "cumulative_quantity": 12.5,
+    "count": 200,
+    "updated_at": "2022-05-21T09:12:04.862866Z",
+    "stale": false,
+    "venues": [
+        {"venue": "binance", "vwap": 29303.1, "cumulative_quantity": 8.5, "count": 120, "updated_at": "2022-05-21T09:12:04.862Z", "stale": true},
+        {"venue": "coinbase", "vwap": 29303.85, "cumulative_quantity": 4, "count": 80, "updated_at": "2022-05-21T09:12:04.862866Z", "stale": false}
+    ]
+}
+*/
+type Vwap struct {
+	ProductID          string    `json:"product_id"`
+	Vwap               float64   `json:"vwap"`
+	CumulativeQuantity float64   `json:"cumulative_quantity"`
+	Count              uint      `json:"count"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	// Stale is set when no trade nor heartbeat of the trading pair arrived lately from any venue: the feed is frozen.
+	Stale  bool        `json:"stale"`
+	Venues []VenueVwap `json:"venues,omitempty"`
+}
+
+// VenueVwap is the VWAP of a trading pair on a single venue.
+type VenueVwap struct {
+	Venue              string    `json:"venue"`
+	Vwap               float64   `json:"vwap"`
+	CumulativeQuantity float64   `json:"cumulative_quantity"`
+	Count              uint      `json:"count"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	// Stale is set when no trade nor heartbeat of the trading pair arrived lately from the venue.
+	Stale bool `json:"stale"`
+}
+
+// TradingPairs is the JSON payload returned by the admin API with the subscribed trading pairs.
+/**
+Sample:
+{
+    "trading_pairs": ["BTC-USD", "ETH-USD"]
+}
+*/
+type TradingPairs struct {
+	TradingPairs []string `json:"trading_pairs"`
+}
+
+// Latency is the JSON payload returned by the HTTP query API with the latency histograms of a trading pair, by stage
+// of the pipeline: exchange_to_receive, receive_to_push (the VWAP updated) and receive_to_publish.
+/**
+Sample:
+{
+    "product_id": "BTC-USD",
+    "stages": {
+        "exchange_to_receive": {
+            "count": 1200, "mean_ms": 38.2, "p50_ms": 32.768, "p90_ms": 65.536, "p99_ms": 131.072, "max_ms": 140.2,
+            "buckets": [{"le_ms": 16.384, "count": 100}, {"le_ms": 32.768, "count": 700}, {"le_ms": 65.536, "count": 1150}, {"le_ms": 131.072, "count": 1190}, {"le_ms": 262.144, "count": 1200}]
+        }
+    }
+}
+*/
+type Latency struct {
+	ProductID string                      `json:"product_id"`
+	Stages    map[string]LatencyHistogram `json:"stages"`
+}
+
+// LatencyHistogram summarizes the latencies of a stage of the pipeline, in milliseconds. Quantiles are the upper
+// bound of the bucket they fall in, so they never understate the latency.
+type LatencyHistogram struct {
+	Count  uint64  `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	// Buckets are cumulative, as Prometheus histograms: Count latencies are at most LeMs. Empty buckets are left out.
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket is a bucket of a LatencyHistogram.
+type LatencyBucket struct {
+	LeMs  float64 `json:"le_ms"`
+	Count uint64  `json:"count"`
+}
+
+// ErrorResponse is the JSON payload returned by the HTTP query API on failure.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"github.com/reactivejson/vwap-engine/internal/app"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
 	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/decimal"
 	"github.com/reactivejson/vwap-engine/internal/storage/linked-list"
 	queue2 "github.com/reactivejson/vwap-engine/internal/storage/queue"
+	"github.com/reactivejson/vwap-engine/internal/storage/time-window"
 	"github.com/reactivejson/vwap-engine/internal/tunnel"
 	"log"
 	"os"
@@ -21,25 +24,41 @@ import (
 
 //The core entry point into the app. will setup the config, and run the App
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+//run sets up and runs the App until it stops. Errors are returned rather than fatal, so the deferred closes, e.g. of
+//the recorder flushing its last frames, run before exiting.
+func run() error {
 	ctx, cancelCtxFn := context.WithCancel(context.Background())
+	defer cancelCtxFn()
 
 	cfg := app.SetupEnvConfig()
 
+	fmt.Printf("Exchanges %s\n", cfg.Exchanges)
 	fmt.Printf("wsURL %s\n", cfg.WebsocketUrl)
 	fmt.Printf("Trading pairs %s\n", cfg.TradingPairs)
 
 	// Intercepting shutdown signals.
 	go waitForSignal(ctx, cancelCtxFn)
 
-	ws, err := tunnel.NewReceiver(cfg.WebsocketUrl)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	var queue storage.Vwap
+	var err error
 
 	//The arrays allocated in memory are never returned. Therefor A dynamic doubly Linked list structure, is better to be used for a long-living queue.
-	if cfg.WindowSize < 500 {
+	if cfg.Arithmetic == app.ArithmeticDecimal {
+		// exact decimal queue, bounded by time when WindowDuration is set
+		if cfg.WindowDuration > 0 {
+			queue, err = decimal.NewVwapDecimal(0, cfg.WindowDuration)
+		} else {
+			queue, err = decimal.NewVwapDecimal(cfg.WindowSize, 0)
+		}
+	} else if cfg.WindowDuration > 0 {
+		// time window, e.g. 5-minute VWAP
+		queue, err = time_window.NewVwapTimeWindow(cfg.WindowDuration)
+	} else if cfg.WindowSize < 500 {
 		// Array backed queue
 		// Manipulation with ArrayList is slow because it internally uses an array. If any element is removed from the array, all the other elements are shifted in memory.
 		queue, err = queue2.NewVwapQueue(cfg.WindowSize)
@@ -49,15 +68,142 @@ func main() {
 		queue, err = linked_list.NewVwapLinkedList(cfg.WindowSize)
 	}
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	svc := app.NewContext(ws, queue, cfg)
+	if cfg.Mode == app.ModeBacktest {
+		return app.Backtest(ctx, queue, cfg)
+	}
 
-	err = svc.Run(ctx)
-	if err != nil {
-		log.Fatal(err)
+	var ws tunnel.Tunnel
+	var ctxOpts []app.ContextOption
+	if cfg.Mode == app.ModeSynthetic {
+		// generated trades of the first venue, without network
+		ws, err = tunnel.NewGenerator(tunnel.GeneratorConfig{
+			Venue:            cfg.Exchanges[0],
+			Seed:             cfg.SyntheticSeed,
+			Rate:             cfg.SyntheticRate,
+			Speed:            cfg.SyntheticSpeed,
+			Prices:           cfg.SyntheticPrices,
+			Volatility:       cfg.SyntheticVolatility,
+			MedianSize:       cfg.SyntheticMedianSize,
+			SizeSigma:        cfg.SyntheticSizeSigma,
+			BuyRatio:         cfg.SyntheticBuyRatio,
+			BurstProbability: cfg.SyntheticBurstProbability,
+			BurstLength:      cfg.SyntheticBurstLength,
+			BurstFactor:      cfg.SyntheticBurstFactor,
+		})
+		if err != nil {
+			return err
+		}
+	} else if cfg.ReplayPath != "" {
+		// offline replay of a recorded feed, of every venue it was recorded from
+		ws, err = tunnel.NewReplayer(cfg.Exchanges[0], cfg.ReplayPath, cfg.ReplaySpeed, cfg.Symbols)
+		if err != nil {
+			return err
+		}
+	} else {
+		dialer, dialerErr := tunnel.NewDialer(tunnel.DialerConfig{
+			ProxyURL:      cfg.ProxyURL,
+			CAFile:        cfg.TLSCAFile,
+			CertFile:      cfg.TLSCertFile,
+			KeyFile:       cfg.TLSKeyFile,
+			TLSMinVersion: cfg.TLSMinVersion,
+			ServerName:    cfg.TLSServerName,
+		})
+		if dialerErr != nil {
+			return dialerErr
+		}
+
+		opts := []tunnel.ReceiverOption{
+			tunnel.WithDialer(dialer),
+			tunnel.WithSymbols(cfg.Symbols),
+			tunnel.WithKeepalive(tunnel.Keepalive{
+				PingInterval: cfg.PingInterval,
+				PongTimeout:  cfg.PongTimeout,
+				ReadTimeout:  cfg.ReadTimeout,
+			}),
+		}
+		if cfg.RecordDir != "" {
+			recorder, recErr := tunnel.NewRecorder(cfg.RecordDir, cfg.RecordMaxBytes)
+			if recErr != nil {
+				return recErr
+			}
+			defer recorder.Close()
+			opts = append(opts, tunnel.WithRecorder(recorder))
+		}
+		if cfg.StaleInterval > 0 {
+			// shared by the receivers, so that the query API sees the staleness of every venue
+			watchdog := tunnel.NewWatchdog(cfg.StaleInterval)
+			opts = append(opts, tunnel.WithWatchdog(watchdog))
+			ctxOpts = append(ctxOpts, app.WithWatchdog(watchdog))
+		}
+
+		// shared with the context, so that a trading pair rejected once added at runtime is torn down instead of
+		// stopping the feed
+		rejections := tunnel.NewRejections()
+		opts = append(opts, tunnel.WithRejections(rejections))
+		ctxOpts = append(ctxOpts, app.WithRejections(rejections))
+
+		// shared with the context, so that the metrics endpoint exposes those of the redundant legs
+		counters := metrics.NewCounters()
+		ctxOpts = append(ctxOpts, app.WithMetrics(counters))
+
+		// one receiver per venue, or a pool of them sharding its trading pairs, merged into a single feed
+		receivers := make([]tunnel.Tunnel, 0, len(cfg.Exchanges))
+		for _, exchange := range cfg.Exchanges {
+			legs := make([]tunnel.Tunnel, 0, cfg.RedundantLegs)
+			for leg := 0; leg < int(cfg.RedundantLegs); leg++ {
+				websocketUrl := map[string]string{
+					app.ExchangeCoinbase: cfg.WebsocketUrl,
+					app.ExchangeBinance:  cfg.BinanceWebsocketUrl,
+					app.ExchangeKraken:   cfg.KrakenWebsocketUrl,
+				}[exchange]
+				if leg > 0 && leg <= len(cfg.LegURLs[exchange]) {
+					websocketUrl = cfg.LegURLs[exchange][leg-1]
+				}
+
+				newReceiver := func(exchange, websocketUrl string) func() (tunnel.Tunnel, error) {
+					return func() (tunnel.Tunnel, error) {
+						switch exchange {
+						case app.ExchangeBinance:
+							return tunnel.NewBinanceReceiver(websocketUrl, opts...)
+						case app.ExchangeKraken:
+							return tunnel.NewKrakenReceiver(websocketUrl, opts...)
+						default:
+							return tunnel.NewReceiver(websocketUrl, opts...)
+						}
+					}
+				}(exchange, websocketUrl)
+
+				var receiver tunnel.Tunnel
+				if cfg.PairsPerConnection > 0 {
+					receiver, err = tunnel.NewPool(int(cfg.PairsPerConnection), newReceiver)
+				} else {
+					receiver, err = newReceiver()
+				}
+				if err != nil {
+					return err
+				}
+				legs = append(legs, receiver)
+			}
+
+			if len(legs) > 1 {
+				receivers = append(receivers, tunnel.NewRedundant(counters, int(cfg.DedupCapacity), legs...))
+			} else {
+				receivers = append(receivers, legs[0])
+			}
+		}
+
+		ws = receivers[0]
+		if len(receivers) > 1 {
+			ws = tunnel.NewMulti(receivers...)
+		}
 	}
+
+	svc := app.NewContext(ws, queue, cfg, ctxOpts...)
+
+	return svc.Run(ctx)
 }
 
 func waitForSignal(ctx context.Context, cancel context.CancelFunc) {
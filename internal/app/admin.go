@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"github.com/reactivejson/vwap-engine/internal/server"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/tunnel"
+	"log"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// TradingPairs returns the trading pairs subscribed to.
+func (s *Context) TradingPairs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]string(nil), s.tradingPairs...)
+}
+
+// AddTradingPair subscribes the tunnel to a trading pair at runtime. Its VWAP state is created by its first trade.
+func (s *Context) AddTradingPair(tradingPair string) error {
+	s.adminMu.Lock()
+	defer s.adminMu.Unlock()
+
+	if contains(s.TradingPairs(), tradingPair) {
+		return nil
+	}
+	if err := s.wsReceiver.Subscribe([]string{tradingPair}); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", tradingPair, err)
+	}
+
+	s.mu.Lock()
+	s.tradingPairs = append(s.tradingPairs, tradingPair)
+	delete(s.removed, tradingPair)
+	s.forget(tradingPair)
+	s.mu.Unlock()
+	log.Printf("Subscribed to trading pair %s", tradingPair)
+	return nil
+}
+
+// RemoveTradingPair unsubscribes the tunnel from a trading pair at runtime and tears down its VWAP state,
+// of every venue. Its trades still in flight are dropped.
+func (s *Context) RemoveTradingPair(tradingPair string) error {
+	s.adminMu.Lock()
+	defer s.adminMu.Unlock()
+
+	if !contains(s.TradingPairs(), tradingPair) {
+		return fmt.Errorf("%w: %s", server.ErrUnknownTradingPair, tradingPair)
+	}
+	if err := s.wsReceiver.Unsubscribe([]string{tradingPair}); err != nil {
+		return fmt.Errorf("failed to unsubscribe from %s: %w", tradingPair, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tearDown(tradingPair)
+	log.Printf("Unsubscribed from trading pair %s", tradingPair)
+	return nil
+}
+
+// reject tears down the trading pairs an exchange rejected once added at runtime, and unsubscribes the other venues
+// from them in the background, so that the feed of the other trading pairs goes on. The trading pairs of the
+// configuration are rejected on startup: err is returned, stopping the feed.
+func (s *Context) reject(err *tunnel.ExchangeError) error {
+	for _, tradingPair := range err.TradingPairs {
+		if contains(s.cfg.TradingPairs, tradingPair) {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	for _, tradingPair := range err.TradingPairs {
+		s.tearDown(tradingPair)
+	}
+	s.mu.Unlock()
+	log.Printf("Dropped trading pairs %v rejected on %v", err.TradingPairs, err)
+
+	go func(tradingPairs []string) {
+		s.adminMu.Lock()
+		defer s.adminMu.Unlock()
+		if err := s.wsReceiver.Unsubscribe(tradingPairs); err != nil {
+			log.Printf("error unsubscribing from rejected trading pairs %v: %v", tradingPairs, err)
+		}
+	}(err.TradingPairs)
+	return nil
+}
+
+// tearDown drops a trading pair and its VWAP state, of every venue. Its trades still in flight are dropped.
+// s.mu must be held.
+func (s *Context) tearDown(tradingPair string) {
+	tradingPairs := make([]string, 0, len(s.tradingPairs))
+	for _, subscribed := range s.tradingPairs {
+		if subscribed != tradingPair {
+			tradingPairs = append(tradingPairs, subscribed)
+		}
+	}
+	s.tradingPairs = tradingPairs
+	s.removed[tradingPair] = true
+
+	s.queue.Delete(tradingPair)
+	for _, venue := range s.cfg.Exchanges {
+		s.queue.Delete(storage.VenueKey(tradingPair, venue))
+	}
+	s.forget(tradingPair)
+}
+
+// forget drops the trade ID sequences of a trading pair, so a new subscription doesn't report a gap since the last one,
+// and its latency histograms.
+func (s *Context) forget(tradingPair string) {
+	keys := []string{tradingPair}
+	for _, venue := range s.cfg.Exchanges {
+		keys = append(keys, storage.VenueKey(tradingPair, venue))
+	}
+	for _, key := range keys {
+		s.sequencer.Forget(key)
+		if s.latency != nil {
+			s.latency.Forget(key)
+		}
+	}
+}
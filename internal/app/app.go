@@ -2,9 +2,15 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/handoff"
+	"github.com/reactivejson/vwap-engine/internal/latency"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"github.com/reactivejson/vwap-engine/internal/sequence"
 	"github.com/reactivejson/vwap-engine/internal/storage"
+	"log"
 	"strconv"
 	"time"
 )
@@ -15,52 +21,265 @@ import (
  */
 
 //Run the App context, subscribe to the ws, and initiate the storage and calculation for the trading pairs.
+//The HTTP query API serves the current VWAPs until ctx is done.
 //It is resilient tolerant. It will gracefully shut down and can receive an interrupt signal and safely to close the connexion.
 func (s *Context) Run(ctx context.Context) (err error) {
-	receiver := make(chan *models.CoinbaseResponse)
+	receiver := make(chan *models.Trade)
 
-	err = s.wsReceiver.Subscribe(s.cfg.TradingPairs)
+	if err = s.server.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start HTTP query API err: %w", err)
+	}
+
+	err = s.wsReceiver.Subscribe(s.TradingPairs())
 	if err != nil {
 		return fmt.Errorf("failed to subscribe err: %w", err)
 	}
 
 	s.wsReceiver.Read(ctx, receiver)
 
-	for response := range receiver {
-		//Skip non valid responses
-		if response.Price == "" {
-			continue
+	//A bounded buffer between the feed and the VWAP pipeline, so a slow consumer doesn't stall the websocket reads.
+	trades := (<-chan *models.Trade)(receiver)
+	if s.cfg.HandoffCapacity > 0 {
+		buffer, err := handoff.New(int(s.cfg.HandoffCapacity), handoff.Policy(s.cfg.HandoffPolicy), s.metrics)
+		if err != nil {
+			return err
 		}
+		trades = buffer.Forward(ctx, receiver)
+	}
+
+	//A replay is expired on the clock of the recording by process, the wall clock being long past it.
+	if expirer, ok := s.queue.(storage.Expirer); ok && s.cfg.ReplayPath == "" {
+		go expire(ctx, expirer, s.cfg.ExpiryInterval)
+	}
+	if s.latency != nil && s.cfg.LatencyLogInterval > 0 {
+		go logLatencies(ctx, s.latency, s.cfg.LatencyLogInterval)
+	}
 
-		if dataPoint, err := parseData(response); err != nil {
+	for trade := range trades {
+		if err = s.process(ctx, trade); err != nil {
 			return err
-		} else {
-			s.queue.Push(dataPoint)
 		}
-
-		// Log VWAPs of trading pairs to stdout.
-		fmt.Println(time.Now().Format(time.UnixDate))
-		fmt.Println("VWAPs:", s.queue)
+	}
+	if err = s.wsReceiver.Err(); err != nil {
+		return fmt.Errorf("tunnel stopped err: %w", err)
 	}
 	return
 }
 
-//Convert JSON response (models.CoinbaseResponse) to a storage.Point
-func parseData(response *models.CoinbaseResponse) (storage.Point, error) {
-	price, err := strconv.ParseFloat(response.Price, 64)
+//process checks the sequence of a trade, then pushes it onto the VWAP storage.
+//Duplicated trades, e.g. replayed after a reconnect, are dropped before being pushed.
+//The trades missing before a gap are backfilled first, so the window stays in trade ID order.
+//Trade IDs are sequenced per venue, as every venue numbers its trades on its own.
+//A snapshot trade, from before the subscription, only seeds the sequence of a new subscription. After a reconnect,
+//it is sequenced like a live trade, so the trades missed meanwhile are backfilled.
+//The trade is stamped once its VWAPs are updated and published, and its latencies observed.
+func (s *Context) process(ctx context.Context, trade *models.Trade) error {
+	key := trade.ProductID
+	if s.multiVenue {
+		key = storage.VenueKey(trade.ProductID, trade.Venue)
+	}
+	if trade.Snapshot {
+		if _, ok := s.sequencer.Last(key); !ok || trade.TradeID == 0 {
+			if trade.TradeID != 0 {
+				s.sequencer.Observe(key, trade.TradeID)
+			}
+			return nil
+		}
+	}
+
+	if trade.TradeID != 0 {
+		switch result, gap := s.sequencer.Observe(key, trade.TradeID); result {
+		case sequence.Duplicate:
+			return nil
+		case sequence.Gap:
+			s.onGap(*gap)
+			if err := s.backfill(ctx, trade, *gap); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.push(trade); err != nil {
+		return err
+	}
+	if s.cfg.ReplayPath != "" {
+		s.expireReplay(trade.ReceivedAt)
+	}
+
+	// Log VWAPs of trading pairs to stdout, at most every PrintInterval so that a slow stdout doesn't slow the pipeline.
+	if now := time.Now(); now.Sub(s.printedAt) >= s.cfg.PrintInterval {
+		s.printedAt = now
+		fmt.Fprintln(s.stdout, now.Format(time.UnixDate))
+		fmt.Fprintln(s.stdout, "VWAPs:", s.queue)
+	}
+
+	// Trades of the trading pairs removed aren't pushed, nor observed.
+	if s.latency != nil && !trade.PushedAt.IsZero() {
+		trade.PublishedAt = time.Now()
+		s.latency.Observe(key, trade)
+	}
+	return nil
+}
+
+//push parses a trade and pushes it onto the VWAP storage.
+//With several venues, the trade is pushed to the window of its venue, and to the consolidated window of its
+//trading pair when its venue is consolidated.
+//Trades of trading pairs removed at runtime are dropped, so they don't recreate the VWAP state torn down.
+//The trades pushed are stamped with the time their VWAPs were updated.
+func (s *Context) push(trade *models.Trade) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.removed[trade.ProductID] {
+		return nil
+	}
+	if !s.multiVenue {
+		if err := s.pushAs(trade, trade.ProductID); err != nil {
+			return err
+		}
+		trade.PushedAt = time.Now()
+		return nil
+	}
+
+	if err := s.pushAs(trade, storage.VenueKey(trade.ProductID, trade.Venue)); err != nil {
+		return err
+	}
+	if s.consolidated[trade.Venue] {
+		if err := s.pushAs(trade, trade.ProductID); err != nil {
+			return err
+		}
+	}
+	trade.PushedAt = time.Now()
+	return nil
+}
+
+//pushAs parses a trade into a data point of the window key and pushes it onto the VWAP storage.
+func (s *Context) pushAs(trade *models.Trade, key string) error {
+	keyed := *trade
+	keyed.ProductID = key
+
+	dataPoint, err := s.parse(&keyed)
 	if err != nil {
-		return nil, fmt.Errorf("Error parsing price %s: %w", response.Price, err)
+		return err
 	}
+	s.queue.Push(dataPoint)
+	return nil
+}
 
-	quantity, err := strconv.ParseFloat(response.Size, 64)
+//backfill fetches the trades missing in a gap before trade from the exchange REST API and pushes them in trade ID order.
+//A failed backfill is logged and counted but doesn't stop live processing.
+func (s *Context) backfill(ctx context.Context, trade *models.Trade, gap sequence.GapEvent) error {
+	if s.backfiller == nil || s.cfg.BackfillMaxTrades == 0 || uint(gap.Missing()) > s.cfg.BackfillMaxTrades {
+		return nil
+	}
+	// Only the trade IDs of the Coinbase feed can be backfilled.
+	if s.multiVenue && trade.Venue != ExchangeCoinbase {
+		return nil
+	}
+
+	// The timeout bounds the whole backfill, of as many pages as the gap needs.
+	if s.cfg.BackfillTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.BackfillTimeout)
+		defer cancel()
+	}
+	trades, err := s.backfiller.Trades(ctx, trade.ProductID, gap.From, gap.To)
 	if err != nil {
-		return nil, fmt.Errorf("Error parsing quantity %s: %w", response.Size, err)
+		log.Printf("error backfilling trades %d to %d of %s: %v", gap.From, gap.To, trade.ProductID, err)
+		s.metrics.Add(metrics.Name("backfill_errors_total", "product_id", trade.ProductID), 1)
+		return nil
+	}
+
+	for _, trade := range trades {
+		if err = s.push(trade); err != nil {
+			return err
+		}
 	}
 
-	return storage.NewPoint(
+	s.metrics.Add(metrics.Name("backfill_trades_total", "product_id", trade.ProductID), uint64(len(trades)))
+	log.Printf("backfilled %d of %d trades missing in %s", len(trades), gap.Missing(), trade.ProductID)
+	return nil
+}
+
+//logGap logs a sequence gap as a structured JSON event.
+func logGap(gap sequence.GapEvent) {
+	event, err := json.Marshal(gap)
+	if err != nil {
+		log.Printf("error encoding sequence gap %+v: %v", gap, err)
+		return
+	}
+	log.Printf("sequence gap, VWAP may be incomplete: %s", event)
+}
+
+//Convert a normalized trade (models.Trade) to a storage.Point
+func parseData(trade *models.Trade) (storage.Point, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing price %s: %w", trade.Price, err)
+	}
+
+	quantity, err := strconv.ParseFloat(trade.Size, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing quantity %s: %w", trade.Size, err)
+	}
+
+	return storage.NewTimedPoint(
 		price,
 		quantity,
-		response.ProductID,
+		trade.ProductID,
+		trade.Time,
 	), nil
 
 }
+
+//Convert a normalized trade (models.Trade) to an exact storage.DecimalPoint, parsed from the price and size strings.
+func parseDecimalData(trade *models.Trade) (storage.Point, error) {
+	dataPoint, err := storage.NewDecimalPoint(trade.Price, trade.Size, trade.ProductID, trade.Time)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing decimal data point: %w", err)
+	}
+	return dataPoint, nil
+}
+
+//expireReplay evicts the data points that fell out of a time window every ExpiryInterval of a replay, on the clock of
+//the recording: now is the time the last trade replayed was received at when recorded.
+func (s *Context) expireReplay(now time.Time) {
+	expirer, ok := s.queue.(storage.Expirer)
+	if !ok || now.Before(s.replayExpiredAt.Add(s.cfg.ExpiryInterval)) {
+		return
+	}
+	s.replayExpiredAt = now
+	expirer.Expire(now)
+}
+
+//expire evicts the data points that fell out of a time window every interval, until ctx is done.
+func expire(ctx context.Context, expirer storage.Expirer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expirer.Expire(now)
+		}
+	}
+}
+
+//logLatencies logs the latency histograms of every trading pair every interval, until ctx is done.
+func logLatencies(ctx context.Context, tracker *latency.Tracker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if summary := tracker.String(); summary != "" {
+				log.Printf("latencies:\n%s", summary)
+			}
+		}
+	}
+}
@@ -1,10 +1,28 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/sequence"
+	"github.com/reactivejson/vwap-engine/internal/server"
 	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/decimal"
+	"github.com/reactivejson/vwap-engine/internal/storage/queue"
+	"github.com/reactivejson/vwap-engine/internal/storage/time-window"
+	"github.com/reactivejson/vwap-engine/internal/tunnel"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 /**
@@ -15,7 +33,7 @@ import (
 func TestParseData_ShouldSucceed(t *testing.T) {
 	t.Parallel()
 
-	data := &models.CoinbaseResponse{
+	data := &models.Trade{
 		Price:     "1",
 		ProductID: "TradingPair1",
 		Size:      "1",
@@ -26,10 +44,59 @@ func TestParseData_ShouldSucceed(t *testing.T) {
 	require.Equal(t, storage.NewPoint(1, 1, "TradingPair1"), dataPoint)
 }
 
+func TestParseData_WithTime_ShouldSucceed(t *testing.T) {
+	t.Parallel()
+
+	data := &models.Trade{
+		Price:     "29303.35",
+		ProductID: "BTC-USD",
+		Size:      "0.0000299",
+		Time:      time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC),
+	}
+
+	dataPoint, err := parseData(data)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC), dataPoint.GetTime())
+}
+
+func TestParseDecimalData_ShouldSucceed(t *testing.T) {
+	t.Parallel()
+
+	data := &models.Trade{
+		Price:     "29303.35",
+		ProductID: "BTC-USD",
+		Size:      "0.0000299",
+		Time:      time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC),
+	}
+
+	dataPoint, err := parseDecimalData(data)
+	require.NoError(t, err)
+
+	exact, ok := dataPoint.(storage.ExactPoint)
+	require.True(t, ok)
+	require.Equal(t, "29303.35", exact.ExactPrice().FloatString(2))
+	require.Equal(t, "0.0000299", exact.ExactQuantity().FloatString(7))
+	require.Equal(t, "BTC-USD", dataPoint.ProductID())
+	require.Equal(t, time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC), dataPoint.GetTime())
+}
+
+func TestParseDecimalData_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	data := &models.Trade{
+		Price:     "1",
+		ProductID: "TradingPair1",
+		Size:      "fail",
+	}
+
+	_, err := parseDecimalData(data)
+	require.Error(t, err)
+}
+
 func TestParseData_ShouldFail(t *testing.T) {
 	t.Parallel()
 
-	data := &models.CoinbaseResponse{
+	data := &models.Trade{
 		Price:     "fail",
 		ProductID: "TradingPair1",
 		Size:      "1",
@@ -39,3 +106,634 @@ func TestParseData_ShouldFail(t *testing.T) {
 	require.Error(t, err)
 
 }
+
+func TestContext_Process_ShouldDropDuplicates_AndReportGaps(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	s := NewContext(nil, vwapQueue, &envConfig{Arithmetic: ArithmeticFloat})
+	var gaps []sequence.GapEvent
+	s.onGap = func(gap sequence.GapEvent) { gaps = append(gaps, gap) }
+
+	for _, tradeID := range []int{1, 2, 2, 1, 5, 6} {
+		require.NoError(t, s.process(context.Background(), &models.Trade{
+			Price:     "1",
+			ProductID: "BTC-USD",
+			Size:      "1",
+			TradeID:   tradeID,
+		}))
+	}
+
+	require.Equal(t, 4, int(vwapQueue.Size("BTC-USD")))
+	require.Len(t, gaps, 1)
+	require.Equal(t, 3, gaps[0].From)
+	require.Equal(t, 4, gaps[0].To)
+	require.Equal(t, uint64(2), s.metrics.Get(`sequence_duplicates_total{product_id="BTC-USD"}`))
+}
+
+func TestContext_Process_ShouldSeedSequenceWithSnapshot(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	s := NewContext(nil, vwapQueue, &envConfig{Arithmetic: ArithmeticFloat})
+	var gaps []sequence.GapEvent
+	s.onGap = func(gap sequence.GapEvent) { gaps = append(gaps, gap) }
+
+	// The last_match of the subscription only seeds the sequence, then a reconnect replays 12 and misses 13 and 14.
+	for _, trade := range []struct {
+		tradeID  int
+		snapshot bool
+	}{{10, true}, {11, false}, {12, false}, {12, true}, {15, true}} {
+		require.NoError(t, s.process(context.Background(), &models.Trade{
+			Price:     "1",
+			ProductID: "BTC-USD",
+			Size:      "1",
+			TradeID:   trade.tradeID,
+			Snapshot:  trade.snapshot,
+		}))
+	}
+
+	require.Equal(t, 3, int(vwapQueue.Size("BTC-USD")))
+	require.Len(t, gaps, 1)
+	require.Equal(t, 13, gaps[0].From)
+	require.Equal(t, 14, gaps[0].To)
+}
+
+func TestContext_Process_WithVenues_ShouldConsolidateIncludedVenues(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	s := NewContext(nil, vwapQueue, &envConfig{
+		Arithmetic:    ArithmeticFloat,
+		Exchanges:     []string{ExchangeCoinbase, ExchangeBinance, ExchangeKraken},
+		VenuesExclude: []string{ExchangeKraken},
+	})
+	s.onGap = func(sequence.GapEvent) {}
+
+	// Every venue numbers its trades on its own, so the same trade ID is no duplicate across venues.
+	for _, trade := range []*models.Trade{
+		{Venue: ExchangeCoinbase, ProductID: "BTC-USD", Price: "1", Size: "1", TradeID: 1},
+		{Venue: ExchangeBinance, ProductID: "BTC-USD", Price: "3", Size: "1", TradeID: 1},
+		{Venue: ExchangeKraken, ProductID: "BTC-USD", Price: "10", Size: "1", TradeID: 1},
+		{Venue: ExchangeBinance, ProductID: "BTC-USD", Price: "3", Size: "1", TradeID: 1},
+	} {
+		require.NoError(t, s.process(context.Background(), trade))
+	}
+
+	require.Equal(t, 2.0, vwapQueue.GetVwap("BTC-USD"))
+	require.Equal(t, 1.0, vwapQueue.GetVwap(storage.VenueKey("BTC-USD", ExchangeCoinbase)))
+	require.Equal(t, 3.0, vwapQueue.GetVwap(storage.VenueKey("BTC-USD", ExchangeBinance)))
+	require.Equal(t, 10.0, vwapQueue.GetVwap(storage.VenueKey("BTC-USD", ExchangeKraken)))
+	require.Equal(t, uint64(1), s.metrics.Get(`sequence_duplicates_total{product_id="BTC-USD@binance"}`))
+}
+
+func TestContext_Process_ShouldBackfillGaps(t *testing.T) {
+	t.Parallel()
+
+	// Fake Coinbase REST API, serving trades 1 to 9 newest first.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/products/BTC-USD/trades", r.URL.Path)
+		assert.Equal(t, "10", r.URL.Query().Get("after"))
+
+		var trades []models.CoinbaseResponse
+		for id := 9; id >= 1; id-- {
+			trades = append(trades, models.CoinbaseResponse{TradeID: id, Price: "2", Size: "1"})
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(trades))
+	}))
+	defer server.Close()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	s := NewContext(nil, vwapQueue, &envConfig{
+		Arithmetic:        ArithmeticFloat,
+		Exchanges:         []string{ExchangeCoinbase},
+		BackfillURL:       server.URL,
+		BackfillMaxTrades: 100,
+		BackfillTimeout:   time.Second,
+	})
+	s.onGap = func(sequence.GapEvent) {}
+
+	for _, tradeID := range []int{6, 10} {
+		require.NoError(t, s.process(context.Background(), &models.Trade{
+			Price:     "1",
+			ProductID: "BTC-USD",
+			Size:      "1",
+			TradeID:   tradeID,
+		}))
+	}
+
+	// Trades 7 to 9 are pushed between 6 and 10.
+	dataPoints := vwapQueue.GetDataPoints("BTC-USD").([]storage.Point)
+	require.Len(t, dataPoints, 5)
+	for i, price := range []float64{1, 2, 2, 2, 1} {
+		require.Equal(t, price, dataPoints[i].GetPrice())
+	}
+	require.Equal(t, uint64(3), s.metrics.Get(`backfill_trades_total{product_id="BTC-USD"}`))
+}
+
+func TestContext_Process_ShouldObserveLatencies(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	s := NewContext(nil, vwapQueue, &envConfig{Arithmetic: ArithmeticFloat})
+	receivedAt := time.Now()
+	trade := &models.Trade{
+		Price:      "1",
+		ProductID:  "BTC-USD",
+		Size:       "1",
+		TradeID:    1,
+		Time:       receivedAt.Add(-20 * time.Millisecond),
+		ReceivedAt: receivedAt,
+	}
+	require.NoError(t, s.process(context.Background(), trade))
+
+	// The trade is stamped in pipeline order.
+	assert.False(t, trade.PushedAt.Before(trade.ReceivedAt))
+	assert.False(t, trade.PublishedAt.Before(trade.PushedAt))
+
+	latencies := s.latency.Latencies()
+	require.Len(t, latencies, 1)
+	assert.Equal(t, "BTC-USD", latencies[0].ProductID)
+	assert.Equal(t, 20.0, latencies[0].Stages["exchange_to_receive"].MaxMs)
+	assert.Equal(t, uint64(1), latencies[0].Stages["receive_to_push"].Count)
+	assert.Equal(t, uint64(1), latencies[0].Stages["receive_to_publish"].Count)
+
+	// Replayed trades were received long before being processed.
+	s = NewContext(nil, vwapQueue, &envConfig{Arithmetic: ArithmeticFloat, ReplayPath: "feed-*.ndjson"})
+	assert.Nil(t, s.latency)
+}
+
+func TestContext_Process_ShouldBoundBackfillTime(t *testing.T) {
+	t.Parallel()
+
+	// Fake Coinbase REST API, serving pages of 2 trades older than the cursor, each taking 40ms.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		after, err := strconv.Atoi(r.URL.Query().Get("after"))
+		assert.NoError(t, err)
+		time.Sleep(40 * time.Millisecond)
+		assert.NoError(t, json.NewEncoder(w).Encode([]models.CoinbaseResponse{
+			{TradeID: after - 1, Price: "2", Size: "1"},
+			{TradeID: after - 2, Price: "2", Size: "1"},
+		}))
+	}))
+	defer server.Close()
+
+	vwapQueue, err := queue.NewVwapQueue(100)
+	require.NoError(t, err)
+
+	s := NewContext(nil, vwapQueue, &envConfig{
+		Arithmetic:        ArithmeticFloat,
+		Exchanges:         []string{ExchangeCoinbase},
+		BackfillURL:       server.URL,
+		BackfillMaxTrades: 100,
+		BackfillTimeout:   100 * time.Millisecond,
+	})
+	s.onGap = func(sequence.GapEvent) {}
+
+	// The 20 trades missing take 10 requests, each one shorter than the timeout.
+	start := time.Now()
+	for _, tradeID := range []int{1, 22} {
+		require.NoError(t, s.process(context.Background(), &models.Trade{
+			Price:     "1",
+			ProductID: "BTC-USD",
+			Size:      "1",
+			TradeID:   tradeID,
+		}))
+	}
+
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+	assert.Equal(t, uint64(1), s.metrics.Get(`backfill_errors_total{product_id="BTC-USD"}`))
+	assert.Equal(t, 2, int(vwapQueue.Size("BTC-USD")))
+}
+
+// writeRecording records a Coinbase match of each product, one every interval from 2022-05-21T09:12:04Z.
+func writeRecording(t *testing.T, interval time.Duration, productIDs ...string) string {
+	dir := t.TempDir()
+	recorder, err := tunnel.NewRecorder(dir, 1<<20)
+	require.NoError(t, err)
+
+	start := time.Date(2022, 5, 21, 9, 12, 4, 0, time.UTC)
+	for i, productID := range productIDs {
+		at := start.Add(time.Duration(i) * interval)
+		frame := fmt.Sprintf(`{"type":"match","trade_id":%d,"product_id":"%s","size":"1","price":"%d","time":"%s"}`,
+			i+1, productID, i+1, at.Format(time.RFC3339Nano))
+		require.NoError(t, recorder.Record(tunnel.VenueCoinbase, []byte(frame), at))
+	}
+	require.NoError(t, recorder.Close())
+	return filepath.Join(dir, "*.ndjson")
+}
+
+func TestContext_Run_WithReplay_ShouldExpireOnRecordingClock(t *testing.T) {
+	t.Parallel()
+
+	// Replayed in real time, the recording lasts long enough for the expiry interval to elapse a few times.
+	pattern := writeRecording(t, 50*time.Millisecond, "BTC-USD", "ETH-USD", "BTC-USD", "ETH-USD")
+	replayer, err := tunnel.NewReplayer(tunnel.VenueCoinbase, pattern, 1, nil)
+	require.NoError(t, err)
+	window, err := time_window.NewVwapTimeWindow(time.Minute)
+	require.NoError(t, err)
+
+	s := NewContext(replayer, window, &envConfig{
+		Arithmetic:        ArithmeticFloat,
+		Exchanges:         []string{ExchangeCoinbase},
+		TradingPairs:      []string{"BTC-USD", "ETH-USD"},
+		WindowDuration:    time.Minute,
+		ExpiryInterval:    10 * time.Millisecond,
+		ReplayPath:        pattern,
+		BackfillMaxTrades: 100,
+	})
+	// A replay never backfills from the live REST API.
+	assert.Nil(t, s.backfiller)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Run(ctx))
+
+	// The recorded trades, hours older than the wall clock, are still in their 1-minute window.
+	assert.Equal(t, 2.0, window.GetVwap("BTC-USD"))
+	assert.Equal(t, 3.0, window.GetVwap("ETH-USD"))
+}
+
+func TestContext_Process_WithReplay_ShouldExpireQuietPairs(t *testing.T) {
+	t.Parallel()
+
+	window, err := time_window.NewVwapTimeWindow(time.Minute)
+	require.NoError(t, err)
+	s := NewContext(nil, window, &envConfig{
+		Arithmetic:     ArithmeticFloat,
+		WindowDuration: time.Minute,
+		ExpiryInterval: time.Second,
+		ReplayPath:     "feed-*.ndjson",
+	})
+
+	start := time.Date(2022, 5, 21, 9, 12, 4, 0, time.UTC)
+	for i, productID := range []string{"ETH-USD", "BTC-USD"} {
+		at := start.Add(time.Duration(i) * 2 * time.Minute)
+		require.NoError(t, s.process(context.Background(), &models.Trade{
+			Price:      "1",
+			ProductID:  productID,
+			Size:       "1",
+			TradeID:    i + 1,
+			Time:       at,
+			ReceivedAt: at,
+		}))
+	}
+
+	// ETH-USD was quiet for 2 minutes of the recording.
+	assert.Equal(t, uint(0), window.Size("ETH-USD"))
+	assert.Equal(t, uint(1), window.Size("BTC-USD"))
+}
+
+// fakeTunnel records the trading pairs it is subscribed to.
+type fakeTunnel struct {
+	tradingPairs []string
+}
+
+func (f *fakeTunnel) Subscribe(tradingPairs []string) error {
+	f.tradingPairs = append(f.tradingPairs, tradingPairs...)
+	return nil
+}
+
+func (f *fakeTunnel) Unsubscribe(tradingPairs []string) error {
+	subscribed := f.tradingPairs[:0]
+	for _, tradingPair := range f.tradingPairs {
+		if tradingPair != tradingPairs[0] {
+			subscribed = append(subscribed, tradingPair)
+		}
+	}
+	f.tradingPairs = subscribed
+	return nil
+}
+
+func (f *fakeTunnel) Read(context.Context, chan *models.Trade) {}
+
+func (f *fakeTunnel) Err() error { return nil }
+
+func (f *fakeTunnel) Close() {}
+
+func TestContext_RemoveTradingPair_ShouldTearDownItsState(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	ws := &fakeTunnel{tradingPairs: []string{"BTC-USD", "ETH-USD"}}
+	s := NewContext(ws, vwapQueue, &envConfig{
+		Arithmetic:   ArithmeticFloat,
+		Exchanges:    []string{ExchangeCoinbase, ExchangeBinance},
+		TradingPairs: []string{"BTC-USD", "ETH-USD"},
+	})
+
+	trade := func(tradeID int) *models.Trade {
+		return &models.Trade{Venue: ExchangeBinance, ProductID: "BTC-USD", Price: "1", Size: "1", TradeID: tradeID}
+	}
+	require.NoError(t, s.process(context.Background(), trade(1)))
+	require.NoError(t, s.RemoveTradingPair("BTC-USD"))
+
+	assert.Equal(t, []string{"ETH-USD"}, ws.tradingPairs)
+	assert.Equal(t, []string{"ETH-USD"}, s.TradingPairs())
+	assert.Empty(t, vwapQueue.Snapshot().Pairs)
+
+	// Trades still in flight don't recreate the state.
+	require.NoError(t, s.process(context.Background(), trade(2)))
+	assert.Empty(t, vwapQueue.Snapshot().Pairs)
+
+	require.ErrorIs(t, s.RemoveTradingPair("BTC-USD"), server.ErrUnknownTradingPair)
+	assert.Empty(t, s.latency.Latencies())
+
+	// Subscribing again starts a new sequence without reporting a gap.
+	s.onGap = func(gap sequence.GapEvent) { assert.Fail(t, "unexpected gap", "%+v", gap) }
+	require.NoError(t, s.AddTradingPair("BTC-USD"))
+	require.NoError(t, s.AddTradingPair("BTC-USD"))
+	assert.Equal(t, []string{"ETH-USD", "BTC-USD"}, ws.tradingPairs)
+	require.NoError(t, s.process(context.Background(), trade(10)))
+	assert.Equal(t, 1.0, vwapQueue.GetVwap("BTC-USD"))
+}
+
+// notifyingTunnel passes the trading pairs it is unsubscribed from to unsubscribed.
+type notifyingTunnel struct {
+	fakeTunnel
+	unsubscribed chan []string
+}
+
+func (f *notifyingTunnel) Unsubscribe(tradingPairs []string) error {
+	f.unsubscribed <- tradingPairs
+	return nil
+}
+
+func TestContext_Reject_ShouldTearDownTradingPairsAddedAtRuntime(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	ws := &notifyingTunnel{unsubscribed: make(chan []string, 1)}
+	s := NewContext(ws, vwapQueue, &envConfig{
+		Arithmetic:   ArithmeticFloat,
+		Exchanges:    []string{ExchangeCoinbase},
+		TradingPairs: []string{"BTC-USD"},
+	}, WithRejections(tunnel.NewRejections()))
+	require.NoError(t, s.AddTradingPair("BTC-XYZ"))
+
+	rejected := &tunnel.ExchangeError{Venue: ExchangeCoinbase, Message: "Failed to subscribe", TradingPairs: []string{"BTC-XYZ"}}
+	require.NoError(t, s.reject(rejected))
+	assert.Equal(t, []string{"BTC-USD"}, s.TradingPairs())
+	assert.Equal(t, []string{"BTC-XYZ"}, <-ws.unsubscribed)
+
+	// Trades still in flight don't recreate the state.
+	require.NoError(t, s.process(context.Background(), &models.Trade{ProductID: "BTC-XYZ", Price: "1", Size: "1", TradeID: 1}))
+	assert.Empty(t, vwapQueue.Snapshot().Pairs)
+
+	// A trading pair of the configuration is rejected on startup: the feed stops.
+	rejected = &tunnel.ExchangeError{Venue: ExchangeCoinbase, Message: "Failed to subscribe", TradingPairs: []string{"BTC-USD"}}
+	assert.Equal(t, rejected, s.reject(rejected))
+	assert.Equal(t, []string{"BTC-USD"}, s.TradingPairs())
+}
+
+func TestNewContext_ShouldServeAdminOnlyWithToken(t *testing.T) {
+	t.Parallel()
+
+	for token, wantStatus := range map[string]int{"": http.StatusNotFound, "secret": http.StatusUnauthorized} {
+		vwapQueue, err := queue.NewVwapQueue(10)
+		require.NoError(t, err)
+		s := NewContext(&fakeTunnel{}, vwapQueue, &envConfig{
+			Arithmetic:   ArithmeticFloat,
+			Exchanges:    []string{ExchangeCoinbase},
+			TradingPairs: []string{"BTC-USD"},
+			AdminToken:   token,
+		})
+
+		rec := httptest.NewRecorder()
+		s.server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/pairs/ETH-USD", nil))
+		assert.Equal(t, wantStatus, rec.Code, "token %q", token)
+	}
+}
+
+func TestBacktest_ShouldWriteVwapSeries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	trades := "product_id,time,price,size,side,trade_id\n" +
+		"BTC-USD,2022-05-21T09:12:00Z,0.1,3,buy,1\n" +
+		"BTC-USD,2022-05-21T09:12:01Z,0.2,3,sell,2\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "trades-1.csv"), []byte(trades), 0o600))
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	cfg := &envConfig{
+		Arithmetic:     ArithmeticDecimal,
+		BacktestInput:  filepath.Join(dir, "trades-*.csv"),
+		BacktestOutput: filepath.Join(dir, "vwap.ndjson"),
+	}
+	require.NoError(t, Backtest(context.Background(), vwapQueue, cfg))
+
+	content, err := os.ReadFile(cfg.BacktestOutput)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"vwap":0.15`)
+}
+
+func TestBacktest_WithoutInput_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	cfg := &envConfig{
+		BacktestInput:  filepath.Join(t.TempDir(), "*.csv"),
+		BacktestOutput: filepath.Join(t.TempDir(), "vwap.csv"),
+	}
+	require.Error(t, Backtest(context.Background(), vwapQueue, cfg))
+}
+
+func TestParseEnvConfig(t *testing.T) {
+	t.Parallel()
+
+	newConfig := func() *envConfig {
+		return &envConfig{
+			Mode:           ModeLive,
+			Arithmetic:     ArithmeticFloat,
+			Exchanges:      []string{ExchangeCoinbase},
+			HandoffPolicy:  "block",
+			RedundantLegs:  1,
+			WindowDuration: 5 * time.Minute,
+			ExpiryInterval: time.Second,
+		}
+	}
+	require.NoError(t, parseEnvConfig(newConfig()))
+
+	tests := []struct {
+		name   string
+		update func(cfg *envConfig)
+		err    string
+	}{
+		{"no expiry interval", func(cfg *envConfig) { cfg.ExpiryInterval = 0 }, "invalid EXPIRY_INTERVAL 0s"},
+		{"negative expiry interval", func(cfg *envConfig) { cfg.ExpiryInterval = -time.Second }, "invalid EXPIRY_INTERVAL -1s"},
+		{"unknown arithmetic", func(cfg *envConfig) { cfg.Arithmetic = "fixed" }, "invalid ARITHMETIC"},
+		{"unknown mode", func(cfg *envConfig) { cfg.Mode = "paper" }, "invalid MODE"},
+	}
+	for _, tt := range tests {
+		cfg := newConfig()
+		tt.update(cfg)
+		err := parseEnvConfig(cfg)
+		require.Error(t, err, tt.name)
+		assert.Contains(t, err.Error(), tt.err, tt.name)
+	}
+
+	// Windows bounded by a number of data points are never expired.
+	cfg := newConfig()
+	cfg.WindowDuration = 0
+	cfg.ExpiryInterval = 0
+	require.NoError(t, parseEnvConfig(cfg))
+}
+
+// slowTunnel is a fakeTunnel whose subscriptions wait for release, as the handshake of a redial does.
+type slowTunnel struct {
+	fakeTunnel
+	release chan struct{}
+}
+
+func (f *slowTunnel) Subscribe(tradingPairs []string) error {
+	<-f.release
+	return f.fakeTunnel.Subscribe(tradingPairs)
+}
+
+func TestContext_AddTradingPair_ShouldNotStallThePipeline(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(10)
+	require.NoError(t, err)
+
+	ws := &slowTunnel{release: make(chan struct{})}
+	s := NewContext(ws, vwapQueue, &envConfig{Arithmetic: ArithmeticFloat, TradingPairs: []string{"BTC-USD"}})
+
+	added := make(chan error, 1)
+	go func() { added <- s.AddTradingPair("ETH-USD") }()
+
+	// Trades are pushed while the subscription waits for the exchange.
+	processed := make(chan error, 1)
+	go func() {
+		processed <- s.process(context.Background(), &models.Trade{Price: "1", ProductID: "BTC-USD", Size: "1", TradeID: 1})
+	}()
+	select {
+	case err = <-processed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "trade not processed during the subscription")
+	}
+	assert.Equal(t, []string{"BTC-USD"}, s.TradingPairs())
+
+	close(ws.release)
+	require.NoError(t, <-added)
+	assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, s.TradingPairs())
+	assert.Equal(t, 1.0, vwapQueue.GetVwap("BTC-USD"))
+}
+
+func TestContext_Process_ShouldThrottlePrints(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		interval time.Duration
+		prints   int
+	}{{0, 100}, {time.Hour, 1}} {
+		vwapQueue, err := queue.NewVwapQueue(10)
+		require.NoError(t, err)
+
+		s := NewContext(nil, vwapQueue, &envConfig{Arithmetic: ArithmeticFloat, PrintInterval: tt.interval})
+		var stdout strings.Builder
+		s.stdout = &stdout
+
+		for tradeID := 1; tradeID <= 100; tradeID++ {
+			require.NoError(t, s.process(context.Background(), &models.Trade{
+				Price:     "1",
+				ProductID: "BTC-USD",
+				Size:      "1",
+				TradeID:   tradeID,
+			}))
+		}
+		assert.Equal(t, tt.prints, strings.Count(stdout.String(), "VWAPs:"), tt.interval)
+	}
+}
+
+func TestNewContext_WithSheddingHandoff_ShouldNotBackfill(t *testing.T) {
+	t.Parallel()
+
+	for policy, backfills := range map[string]bool{"block": true, "drop-oldest": false, "drop-newest": false, "coalesce": false} {
+		s := NewContext(nil, nil, &envConfig{
+			Arithmetic:      ArithmeticFloat,
+			Exchanges:       []string{ExchangeCoinbase},
+			HandoffCapacity: 100,
+			HandoffPolicy:   policy,
+		})
+		assert.Equal(t, backfills, s.backfiller != nil, policy)
+	}
+}
+
+func TestContext_Run_WithGenerator_Soak(t *testing.T) {
+	t.Parallel()
+
+	// A feed of synthetic trades never calls the exchange REST API, even on the gaps of a shedding handoff.
+	restAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Fail(t, "exchange REST API called", r.URL.String())
+	}))
+	defer restAPI.Close()
+
+	prices := map[string]float64{"BTC-USD": 30000, "ETH-USD": 2000, "ETH-BTC": 0.07}
+	for name, tt := range map[string]struct {
+		arithmetic string
+		newStorage func() (storage.Vwap, error)
+	}{
+		"time window": {ArithmeticFloat, func() (storage.Vwap, error) { return time_window.NewVwapTimeWindow(time.Minute) }},
+		"decimal":     {ArithmeticDecimal, func() (storage.Vwap, error) { return decimal.NewVwapDecimal(200, 0) }},
+	} {
+		vwaps, err := tt.newStorage()
+		require.NoError(t, err, name)
+		cfg := tunnel.DefaultGeneratorConfig
+		cfg.Seed = 7
+		cfg.Speed = 0
+		cfg.Prices = prices
+		generator, err := tunnel.NewGenerator(cfg)
+		require.NoError(t, err, name)
+
+		s := NewContext(generator, vwaps, &envConfig{
+			Mode:              ModeSynthetic,
+			Arithmetic:        tt.arithmetic,
+			Exchanges:         []string{ExchangeCoinbase},
+			TradingPairs:      []string{"BTC-USD", "ETH-USD", "ETH-BTC"},
+			WindowDuration:    time.Minute,
+			ExpiryInterval:    10 * time.Millisecond,
+			HandoffCapacity:   100,
+			HandoffPolicy:     "drop-oldest",
+			PrintInterval:     time.Hour,
+			BackfillURL:       restAPI.URL,
+			BackfillMaxTrades: 1000,
+		})
+		s.stdout = io.Discard
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		require.NoError(t, s.Run(ctx), name)
+		cancel()
+
+		snapshot := vwaps.Snapshot()
+		require.Len(t, snapshot.Pairs, len(prices), name)
+		for productID, price := range prices {
+			pair := snapshot.Pairs[productID]
+			assert.Positive(t, pair.Count, "%s %s", name, productID)
+			// The prices drift by a fraction of a percent in the few simulated seconds.
+			assert.InEpsilon(t, price, pair.Vwap, 0.05, "%s %s", name, productID)
+		}
+		assert.Zero(t, s.metrics.Get(`backfill_errors_total{product_id="BTC-USD"}`), name)
+	}
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/internal/backtest"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Backtest pushes the historical trades of the files matching BACKTEST_INPUT, in file name order, onto the VWAP storage
+// and writes the resulting VWAP time series to BACKTEST_OUTPUT, without connecting to the live feed.
+func Backtest(ctx context.Context, queue storage.Vwap, cfg *envConfig) (err error) {
+	inputs, err := filepath.Glob(cfg.BacktestInput)
+	if err != nil {
+		return fmt.Errorf("invalid BACKTEST_INPUT %s: %w", cfg.BacktestInput, err)
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no trades file matches BACKTEST_INPUT %s", cfg.BacktestInput)
+	}
+	sort.Strings(inputs)
+
+	series, err := backtest.NewSeriesWriter(cfg.BacktestOutput)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := series.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	parse := parseData
+	if cfg.Arithmetic == ArithmeticDecimal {
+		parse = parseDecimalData
+	}
+
+	start := time.Now()
+	pushed, err := backtest.Run(ctx, inputs, queue, parse, series)
+	if err != nil {
+		return fmt.Errorf("backtest failed after %d trades: %w", pushed, err)
+	}
+
+	log.Printf("Backtest completed: %d trades from %d file(s) in %v, VWAP series written to %s",
+		pushed, len(inputs), time.Since(start), cfg.BacktestOutput)
+	return nil
+}
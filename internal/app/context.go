@@ -1,8 +1,18 @@
 package app
 
 import (
+	"context"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/handoff"
+	"github.com/reactivejson/vwap-engine/internal/latency"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"github.com/reactivejson/vwap-engine/internal/sequence"
+	"github.com/reactivejson/vwap-engine/internal/server"
 	"github.com/reactivejson/vwap-engine/internal/storage"
 	"github.com/reactivejson/vwap-engine/internal/tunnel"
+	"io"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -11,12 +21,148 @@ import (
  * © 2022
  */
 
+const (
+	// ArithmeticFloat computes VWAPs with float64, fast but drifting over millions of trades.
+	ArithmeticFloat = "float"
+	// ArithmeticDecimal computes VWAPs with exact decimals parsed from the feed.
+	ArithmeticDecimal = "decimal"
+
+	// ExchangeCoinbase receives the trades of the Coinbase matches channel.
+	ExchangeCoinbase = tunnel.VenueCoinbase
+	// ExchangeBinance receives the trades of the Binance <symbol>@trade streams.
+	ExchangeBinance = tunnel.VenueBinance
+	// ExchangeKraken receives the trades of the Kraken v2 trade channel.
+	ExchangeKraken = tunnel.VenueKraken
+
+	// ModeLive computes VWAPs from the live websocket feed, or a replay of it.
+	ModeLive = "live"
+	// ModeBacktest computes a VWAP time series from historical trade files.
+	ModeBacktest = "backtest"
+	// ModeSynthetic computes VWAPs from generated trades, to load and soak test the engine without network.
+	ModeSynthetic = "synthetic"
+)
+
 type envConfig struct {
+	// Mode selects the live feed (live), the backtest of historical trade files (backtest) or a feed of synthetic
+	// trades (synthetic).
+	Mode         string        `envconfig:"MODE"               required:"false" default:"live"`
 	Port         uint          `envconfig:"PORT"               required:"false" default:"8080"`
+	// AdminToken authorizes the requests of the admin API managing the trading pairs, which isn't served when empty.
+	AdminToken   string        `envconfig:"ADMIN_TOKEN"        required:"false" default:""`
 	HTTPTimeout  time.Duration `envconfig:"HTTP_TIMEOUT"       required:"false" default:"1800s"`
 	WebsocketUrl string        `envconfig:"WEBSOCKET_URL"      required:"false" default:"wss://ws-feed.pro.coinbase.com"`
 	TradingPairs []string      `envconfig:"TRADING_PAIRS"      required:"false" default:"BTC-USD,ETH-USD,ETH-BTC"`
 	WindowSize   uint          `envconfig:"WINDOW_SIZE"        required:"false" default:"200"`
+	// Exchanges selects the venues of the live feed among coinbase, binance and kraken, e.g. coinbase,binance.
+	// With more than one venue, VWAPs are computed per venue and consolidated across venues.
+	Exchanges []string `envconfig:"EXCHANGE"           required:"false" default:"coinbase"`
+	// VenuesInclude restricts the venues consolidated in the VWAP of a trading pair, all of them when empty.
+	VenuesInclude []string `envconfig:"VENUES_INCLUDE"     required:"false" default:""`
+	// VenuesExclude removes venues from the consolidated VWAP. Their per-venue VWAP is still computed.
+	VenuesExclude []string `envconfig:"VENUES_EXCLUDE"     required:"false" default:""`
+	// SymbolMap overrides the venue symbols of trading pairs, e.g. binance/BTC-USD:BTCFDUSD,kraken/BTC-USD:XBT/USD.
+	SymbolMap map[string]string `envconfig:"SYMBOL_MAP"         required:"false" default:""`
+	// Symbols is SymbolMap parsed by SetupEnvConfig.
+	Symbols tunnel.SymbolMap `ignored:"true"`
+	// BinanceWebsocketUrl is the Binance websocket server, used when Exchanges has binance.
+	BinanceWebsocketUrl string `envconfig:"BINANCE_WEBSOCKET_URL" required:"false" default:"wss://stream.binance.com:9443"`
+	// KrakenWebsocketUrl is the Kraken v2 websocket server, used when Exchanges has kraken.
+	KrakenWebsocketUrl string `envconfig:"KRAKEN_WEBSOCKET_URL" required:"false" default:"wss://ws.kraken.com/v2"`
+	// WindowDuration switches to a VWAP window bounded by time (e.g. 5m, 1h) instead of WindowSize data points.
+	WindowDuration time.Duration `envconfig:"WINDOW_DURATION"    required:"false" default:"0s"`
+	// ExpiryInterval is how often data points older than WindowDuration are evicted when no new trade arrives.
+	ExpiryInterval time.Duration `envconfig:"EXPIRY_INTERVAL"    required:"false" default:"1s"`
+	// Arithmetic selects float64 (float) or exact decimal (decimal) data points and VWAP storage.
+	Arithmetic string `envconfig:"ARITHMETIC"         required:"false" default:"float"`
+	// BackfillURL is the exchange REST API used to fetch the trades missing from the feed.
+	BackfillURL string `envconfig:"BACKFILL_URL"       required:"false" default:"https://api.exchange.coinbase.com"`
+	// BackfillMaxTrades is the largest gap backfilled, 0 to disable backfilling.
+	BackfillMaxTrades uint `envconfig:"BACKFILL_MAX_TRADES" required:"false" default:"1000"`
+	// BackfillTimeout bounds the time spent backfilling a gap, over all its requests, before resuming live processing.
+	BackfillTimeout time.Duration `envconfig:"BACKFILL_TIMEOUT"   required:"false" default:"10s"`
+	// PairsPerConnection shards the trading pairs of every venue across connections of at most this many trading
+	// pairs each, 0 to receive all of them on a single connection.
+	PairsPerConnection uint `envconfig:"PAIRS_PER_CONNECTION" required:"false" default:"0"`
+	// ProxyURL is the HTTP CONNECT (http://) or SOCKS5 (socks5://) proxy the exchanges are dialed through,
+	// empty to dial them directly.
+	ProxyURL string `envconfig:"PROXY_URL"          required:"false" default:""`
+	// TLSCAFile is a PEM bundle of CAs trusted on top of the system ones, e.g. a corporate CA.
+	TLSCAFile string `envconfig:"TLS_CA_FILE"        required:"false" default:""`
+	// TLSCertFile and TLSKeyFile are the PEM client certificate and key presented to the servers requiring one.
+	TLSCertFile string `envconfig:"TLS_CERT_FILE"      required:"false" default:""`
+	TLSKeyFile  string `envconfig:"TLS_KEY_FILE"       required:"false" default:""`
+	// TLSMinVersion is the oldest TLS version accepted (1.0, 1.1, 1.2 or 1.3), Go's default when empty.
+	TLSMinVersion string `envconfig:"TLS_MIN_VERSION"    required:"false" default:""`
+	// TLSServerName overrides the server name sent with SNI and verified against the exchange certificates.
+	TLSServerName string `envconfig:"TLS_SERVER_NAME"    required:"false" default:""`
+	// PingInterval is the time between two pings sent to the exchanges, 0 to send none.
+	PingInterval time.Duration `envconfig:"PING_INTERVAL"      required:"false" default:"15s"`
+	// PongTimeout is the time an exchange has to answer a ping before its connection is redialed, 0 to wait forever.
+	PongTimeout time.Duration `envconfig:"PONG_TIMEOUT"       required:"false" default:"10s"`
+	// ReadTimeout is the longest time without any frame, ping or pong from an exchange before its connection is
+	// redialed, 0 to wait forever.
+	ReadTimeout time.Duration `envconfig:"READ_TIMEOUT"       required:"false" default:"60s"`
+	// StaleInterval flags a trading pair stale after this time without trade nor heartbeat, and reconnects a
+	// connection silent for as long. 0 disables the watchdog.
+	StaleInterval time.Duration `envconfig:"STALE_INTERVAL"     required:"false" default:"30s"`
+	// HandoffCapacity is the number of trades buffered between the live feed and the VWAP pipeline, 0 to hand them
+	// off unbuffered.
+	HandoffCapacity uint `envconfig:"HANDOFF_CAPACITY"   required:"false" default:"10000"`
+	// HandoffPolicy is what a full handoff buffer does with an incoming trade: block, drop-oldest, drop-newest or
+	// coalesce (replacing the latest trade waiting of its pair). The policies shedding trades disable backfilling.
+	HandoffPolicy string `envconfig:"HANDOFF_POLICY"     required:"false" default:"block"`
+	// PrintInterval is the shortest time between two prints of the VWAPs to stdout, 0 to print them on every trade.
+	PrintInterval time.Duration `envconfig:"PRINT_INTERVAL"     required:"false" default:"1s"`
+	// LatencyLogInterval is how often the latency histograms of every trading pair are logged, 0 to log none.
+	LatencyLogInterval time.Duration `envconfig:"LATENCY_LOG_INTERVAL" required:"false" default:"1m"`
+	// RedundantLegs is the number of hot-hot connections receiving the same trading pairs of every venue, merged
+	// keeping the first copy of every trade, so that a connection dying leaves no gap. 1 disables redundancy.
+	RedundantLegs uint `envconfig:"REDUNDANT_LEGS"     required:"false" default:"1"`
+	// RedundantURLs are the endpoints of the legs after the first one, as venue=url entries, e.g.
+	// coinbase=wss://ws-feed-backup.example.com. The legs without one connect to the endpoint of their venue.
+	RedundantURLs []string `envconfig:"REDUNDANT_URLS"     required:"false" default:""`
+	// LegURLs is RedundantURLs parsed by SetupEnvConfig, by venue.
+	LegURLs map[string][]string `ignored:"true"`
+	// DedupCapacity is the number of trade IDs remembered per trading pair and venue to discard the duplicates
+	// of the redundant legs.
+	DedupCapacity uint `envconfig:"DEDUP_CAPACITY"     required:"false" default:"10000"`
+	// RecordDir records every raw websocket frame to NDJSON files in this directory, empty to disable recording.
+	RecordDir string `envconfig:"RECORD_DIR"         required:"false" default:""`
+	// RecordMaxBytes is the size from which a new recording file is started.
+	RecordMaxBytes int64 `envconfig:"RECORD_MAX_BYTES"   required:"false" default:"104857600"`
+	// ReplayPath replays the recordings matching this pattern (e.g. /data/feed-*.ndjson) instead of the websocket.
+	ReplayPath string `envconfig:"REPLAY_PATH"        required:"false" default:""`
+	// ReplaySpeed scales the replay: 1 in real time, N times faster, or 0 as fast as possible.
+	ReplaySpeed float64 `envconfig:"REPLAY_SPEED"       required:"false" default:"1"`
+	// SyntheticSeed makes the synthetic trades of every trading pair the same from a run to another.
+	SyntheticSeed int64 `envconfig:"SYNTHETIC_SEED"     required:"false" default:"1"`
+	// SyntheticRate is the average number of synthetic trades per second of every trading pair.
+	SyntheticRate float64 `envconfig:"SYNTHETIC_RATE"     required:"false" default:"1000"`
+	// SyntheticSpeed scales the pace of the synthetic trades: 1 in real time, N times faster, or 0 as fast as possible.
+	SyntheticSpeed float64 `envconfig:"SYNTHETIC_SPEED"    required:"false" default:"1"`
+	// SyntheticPrices are the first prices of trading pairs, e.g. BTC-USD:30000,ETH-USD:2000, 100 for the others.
+	SyntheticPrices map[string]float64 `envconfig:"SYNTHETIC_PRICES"   required:"false" default:""`
+	// SyntheticVolatility is the annualized volatility of the geometric random walk of the synthetic prices.
+	SyntheticVolatility float64 `envconfig:"SYNTHETIC_VOLATILITY" required:"false" default:"0.8"`
+	// SyntheticMedianSize and SyntheticSizeSigma are the median and log standard deviation of the lognormal sizes.
+	SyntheticMedianSize float64 `envconfig:"SYNTHETIC_MEDIAN_SIZE" required:"false" default:"0.05"`
+	SyntheticSizeSigma  float64 `envconfig:"SYNTHETIC_SIZE_SIGMA" required:"false" default:"1"`
+	// SyntheticBuyRatio is the share of synthetic trades whose maker side is buy.
+	SyntheticBuyRatio float64 `envconfig:"SYNTHETIC_BUY_RATIO" required:"false" default:"0.5"`
+	// SyntheticBurstProbability is the probability that a synthetic trade starts a burst of SyntheticBurstLength
+	// trades, SyntheticBurstFactor times faster.
+	SyntheticBurstProbability float64 `envconfig:"SYNTHETIC_BURST_PROBABILITY" required:"false" default:"0.001"`
+	SyntheticBurstLength      int     `envconfig:"SYNTHETIC_BURST_LENGTH" required:"false" default:"100"`
+	SyntheticBurstFactor      float64 `envconfig:"SYNTHETIC_BURST_FACTOR" required:"false" default:"10"`
+	// BacktestInput is the pattern of the CSV or NDJSON trade files backtested, e.g. /data/trades-2022-05-*.csv.
+	BacktestInput string `envconfig:"BACKTEST_INPUT"     required:"false" default:""`
+	// BacktestOutput is the CSV (.csv) or NDJSON file the backtest VWAP time series is written to.
+	BacktestOutput string `envconfig:"BACKTEST_OUTPUT"    required:"false" default:"vwap.csv"`
+}
+
+// backfiller fetches the trades of a product between two trade IDs, in trade ID order.
+type backfiller interface {
+	Trades(ctx context.Context, productID string, from, to int) ([]*models.Trade, error)
 }
 
 // Context is application's content
@@ -24,13 +170,140 @@ type Context struct {
 	cfg        *envConfig
 	wsReceiver tunnel.Tunnel
 	queue      storage.Vwap
+	server     *server.Server
+	parse      func(trade *models.Trade) (storage.Point, error)
+	metrics    *metrics.Counters
+	sequencer  *sequence.Tracker
+	// onGap is called with every trade ID gap detected in the feed.
+	onGap      func(gap sequence.GapEvent)
+	backfiller backfiller
+	// multiVenue pushes the trades of every venue to its own window as well, and consolidates those
+	// of the consolidated venues in the window of their trading pair.
+	multiVenue   bool
+	consolidated map[string]bool
+
+	// adminMu serializes the changes of the admin API, across the network calls (un)subscribing the tunnel.
+	// mu guards the trading pairs subscribed to, which the admin API changes at runtime,
+	// and the removed ones whose trades still in flight are dropped. It is never held across a network call,
+	// so the pipeline doesn't wait for the exchange.
+	adminMu      sync.Mutex
+	mu           sync.RWMutex
+	tradingPairs []string
+	removed      map[string]bool
+
+	// stdout is where the VWAPs are printed, last at printedAt.
+	stdout    io.Writer
+	printedAt time.Time
+	// replayExpiredAt is the time of the recording the windows were last expired at, when replaying.
+	replayExpiredAt time.Time
+
+	// watchdog, when set, tells the stale trading pairs apart in the query API.
+	watchdog *tunnel.Watchdog
+	// latency keeps the latency histograms of every trading pair, except when replaying recordings, whose trades
+	// were received long before being processed.
+	latency *latency.Tracker
+}
+
+// ContextOption configures optional behaviours of a Context.
+type ContextOption func(s *Context)
+
+// WithWatchdog flags the VWAPs of the trading pairs the watchdog sees stale in the query API.
+// The watchdog is the one given to the receivers of the live feed.
+func WithWatchdog(watchdog *tunnel.Watchdog) ContextOption {
+	return func(s *Context) {
+		s.watchdog = watchdog
+	}
+}
+
+// WithMetrics exposes counters in the metrics endpoint instead of a set of its own, so that those of the live feed,
+// e.g. of its redundant legs, are exposed as well.
+func WithMetrics(counters *metrics.Counters) ContextOption {
+	return func(s *Context) {
+		s.metrics = counters
+	}
+}
+
+// WithRejections tears down the trading pairs the exchanges reject once added at runtime, e.g. an invalid product,
+// instead of stopping the feed. A rejected trading pair of the configuration still stops it, as on startup.
+// The rejections are those given to the receivers of the live feed.
+func WithRejections(rejections *tunnel.Rejections) ContextOption {
+	return func(s *Context) {
+		rejections.Handle(s.reject)
+	}
 }
 
 // NewContext instantiates new rte context object.
-func NewContext(tunnel tunnel.Tunnel, queue storage.Vwap, cfg *envConfig) *Context {
-	return &Context{
-		cfg:        cfg,
-		wsReceiver: tunnel,
-		queue:      queue,
+func NewContext(wsReceiver tunnel.Tunnel, queue storage.Vwap, cfg *envConfig, opts ...ContextOption) *Context {
+	parse := parseData
+	if cfg.Arithmetic == ArithmeticDecimal {
+		parse = parseDecimalData
+	}
+
+	// Trades are backfilled from the Coinbase REST API, whose trade IDs are those of the Coinbase feed only.
+	// A handoff shedding trades leaves gaps on purpose: backfilling them would fetch the trades shed again, on the
+	// consumer the handoff shields.
+	// A replay and a synthetic feed stay offline: the trades of today would not fill the gaps of a recording, nor
+	// the real trades those of generated ones.
+	var tradesClient backfiller
+	offline := cfg.ReplayPath != "" || cfg.Mode == ModeSynthetic
+	sheds := cfg.HandoffCapacity > 0 && handoff.Policy(cfg.HandoffPolicy) != handoff.Block
+	if contains(cfg.Exchanges, ExchangeCoinbase) && !offline && !sheds {
+		tradesClient = tunnel.NewTradesClient(cfg.BackfillURL, cfg.BackfillTimeout)
+	}
+
+	s := &Context{
+		cfg:          cfg,
+		wsReceiver:   wsReceiver,
+		queue:        queue,
+		parse:        parse,
+		metrics:      metrics.NewCounters(),
+		onGap:        logGap,
+		stdout:       os.Stdout,
+		backfiller:   tradesClient,
+		multiVenue:   len(cfg.Exchanges) > 1,
+		consolidated: consolidatedVenues(cfg),
+		tradingPairs: append([]string(nil), cfg.TradingPairs...),
+		removed:      make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.sequencer = sequence.NewTracker(s.metrics)
+	if cfg.ReplayPath == "" {
+		s.latency = latency.NewTracker()
+	}
+
+	// The admin API subscribes to trading pairs and tears down VWAP states: it is never served without a token.
+	var serverOpts []server.Option
+	if cfg.AdminToken != "" {
+		serverOpts = append(serverOpts, server.WithAdmin(s, cfg.AdminToken))
+	}
+	if s.watchdog != nil {
+		serverOpts = append(serverOpts, server.WithStaleness(s.watchdog))
+	}
+	if s.latency != nil {
+		serverOpts = append(serverOpts, server.WithLatency(s.latency))
+	}
+	s.server = server.NewServer(cfg.Port, cfg.HTTPTimeout, queue, s.metrics, serverOpts...)
+	return s
+}
+
+// consolidatedVenues returns the venues whose trades are consolidated in the VWAP of their trading pair.
+func consolidatedVenues(cfg *envConfig) map[string]bool {
+	venues := make(map[string]bool, len(cfg.Exchanges))
+	for _, venue := range cfg.Exchanges {
+		if (len(cfg.VenuesInclude) == 0 || contains(cfg.VenuesInclude, venue)) && !contains(cfg.VenuesExclude, venue) {
+			venues[venue] = true
+		}
+	}
+	return venues
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
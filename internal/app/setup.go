@@ -3,6 +3,8 @@ package app
 import (
 	"fmt"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/reactivejson/vwap-engine/internal/handoff"
+	"github.com/reactivejson/vwap-engine/internal/tunnel"
 	"log"
 )
 
@@ -20,7 +22,69 @@ func SetupEnvConfig() *envConfig {
 
 	cfg := &envConfig{}
 	if err := envconfig.Process("", cfg); err != nil {
-		fmt.Errorf("could not parse config: %w", err)
+		log.Fatalf("could not parse config: %v", err)
+	}
+	if err := parseEnvConfig(cfg); err != nil {
+		log.Fatal(err)
 	}
 	return cfg
 }
+
+// parseEnvConfig validates the config, and parses the settings kept as strings, e.g. SymbolMap into Symbols.
+func parseEnvConfig(cfg *envConfig) error {
+	if cfg.Arithmetic != ArithmeticFloat && cfg.Arithmetic != ArithmeticDecimal {
+		return fmt.Errorf("invalid ARITHMETIC %q: must be %s or %s", cfg.Arithmetic, ArithmeticFloat, ArithmeticDecimal)
+	}
+	if len(cfg.Exchanges) == 0 {
+		return fmt.Errorf("invalid EXCHANGE: at least one of %s, %s or %s is required", ExchangeCoinbase, ExchangeBinance, ExchangeKraken)
+	}
+	for i, exchange := range cfg.Exchanges {
+		switch exchange {
+		case ExchangeCoinbase, ExchangeBinance, ExchangeKraken:
+		default:
+			return fmt.Errorf("invalid EXCHANGE %q: must be %s, %s or %s", exchange, ExchangeCoinbase, ExchangeBinance, ExchangeKraken)
+		}
+		if contains(cfg.Exchanges[:i], exchange) {
+			return fmt.Errorf("invalid EXCHANGE: %s is listed twice", exchange)
+		}
+	}
+	for _, venue := range append(append([]string(nil), cfg.VenuesInclude...), cfg.VenuesExclude...) {
+		if !contains(cfg.Exchanges, venue) {
+			return fmt.Errorf("invalid VENUES_INCLUDE or VENUES_EXCLUDE venue %q: must be one of EXCHANGE %s", venue, cfg.Exchanges)
+		}
+	}
+	symbols, err := tunnel.ParseSymbolMap(cfg.SymbolMap)
+	if err != nil {
+		return fmt.Errorf("invalid SYMBOL_MAP: %v", err)
+	}
+	cfg.Symbols = symbols
+	switch handoff.Policy(cfg.HandoffPolicy) {
+	case handoff.Block, handoff.DropOldest, handoff.DropNewest, handoff.Coalesce:
+	default:
+		return fmt.Errorf("invalid HANDOFF_POLICY %q: must be %s, %s, %s or %s", cfg.HandoffPolicy,
+			handoff.Block, handoff.DropOldest, handoff.DropNewest, handoff.Coalesce)
+	}
+	if cfg.RedundantLegs == 0 {
+		return fmt.Errorf("invalid REDUNDANT_LEGS: at least 1 leg is required")
+	}
+	legURLs, err := tunnel.ParseLegURLs(cfg.RedundantURLs)
+	if err != nil {
+		return fmt.Errorf("invalid REDUNDANT_URLS: %v", err)
+	}
+	for venue, urls := range legURLs {
+		if !contains(cfg.Exchanges, venue) {
+			return fmt.Errorf("invalid REDUNDANT_URLS venue %q: must be one of EXCHANGE %s", venue, cfg.Exchanges)
+		}
+		if uint(len(urls)) >= cfg.RedundantLegs {
+			return fmt.Errorf("invalid REDUNDANT_URLS: %d endpoints for the %d redundant legs of %s", len(urls), cfg.RedundantLegs-1, venue)
+		}
+	}
+	cfg.LegURLs = legURLs
+	if cfg.WindowDuration > 0 && cfg.ExpiryInterval <= 0 {
+		return fmt.Errorf("invalid EXPIRY_INTERVAL %v: must be positive with WINDOW_DURATION", cfg.ExpiryInterval)
+	}
+	if cfg.Mode != ModeLive && cfg.Mode != ModeBacktest && cfg.Mode != ModeSynthetic {
+		return fmt.Errorf("invalid MODE %q: must be %s, %s or %s", cfg.Mode, ModeLive, ModeBacktest, ModeSynthetic)
+	}
+	return nil
+}
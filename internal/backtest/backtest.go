@@ -0,0 +1,74 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"io"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Parser converts a trade to a data point, e.g. with float64 or exact decimal arithmetic.
+type Parser func(trade *models.Trade) (storage.Point, error)
+
+// Run pushes the trades of the input files, in order, onto the VWAP storage and writes the VWAP of the trading pair
+// of every trade to the series. Time windows are driven by the trades' time, so a run is deterministic.
+// It returns the number of trades pushed.
+func Run(ctx context.Context, inputs []string, queue storage.Vwap, parse Parser, series *SeriesWriter) (uint64, error) {
+	var pushed uint64
+	for _, input := range inputs {
+		n, err := run(ctx, input, queue, parse, series)
+		pushed += n
+		if err != nil {
+			return pushed, err
+		}
+	}
+	return pushed, nil
+}
+
+func run(ctx context.Context, input string, queue storage.Vwap, parse Parser, series *SeriesWriter) (uint64, error) {
+	reader, err := NewTradeReader(input)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var pushed uint64
+	for {
+		if err = ctx.Err(); err != nil {
+			return pushed, err
+		}
+
+		trade, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return pushed, nil
+		}
+		if err != nil {
+			return pushed, err
+		}
+
+		dataPoint, err := parse(trade)
+		if err != nil {
+			return pushed, fmt.Errorf("error parsing trade %d of %s: %w", trade.TradeID, trade.ProductID, err)
+		}
+		queue.Push(dataPoint)
+		pushed++
+
+		err = series.Write(Sample{
+			Time:      dataPoint.GetTime(),
+			ProductID: trade.ProductID,
+			TradeID:   trade.TradeID,
+			Vwap:      queue.GetVwap(trade.ProductID),
+			Count:     queue.Size(trade.ProductID),
+		})
+		if err != nil {
+			return pushed, err
+		}
+	}
+}
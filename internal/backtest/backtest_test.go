@@ -0,0 +1,112 @@
+package backtest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/backtest"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// parse converts a trade to a float64 data point.
+func parse(trade *models.Trade) (storage.Point, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+	quantity, err := strconv.ParseFloat(trade.Size, 64)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewTimedPoint(price, quantity, trade.ProductID, trade.Time), nil
+}
+
+func TestRun_ShouldWriteVwapSeries(t *testing.T) {
+	t.Parallel()
+
+	day1 := writeFile(t, "day1.csv", `product_id,time,price,size,side,trade_id
+BTC-USD,2022-05-21T09:12:00Z,1,1,buy,1
+ETH-USD,2022-05-21T09:12:01Z,10,1,buy,1
+BTC-USD,2022-05-21T09:12:02Z,2,2,sell,2
+`)
+	day2 := writeFile(t, "day2.ndjson", `{"product_id":"BTC-USD","time":"2022-05-22T09:12:00Z","price":"3","size":"3","side":"buy","trade_id":3}
+`)
+
+	vwapQueue, err := queue.NewVwapQueue(2)
+	require.NoError(t, err)
+
+	output := filepath.Join(t.TempDir(), "vwap.csv")
+	series, err := backtest.NewSeriesWriter(output)
+	require.NoError(t, err)
+
+	pushed, err := backtest.Run(context.Background(), []string{day1, day2}, vwapQueue, parse, series)
+	require.NoError(t, err)
+	require.NoError(t, series.Close())
+	assert.Equal(t, uint64(4), pushed)
+
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, `time,product_id,trade_id,vwap,count
+2022-05-21T09:12:00Z,BTC-USD,1,1,1
+2022-05-21T09:12:01Z,ETH-USD,1,10,1
+2022-05-21T09:12:02Z,BTC-USD,2,1.6666666666666667,2
+2022-05-22T09:12:00Z,BTC-USD,3,2.6,2
+`, string(content))
+}
+
+func TestRun_ShouldWriteNDJSONSeries(t *testing.T) {
+	t.Parallel()
+
+	input := writeFile(t, "trades.csv", `product_id,time,price,size,side,trade_id
+BTC-USD,2022-05-21T09:12:00Z,1,1,buy,1
+`)
+
+	vwapQueue, err := queue.NewVwapQueue(2)
+	require.NoError(t, err)
+
+	output := filepath.Join(t.TempDir(), "vwap.ndjson")
+	series, err := backtest.NewSeriesWriter(output)
+	require.NoError(t, err)
+
+	_, err = backtest.Run(context.Background(), []string{input}, vwapQueue, parse, series)
+	require.NoError(t, err)
+	require.NoError(t, series.Close())
+
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"time":"2022-05-21T09:12:00Z","product_id":"BTC-USD","trade_id":1,"vwap":1,"count":1}`,
+		strings.TrimSpace(string(content)))
+}
+
+func TestRun_WithInvalidTrade_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	input := writeFile(t, "trades.csv", `product_id,time,price,size,side,trade_id
+BTC-USD,2022-05-21T09:12:00Z,1,1,buy,1
+BTC-USD,2022-05-21T09:12:01Z,x,1,buy,2
+`)
+
+	vwapQueue, err := queue.NewVwapQueue(2)
+	require.NoError(t, err)
+
+	series, err := backtest.NewSeriesWriter(filepath.Join(t.TempDir(), "vwap.csv"))
+	require.NoError(t, err)
+	defer series.Close()
+
+	pushed, err := backtest.Run(context.Background(), []string{input}, vwapQueue, parse, series)
+	require.Error(t, err)
+	assert.Equal(t, uint64(1), pushed)
+}
@@ -0,0 +1,161 @@
+package backtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// maxTradeLineSize is the longest line of an NDJSON trades file.
+const maxTradeLineSize = 1 << 20
+
+// csvColumns are the columns of a CSV trades file, in any order, named by its header. An optional venue column
+// may follow.
+/**
+Sample:
+product_id,time,price,size,side,trade_id
+BTC-USD,2022-05-21T09:12:04.862866Z,29303.35,0.0000299,sell,341498074
+*/
+var csvColumns = []string{"product_id", "time", "price", "size", "side", "trade_id"}
+
+// TradeReader reads historical trades from a CSV or NDJSON file, depending on its extension.
+// NDJSON lines use the fields of models.Trade (product_id, time, price, size, side, trade_id and optionally venue).
+type TradeReader struct {
+	file *os.File
+	next func() (*models.Trade, error)
+	line int
+}
+
+// NewTradeReader opens a trades file: .csv files are read as CSV with a header, .ndjson, .jsonl and .json files as NDJSON.
+func NewTradeReader(path string) (*TradeReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening trades file: %w", err)
+	}
+
+	r := &TradeReader{file: file}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = r.readCSV()
+	case ".ndjson", ".jsonl", ".json":
+		r.readNDJSON()
+	default:
+		err = fmt.Errorf("unsupported trades file %s: expecting .csv or .ndjson", path)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Next returns the next trade of the file, or io.EOF at its end.
+func (r *TradeReader) Next() (*models.Trade, error) {
+	trade, err := r.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%s line %d: %w", r.file.Name(), r.line, err)
+	}
+
+	if trade.ProductID == "" || trade.Time.IsZero() {
+		return nil, fmt.Errorf("%s line %d: product_id and time are required", r.file.Name(), r.line)
+	}
+	return trade, nil
+}
+
+// Close closes the trades file.
+func (r *TradeReader) Close() error {
+	return r.file.Close()
+}
+
+func (r *TradeReader) readNDJSON() {
+	scanner := bufio.NewScanner(r.file)
+	scanner.Buffer(make([]byte, 64*1024), maxTradeLineSize)
+
+	r.next = func() (*models.Trade, error) {
+		for scanner.Scan() {
+			r.line++
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+
+			trade := &models.Trade{}
+			if err := json.Unmarshal(scanner.Bytes(), trade); err != nil {
+				return nil, err
+			}
+			return trade, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+func (r *TradeReader) readCSV() error {
+	reader := csv.NewReader(bufio.NewReader(r.file))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("error reading header of %s: %w", r.file.Name(), err)
+	}
+	r.line++
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("invalid header of %s: missing column %s", r.file.Name(), name)
+		}
+	}
+
+	r.next = func() (*models.Trade, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+
+		tradeID, err := strconv.Atoi(record[index["trade_id"]])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing trade_id: %w", err)
+		}
+
+		trade := &models.Trade{
+			ProductID: record[index["product_id"]],
+			Price:     record[index["price"]],
+			Size:      record[index["size"]],
+			Side:      models.Side(record[index["side"]]),
+			TradeID:   tradeID,
+		}
+		if i, ok := index["venue"]; ok {
+			trade.Venue = record[i]
+		}
+		if value := record[index["time"]]; value != "" {
+			if trade.Time, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return nil, fmt.Errorf("error parsing time: %w", err)
+			}
+		}
+		return trade, nil
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package backtest_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/backtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// writeFile writes a trades file named name in a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// readAll returns every trade of a trades file.
+func readAll(t *testing.T, path string) []*models.Trade {
+	reader, err := backtest.NewTradeReader(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	var trades []*models.Trade
+	for {
+		trade, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return trades
+		}
+		require.NoError(t, err)
+		trades = append(trades, trade)
+	}
+}
+
+func TestTradeReader_CSV(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, "trades.csv", `trade_id,side,size,price,time,product_id,venue
+1,buy,0.5,100.5,2022-05-21T09:12:04.862866Z,BTC-USD,coinbase
+2,sell,2,10,2022-05-21T09:12:05Z,ETH-USD,kraken
+`)
+
+	trades := readAll(t, path)
+	require.Len(t, trades, 2)
+	assert.Equal(t, &models.Trade{
+		Venue:     "coinbase",
+		ProductID: "BTC-USD",
+		Time:      time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC),
+		Price:     "100.5",
+		Size:      "0.5",
+		Side:      models.SideBuy,
+		TradeID:   1,
+	}, trades[0])
+	assert.Equal(t, "ETH-USD", trades[1].ProductID)
+}
+
+func TestTradeReader_NDJSON(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, "trades.ndjson", `{"product_id":"BTC-USD","time":"2022-05-21T09:12:04Z","price":"100","size":"1","side":"buy","trade_id":1}
+
+{"product_id":"BTC-USD","time":"2022-05-21T09:12:05Z","price":"101","size":"2","side":"sell","trade_id":2}
+`)
+
+	trades := readAll(t, path)
+	require.Len(t, trades, 2)
+	assert.Equal(t, "101", trades[1].Price)
+	assert.Equal(t, 2, trades[1].TradeID)
+	assert.Equal(t, models.SideSell, trades[1].Side)
+}
+
+func TestTradeReader_WithInvalidFile_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"unsupported extension", "trades.txt", ""},
+		{"missing CSV column", "trades.csv", "product_id,time,price,size,side\n"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := backtest.NewTradeReader(writeFile(t, tt.file, tt.content))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestTradeReader_Next_WithInvalidTrade_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		line    string
+	}{
+		{"invalid trade_id", "trades.csv", "product_id,time,price,size,side,trade_id\nBTC-USD,2022-05-21T09:12:04Z,1,1,buy,x\n", "line 2"},
+		{"missing time", "trades.csv", "product_id,time,price,size,side,trade_id\nBTC-USD,,1,1,buy,1\n", "line 2"},
+		{"invalid time", "trades.csv", "product_id,time,price,size,side,trade_id\nBTC-USD,yesterday,1,1,buy,1\n", "line 2"},
+		{"invalid JSON", "trades.ndjson", "{\"product_id\":\n", "line 1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := backtest.NewTradeReader(writeFile(t, tt.file, tt.content))
+			require.NoError(t, err)
+			defer reader.Close()
+
+			_, err = reader.Next()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.line)
+		})
+	}
+}
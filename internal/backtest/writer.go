@@ -0,0 +1,109 @@
+package backtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Sample is a point of the VWAP time series: the VWAP of a trading pair right after a trade was pushed.
+type Sample struct {
+	Time      time.Time `json:"time"`
+	ProductID string    `json:"product_id"`
+	TradeID   int       `json:"trade_id"`
+	Vwap      float64   `json:"vwap"`
+	// Count is the number of data points in the window of the trading pair.
+	Count uint `json:"count"`
+}
+
+// seriesHeader is the header of a CSV VWAP time series.
+var seriesHeader = []string{"time", "product_id", "trade_id", "vwap", "count"}
+
+// SeriesWriter writes a VWAP time series to a CSV or NDJSON file, depending on its extension.
+type SeriesWriter struct {
+	file   *os.File
+	buffer *bufio.Writer
+	write  func(sample Sample) error
+	flush  func() error
+}
+
+// NewSeriesWriter creates the output file: .csv files are written as CSV with a header, other files as NDJSON.
+func NewSeriesWriter(path string) (*SeriesWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating VWAP series file: %w", err)
+	}
+
+	w := &SeriesWriter{file: file, buffer: bufio.NewWriter(file)}
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		err = w.writeCSV()
+	} else {
+		w.writeNDJSON()
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends a sample to the series.
+func (w *SeriesWriter) Write(sample Sample) error {
+	if err := w.write(sample); err != nil {
+		return fmt.Errorf("error writing VWAP series: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the output file.
+func (w *SeriesWriter) Close() error {
+	if err := w.flush(); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("error flushing VWAP series: %w", err)
+	}
+	return w.file.Close()
+}
+
+func (w *SeriesWriter) writeNDJSON() {
+	encoder := json.NewEncoder(w.buffer)
+	w.write = func(sample Sample) error {
+		return encoder.Encode(sample)
+	}
+	w.flush = w.buffer.Flush
+}
+
+func (w *SeriesWriter) writeCSV() error {
+	writer := csv.NewWriter(w.buffer)
+	if err := writer.Write(seriesHeader); err != nil {
+		return fmt.Errorf("error writing VWAP series header: %w", err)
+	}
+
+	w.write = func(sample Sample) error {
+		return writer.Write([]string{
+			sample.Time.UTC().Format(time.RFC3339Nano),
+			sample.ProductID,
+			strconv.Itoa(sample.TradeID),
+			strconv.FormatFloat(sample.Vwap, 'f', -1, 64),
+			strconv.FormatUint(uint64(sample.Count), 10),
+		})
+	}
+	w.flush = func() error {
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		return w.buffer.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package handoff
+
+import (
+	"context"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Policy is what a full Buffer does with an incoming trade.
+type Policy string
+
+const (
+	// Block waits for the consumer to make room, slowing the producer down as an unbuffered channel does.
+	Block Policy = "block"
+	// DropOldest discards the oldest trade waiting to make room for the incoming one.
+	DropOldest Policy = "drop-oldest"
+	// DropNewest discards the incoming trade.
+	DropNewest Policy = "drop-newest"
+	// Coalesce replaces the latest trade waiting of the same venue and product with the incoming one, keeping only
+	// the latest trades of the busiest products, and discards the oldest trade waiting when none is of its product.
+	Coalesce Policy = "coalesce"
+)
+
+// Buffer is a bounded handoff of trades between a producer, e.g. a tunnel.Tunnel, and a consumer, so a slow consumer
+// doesn't stall the producer until the exchange disconnects it, up to capacity trades. Once full, incoming trades
+// are handled according to the Policy.
+// Trades discarded are counted per venue and product in handoff_dropped_total, or handoff_coalesced_total. The
+// number of trades waiting is the handoff_depth gauge, and its high-water mark handoff_depth_max.
+type Buffer struct {
+	capacity int
+	policy   Policy
+	counters *metrics.Counters
+
+	mu sync.Mutex
+	// trades is a ring of count trades waiting from head. taken is the number of trades taken out of it so far, so
+	// that the trade at position i of the ring was put at taken+i.
+	trades []*models.Trade
+	head   int
+	count  int
+	taken  uint64
+	// latest holds, by venue and product, the position the latest trade waiting was put at, with Coalesce.
+	latest map[pairKey]uint64
+	// ready and room notify the consumer that a trade was put, and the producer that a trade was taken.
+	ready chan struct{}
+	room  chan struct{}
+	// closed is set once the producer is done.
+	closed    bool
+	highWater int
+}
+
+// New creates a Buffer of at most capacity trades, handling the incoming ones with policy once full.
+func New(capacity int, policy Policy, counters *metrics.Counters) (*Buffer, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("invalid handoff capacity %d: must be positive", capacity)
+	}
+	switch policy {
+	case Block, DropOldest, DropNewest, Coalesce:
+	default:
+		return nil, fmt.Errorf("invalid handoff policy %q: must be %s, %s, %s or %s", policy, Block, DropOldest, DropNewest, Coalesce)
+	}
+
+	return &Buffer{
+		capacity: capacity,
+		policy:   policy,
+		counters: counters,
+		trades:   make([]*models.Trade, capacity),
+		latest:   make(map[pairKey]uint64),
+		ready:    make(chan struct{}, 1),
+		room:     make(chan struct{}, 1),
+	}, nil
+}
+
+// Forward passes the trades of in to the returned channel through the Buffer. The returned channel is closed once in
+// is closed and the trades waiting are taken, or once ctx is done and in is closed.
+// in is always read until closed, so its producer never blocks once ctx is done.
+func (b *Buffer) Forward(ctx context.Context, in <-chan *models.Trade) <-chan *models.Trade {
+	out := make(chan *models.Trade)
+	produced := make(chan struct{})
+
+	go func() {
+		defer close(produced)
+		defer b.close()
+		for trade := range in {
+			if ctx.Err() == nil {
+				b.put(ctx, trade)
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		defer func() { <-produced }()
+		for {
+			trade, ok := b.take(ctx)
+			if !ok {
+				return
+			}
+			select {
+			case out <- trade:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// put adds a trade, handling it with the policy when the Buffer is full. With Block, it waits for room until ctx is
+// done.
+func (b *Buffer) put(ctx context.Context, trade *models.Trade) {
+	b.mu.Lock()
+	for b.count == b.capacity {
+		switch b.policy {
+		case DropNewest:
+			b.mu.Unlock()
+			b.drop(trade)
+			return
+
+		case DropOldest:
+			b.drop(b.pop())
+
+		case Coalesce:
+			if b.replace(trade) {
+				b.mu.Unlock()
+				b.counters.Add(metrics.Name("handoff_coalesced_total", "venue", trade.Venue, "product_id", trade.ProductID), 1)
+				return
+			}
+			b.drop(b.pop())
+
+		default:
+			b.mu.Unlock()
+			b.counters.Add("handoff_blocked_total", 1)
+			select {
+			case <-b.room:
+			case <-ctx.Done():
+				return
+			}
+			b.mu.Lock()
+		}
+	}
+
+	position := b.taken + uint64(b.count)
+	b.trades[(b.head+b.count)%b.capacity] = trade
+	b.count++
+	if b.policy == Coalesce {
+		b.latest[key(trade)] = position
+	}
+	// Gauges are set under b.mu, so that they follow the order of the puts and takes.
+	b.counters.Set("handoff_depth", uint64(b.count))
+	if b.count > b.highWater {
+		b.highWater = b.count
+		b.counters.Max("handoff_depth_max", uint64(b.count))
+	}
+	b.mu.Unlock()
+	notify(b.ready)
+}
+
+// replace replaces the latest trade waiting of the venue and product of trade, if any. b.mu must be held.
+func (b *Buffer) replace(trade *models.Trade) bool {
+	position, ok := b.latest[key(trade)]
+	if !ok {
+		return false
+	}
+	b.trades[(b.head+int(position-b.taken))%b.capacity] = trade
+	return true
+}
+
+// pop removes the oldest trade waiting. b.mu must be held and the Buffer not empty.
+func (b *Buffer) pop() *models.Trade {
+	trade := b.trades[b.head]
+	b.trades[b.head] = nil
+	if b.policy == Coalesce {
+		if position, ok := b.latest[key(trade)]; ok && position == b.taken {
+			delete(b.latest, key(trade))
+		}
+	}
+	b.head = (b.head + 1) % b.capacity
+	b.count--
+	b.taken++
+	return trade
+}
+
+// drop counts a trade discarded.
+func (b *Buffer) drop(trade *models.Trade) {
+	b.counters.Add(metrics.Name("handoff_dropped_total", "venue", trade.Venue, "product_id", trade.ProductID), 1)
+}
+
+// take removes the oldest trade waiting, waiting for one until the producer is done or ctx is done.
+func (b *Buffer) take(ctx context.Context) (*models.Trade, bool) {
+	for {
+		b.mu.Lock()
+		if b.count > 0 {
+			trade := b.pop()
+			b.counters.Set("handoff_depth", uint64(b.count))
+			b.mu.Unlock()
+			notify(b.room)
+			return trade, true
+		}
+		closed := b.closed
+		b.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+
+		select {
+		case <-b.ready:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// close marks the producer done, for the consumer to stop once the trades waiting are taken.
+func (b *Buffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	notify(b.ready)
+}
+
+// notify wakes up the goroutine waiting on a channel, if any, without blocking.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// pairKey identifies the trades of a product on a venue, without allocating.
+type pairKey struct {
+	venue     string
+	productID string
+}
+
+func key(trade *models.Trade) pairKey {
+	return pairKey{venue: trade.Venue, productID: trade.ProductID}
+}
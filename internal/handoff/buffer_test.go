@@ -0,0 +1,185 @@
+package handoff
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func trade(productID string, tradeID int) *models.Trade {
+	return &models.Trade{Venue: "coinbase", ProductID: productID, TradeID: tradeID}
+}
+
+// takeAll takes the trades waiting in a Buffer, as product ID and trade ID pairs.
+func takeAll(t *testing.T, b *Buffer) []string {
+	b.close()
+	var taken []string
+	for {
+		trade, ok := b.take(context.Background())
+		if !ok {
+			return taken
+		}
+		taken = append(taken, trade.ProductID+"/"+strconv.Itoa(trade.TradeID))
+	}
+}
+
+func TestBuffer_Put_WhenFull(t *testing.T) {
+	t.Parallel()
+
+	dropped := func(counters *metrics.Counters, productID string) uint64 {
+		return counters.Get(metrics.Name("handoff_dropped_total", "venue", "coinbase", "product_id", productID))
+	}
+
+	tests := []struct {
+		policy    Policy
+		expected  []string
+		dropped   map[string]uint64
+		coalesced uint64
+	}{
+		{policy: DropNewest, expected: []string{"BTC-USD/1", "ETH-USD/1", "BTC-USD/2"}, dropped: map[string]uint64{"BTC-USD": 2, "SOL-USD": 1}},
+		{policy: DropOldest, expected: []string{"BTC-USD/3", "SOL-USD/1", "BTC-USD/4"}, dropped: map[string]uint64{"BTC-USD": 2, "ETH-USD": 1}},
+		// BTC-USD/3 replaces BTC-USD/2, SOL-USD/1 drops the oldest, BTC-USD/1, and BTC-USD/4 replaces BTC-USD/3.
+		{policy: Coalesce, expected: []string{"ETH-USD/1", "BTC-USD/4", "SOL-USD/1"}, dropped: map[string]uint64{"BTC-USD": 1}, coalesced: 2},
+	}
+	for _, tt := range tests {
+		counters := metrics.NewCounters()
+		b, err := New(3, tt.policy, counters)
+		require.NoError(t, err)
+
+		for _, trade := range []*models.Trade{
+			trade("BTC-USD", 1), trade("ETH-USD", 1), trade("BTC-USD", 2),
+			trade("BTC-USD", 3), trade("SOL-USD", 1), trade("BTC-USD", 4),
+		} {
+			b.put(context.Background(), trade)
+		}
+
+		assert.Equal(t, tt.expected, takeAll(t, b), tt.policy)
+		for _, productID := range []string{"BTC-USD", "ETH-USD", "SOL-USD"} {
+			assert.Equal(t, tt.dropped[productID], dropped(counters, productID), "%s %s", tt.policy, productID)
+		}
+		assert.Equal(t, tt.coalesced, counters.Get(metrics.Name("handoff_coalesced_total", "venue", "coinbase", "product_id", "BTC-USD")), tt.policy)
+		assert.Equal(t, uint64(3), counters.Get("handoff_depth_max"), tt.policy)
+		assert.Equal(t, uint64(0), counters.Get("handoff_depth"), tt.policy)
+	}
+}
+
+func TestBuffer_Forward_WithSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	const sent = 500
+	for _, policy := range []Policy{DropOldest, DropNewest, Coalesce} {
+		counters := metrics.NewCounters()
+		b, err := New(50, policy, counters)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		in := make(chan *models.Trade)
+		out := b.Forward(ctx, in)
+
+		// The producer, e.g. the websocket reader, isn't stalled by the consumer taking 1ms per trade.
+		start := time.Now()
+		go func() {
+			defer close(in)
+			for i := 1; i <= sent; i++ {
+				in <- trade("BTC-USD", i)
+			}
+		}()
+		received := 0
+		last := 0
+		for trade := range out {
+			if received == 0 {
+				assert.Less(t, time.Since(start), 250*time.Millisecond, "producer stalled with %s", policy)
+			}
+			// Trades keep their order, with gaps where they are discarded.
+			assert.Greater(t, trade.TradeID, last, policy)
+			last = trade.TradeID
+			received++
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+
+		discarded := counters.Get(metrics.Name("handoff_dropped_total", "venue", "coinbase", "product_id", "BTC-USD")) +
+			counters.Get(metrics.Name("handoff_coalesced_total", "venue", "coinbase", "product_id", "BTC-USD"))
+		assert.Positive(t, discarded, policy)
+		assert.Equal(t, sent, received+int(discarded), policy)
+		assert.Equal(t, uint64(50), counters.Get("handoff_depth_max"), policy)
+		if policy != DropNewest {
+			assert.Equal(t, sent, last, "the latest trade is kept with %s", policy)
+		}
+	}
+}
+
+func TestBuffer_Forward_WithBlock_ShouldDeliverEveryTrade(t *testing.T) {
+	t.Parallel()
+
+	counters := metrics.NewCounters()
+	b, err := New(10, Block, counters)
+	require.NoError(t, err)
+
+	in := make(chan *models.Trade)
+	out := b.Forward(context.Background(), in)
+	go func() {
+		defer close(in)
+		for i := 1; i <= 100; i++ {
+			in <- trade("BTC-USD", i)
+		}
+	}()
+
+	expected := 1
+	for trade := range out {
+		require.Equal(t, expected, trade.TradeID)
+		expected++
+		time.Sleep(100 * time.Microsecond)
+	}
+	assert.Equal(t, 101, expected)
+	assert.Positive(t, counters.Get("handoff_blocked_total"))
+	assert.LessOrEqual(t, counters.Get("handoff_depth_max"), uint64(10))
+}
+
+func TestBuffer_Forward_ShouldStopOnCancel(t *testing.T) {
+	t.Parallel()
+
+	b, err := New(10, Block, metrics.NewCounters())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan *models.Trade)
+	out := b.Forward(ctx, in)
+	// The consumer is blocked sending the first trade, the producer waits for room for the 12th.
+	for i := 1; i <= 12; i++ {
+		in <- trade("BTC-USD", i)
+	}
+	cancel()
+
+	// The producer is still read until it closes its channel, and out is closed only then.
+	in <- trade("BTC-USD", 13)
+	select {
+	case _, ok := <-out:
+		// A trade taken before the cancellation may still be sent, but out stays open.
+		require.True(t, ok, "out closed before in")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(in)
+	for range out {
+	}
+}
+
+func TestNew_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(0, Block, metrics.NewCounters())
+	require.Error(t, err)
+	_, err = New(10, "drop-random", metrics.NewCounters())
+	require.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package latency
+
+import (
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Stage is a step of the pipeline whose latency is measured, from a timestamp of a trade to a later one.
+type Stage string
+
+const (
+	// ExchangeToReceive is the time from the trade on the exchange to its receipt by the engine, clock skew included.
+	ExchangeToReceive Stage = "exchange_to_receive"
+	// ReceiveToPush is the time from the receipt of the trade to the VWAP updated with it.
+	ReceiveToPush Stage = "receive_to_push"
+	// ReceiveToPublish is the time from the receipt of the trade to the updated VWAPs published.
+	ReceiveToPublish Stage = "receive_to_publish"
+)
+
+// stages are the stages measured, in pipeline order.
+var stages = []Stage{ExchangeToReceive, ReceiveToPush, ReceiveToPublish}
+
+const (
+	// minBound is the upper bound of the first bucket, each next one doubling it.
+	minBound = time.Microsecond
+	// bucketCount buckets reach 2^26µs, over a minute. Longer latencies fall in an overflow bucket.
+	bucketCount = 27
+)
+
+// Histogram counts latencies in buckets of exponentially growing bounds.
+type Histogram struct {
+	// counts holds the latencies of every bucket, the last one those over the last bound.
+	counts [bucketCount + 1]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// bound returns the upper bound of a bucket.
+func bound(bucket int) time.Duration {
+	return minBound << bucket
+}
+
+// observe counts a latency. Negative ones, e.g. from clock skew, are counted as 0.
+func (h *Histogram) observe(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	bucket := 0
+	for bucket < bucketCount && latency > bound(bucket) {
+		bucket++
+	}
+	h.counts[bucket]++
+	h.count++
+	h.sum += latency
+	if latency > h.max {
+		h.max = latency
+	}
+}
+
+// Quantile returns the upper bound of the bucket the q quantile falls in, the maximum when lower or in the overflow
+// bucket.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.count))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for bucket, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank {
+			if bucket == bucketCount || bound(bucket) > h.max {
+				return h.max
+			}
+			return bound(bucket)
+		}
+	}
+	return h.max
+}
+
+// model returns the histogram as the JSON payload of the query API.
+func (h *Histogram) model() models.LatencyHistogram {
+	histogram := models.LatencyHistogram{
+		Count: h.count,
+		P50Ms: milliseconds(h.Quantile(0.5)),
+		P90Ms: milliseconds(h.Quantile(0.9)),
+		P99Ms: milliseconds(h.Quantile(0.99)),
+		MaxMs: milliseconds(h.max),
+	}
+	if h.count > 0 {
+		histogram.MeanMs = milliseconds(h.sum / time.Duration(h.count))
+	}
+
+	// Buckets are cumulative, the empty ones left out.
+	var cumulative uint64
+	for bucket := 0; bucket < bucketCount && cumulative < h.count; bucket++ {
+		if h.counts[bucket] == 0 {
+			continue
+		}
+		cumulative += h.counts[bucket]
+		histogram.Buckets = append(histogram.Buckets, models.LatencyBucket{LeMs: milliseconds(bound(bucket)), Count: cumulative})
+	}
+	return histogram
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Tracker keeps the latency histograms of every stage of the pipeline, per trading pair. It is safe for concurrent use.
+type Tracker struct {
+	mu         sync.Mutex
+	histograms map[string]map[Stage]*Histogram
+}
+
+// NewTracker creates a Tracker without histogram.
+func NewTracker() *Tracker {
+	return &Tracker{histograms: make(map[string]map[Stage]*Histogram)}
+}
+
+// Observe counts the latencies of the stages of a trade of a trading pair, e.g. BTC-USD or BTC-USD@binance, between
+// the timestamps it was stamped with. Stages with a zero timestamp, e.g. the exchange time of venues without one,
+// are skipped.
+func (t *Tracker) Observe(tradingPair string, trade *models.Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	histograms, ok := t.histograms[tradingPair]
+	if !ok {
+		histograms = make(map[Stage]*Histogram, len(stages))
+		t.histograms[tradingPair] = histograms
+	}
+
+	observe := func(stage Stage, from, to time.Time) {
+		if from.IsZero() || to.IsZero() {
+			return
+		}
+		histogram, ok := histograms[stage]
+		if !ok {
+			histogram = &Histogram{}
+			histograms[stage] = histogram
+		}
+		histogram.observe(to.Sub(from))
+	}
+	observe(ExchangeToReceive, trade.Time, trade.ReceivedAt)
+	observe(ReceiveToPush, trade.ReceivedAt, trade.PushedAt)
+	observe(ReceiveToPublish, trade.ReceivedAt, trade.PublishedAt)
+}
+
+// Forget drops the histograms of a trading pair, e.g. once unsubscribed.
+func (t *Tracker) Forget(tradingPair string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.histograms, tradingPair)
+}
+
+// Latencies returns the histograms of every trading pair, sorted by trading pair.
+func (t *Tracker) Latencies() []models.Latency {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	latencies := make([]models.Latency, 0, len(t.histograms))
+	for tradingPair, histograms := range t.histograms {
+		latency := models.Latency{ProductID: tradingPair, Stages: make(map[string]models.LatencyHistogram, len(histograms))}
+		for stage, histogram := range histograms {
+			latency.Stages[string(stage)] = histogram.model()
+		}
+		latencies = append(latencies, latency)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i].ProductID < latencies[j].ProductID })
+	return latencies
+}
+
+// String summarizes the histograms of every trading pair on a line each, for the logs, e.g.
+// BTC-USD exchange_to_receive count=1200 p50=32.768ms p99=131.072ms max=140.2ms.
+func (t *Tracker) String() string {
+	var lines []string
+	for _, latency := range t.Latencies() {
+		line := latency.ProductID
+		for _, stage := range stages {
+			histogram, ok := latency.Stages[string(stage)]
+			if !ok {
+				continue
+			}
+			line += fmt.Sprintf(" %s count=%d p50=%vms p99=%vms max=%vms",
+				stage, histogram.Count, histogram.P50Ms, histogram.P99Ms, histogram.MaxMs)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestHistogram_Quantile(t *testing.T) {
+	t.Parallel()
+
+	var h Histogram
+	assert.Equal(t, time.Duration(0), h.Quantile(0.5))
+
+	// 90 latencies of 3ms, 9 of 40ms and 1 of 2 minutes, past the last bucket.
+	for i := 0; i < 90; i++ {
+		h.observe(3 * time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.observe(40 * time.Millisecond)
+	}
+	h.observe(2 * time.Minute)
+	h.observe(-time.Millisecond)
+
+	assert.Equal(t, 4096*time.Microsecond, h.Quantile(0.5))
+	assert.Equal(t, 65536*time.Microsecond, h.Quantile(0.95))
+	assert.Equal(t, 2*time.Minute, h.Quantile(1))
+	assert.Equal(t, uint64(1), h.counts[0])
+
+	model := h.model()
+	assert.Equal(t, uint64(101), model.Count)
+	assert.Equal(t, 4.096, model.P50Ms)
+	assert.Equal(t, 65.536, model.P99Ms)
+	assert.Equal(t, 120000.0, model.MaxMs)
+	require.NotEmpty(t, model.Buckets)
+	assert.Equal(t, models.LatencyBucket{LeMs: 0.001, Count: 1}, model.Buckets[0])
+	assert.Equal(t, models.LatencyBucket{LeMs: 4.096, Count: 91}, model.Buckets[1])
+	// The last bucket holds all but the overflow.
+	assert.Equal(t, uint64(100), model.Buckets[len(model.Buckets)-1].Count)
+}
+
+func TestTracker_Observe(t *testing.T) {
+	t.Parallel()
+
+	tracker := NewTracker()
+	at := time.Date(2022, 5, 21, 9, 12, 4, 0, time.UTC)
+	tracker.Observe("BTC-USD", &models.Trade{
+		Time:        at,
+		ReceivedAt:  at.Add(30 * time.Millisecond),
+		PushedAt:    at.Add(31 * time.Millisecond),
+		PublishedAt: at.Add(33 * time.Millisecond),
+	})
+	// Without exchange time, only the stages of the engine are measured.
+	tracker.Observe("ETH-USD@kraken", &models.Trade{ReceivedAt: at, PushedAt: at.Add(time.Millisecond)})
+
+	latencies := tracker.Latencies()
+	require.Len(t, latencies, 2)
+	assert.Equal(t, "BTC-USD", latencies[0].ProductID)
+	// The quantile is the maximum when lower than the bound of its bucket.
+	assert.Equal(t, 30.0, latencies[0].Stages[string(ExchangeToReceive)].P50Ms)
+	assert.Equal(t, 1.0, latencies[0].Stages[string(ReceiveToPush)].MaxMs)
+	assert.Equal(t, 3.0, latencies[0].Stages[string(ReceiveToPublish)].MaxMs)
+	assert.Equal(t, "ETH-USD@kraken", latencies[1].ProductID)
+	assert.Len(t, latencies[1].Stages, 1)
+
+	assert.Contains(t, tracker.String(), "BTC-USD exchange_to_receive count=1 p50=30ms")
+
+	tracker.Forget("BTC-USD")
+	assert.Len(t, tracker.Latencies(), 1)
+}
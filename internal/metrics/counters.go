@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Counters is a set of named counters and gauges, safe for concurrent use.
+// Names follow the Prometheus convention, see Name, so they can be scraped as is.
+type Counters struct {
+	mu     sync.RWMutex
+	values map[string]uint64
+}
+
+// NewCounters creates an empty set of counters.
+func NewCounters() *Counters {
+	return &Counters{values: make(map[string]uint64)}
+}
+
+// Name builds a Prometheus metric name with its label pairs, e.g. Name("gaps_total", "product_id", "BTC-USD")
+// returns gaps_total{product_id="BTC-USD"}.
+func Name(name string, labels ...string) string {
+	if len(labels) < 2 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Add increments a counter by delta.
+func (c *Counters) Add(name string, delta uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[name] += delta
+}
+
+// Max raises a gauge to value if it is higher than the current one, e.g. for high-water marks.
+func (c *Counters) Max(name string, value uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if value > c.values[name] {
+		c.values[name] = value
+	}
+}
+
+// Set sets a gauge to value.
+func (c *Counters) Set(name string, value uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[name] = value
+}
+
+// Get returns the value of a counter, 0 when it was never incremented.
+func (c *Counters) Get(name string) uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.values[name]
+}
+
+// Snapshot returns a copy of all the counters.
+func (c *Counters) Snapshot() map[string]uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(map[string]uint64, len(c.values))
+	for k, v := range c.values {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// WriteTo writes all the counters sorted by name in the Prometheus text format.
+func (c *Counters) WriteTo(w io.Writer) (int64, error) {
+	snapshot := c.Snapshot()
+
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var written int64
+	for _, name := range names {
+		n, err := fmt.Fprintf(w, "%s %d\n", name, snapshot[name])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestName(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "gaps_total", Name("gaps_total"))
+	require.Equal(t, `gaps_total{product_id="BTC-USD"}`, Name("gaps_total", "product_id", "BTC-USD"))
+	require.Equal(t, `trades_total{leg="1",venue="coinbase"}`, Name("trades_total", "leg", "1", "venue", "coinbase"))
+}
+
+func TestCounters(t *testing.T) {
+	t.Parallel()
+
+	c := NewCounters()
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			defer wg.Done()
+			c.Add("a_total", 2)
+			c.Max("b_high_water", uint64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	c.Set("c", 7)
+
+	require.Equal(t, uint64(20), c.Get("a_total"))
+	require.Equal(t, uint64(9), c.Get("b_high_water"))
+	require.Equal(t, map[string]uint64{"a_total": 20, "b_high_water": 9, "c": 7}, c.Snapshot())
+
+	var sb strings.Builder
+	_, err := c.WriteTo(&sb)
+	require.NoError(t, err)
+	require.Equal(t, "a_total 20\nb_high_water 9\nc 7\n", sb.String())
+}
@@ -0,0 +1,102 @@
+package sequence
+
+import (
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Result is the outcome of observing a trade ID.
+type Result int
+
+const (
+	// InOrder is a trade following the last one of its product, or its first trade.
+	InOrder Result = iota
+	// Duplicate is a trade already seen (or older than the last one), e.g. replayed after a reconnect.
+	Duplicate
+	// Gap is a trade after one or more missing trades.
+	Gap
+)
+
+// GapEvent describes trades missing from a product's feed: the VWAP of the product may be incomplete.
+type GapEvent struct {
+	ProductID string `json:"product_id"`
+	// From is the first missing trade ID.
+	From int `json:"from"`
+	// To is the last missing trade ID.
+	To int `json:"to"`
+	// DetectedAt is when the gap was detected.
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Missing returns the number of missing trades.
+func (g GapEvent) Missing() int {
+	return g.To - g.From + 1
+}
+
+// Tracker tracks the last trade ID per product to detect gaps and duplicates in the feed.
+type Tracker struct {
+	mu      sync.Mutex
+	last    map[string]int
+	metrics *metrics.Counters
+}
+
+// NewTracker creates a Tracker counting gaps, missing trades and duplicates per product in counters.
+func NewTracker(counters *metrics.Counters) *Tracker {
+	return &Tracker{
+		last:    make(map[string]int),
+		metrics: counters,
+	}
+}
+
+// Observe records the trade ID of a product and reports whether it is in order, a duplicate or after a gap.
+// The GapEvent is only set for a Gap. Duplicates leave the last trade ID unchanged.
+func (t *Tracker) Observe(productID string, tradeID int) (Result, *GapEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.last[productID]
+	switch {
+	case !ok || tradeID == last+1:
+		t.last[productID] = tradeID
+		return InOrder, nil
+
+	case tradeID <= last:
+		t.metrics.Add(metrics.Name("sequence_duplicates_total", "product_id", productID), 1)
+		return Duplicate, nil
+
+	default:
+		t.last[productID] = tradeID
+		gap := &GapEvent{
+			ProductID:  productID,
+			From:       last + 1,
+			To:         tradeID - 1,
+			DetectedAt: time.Now(),
+		}
+		t.metrics.Add(metrics.Name("sequence_gaps_total", "product_id", productID), 1)
+		t.metrics.Add(metrics.Name("sequence_missing_trades_total", "product_id", productID), uint64(gap.Missing()))
+		return Gap, gap
+	}
+}
+
+// Last returns the last trade ID seen for a product.
+func (t *Tracker) Last(productID string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.last[productID]
+	return last, ok
+}
+
+// Forget drops the last trade ID of a product, e.g. once it is unsubscribed, so its next trade starts a new sequence.
+func (t *Tracker) Forget(productID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.last, productID)
+}
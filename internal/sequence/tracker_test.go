@@ -0,0 +1,69 @@
+package sequence
+
+import (
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestTracker_Observe(t *testing.T) {
+	t.Parallel()
+
+	counters := metrics.NewCounters()
+	tracker := NewTracker(counters)
+
+	result, gap := tracker.Observe("BTC-USD", 10)
+	require.Equal(t, InOrder, result)
+	require.Nil(t, gap)
+
+	result, _ = tracker.Observe("BTC-USD", 11)
+	require.Equal(t, InOrder, result)
+
+	// Products are tracked independently.
+	result, _ = tracker.Observe("ETH-USD", 3)
+	require.Equal(t, InOrder, result)
+
+	result, gap = tracker.Observe("BTC-USD", 15)
+	require.Equal(t, Gap, result)
+	require.Equal(t, "BTC-USD", gap.ProductID)
+	require.Equal(t, 12, gap.From)
+	require.Equal(t, 14, gap.To)
+	require.Equal(t, 3, gap.Missing())
+	require.False(t, gap.DetectedAt.IsZero())
+
+	for _, tradeID := range []int{15, 13} {
+		result, gap = tracker.Observe("BTC-USD", tradeID)
+		require.Equal(t, Duplicate, result)
+		require.Nil(t, gap)
+	}
+
+	last, ok := tracker.Last("BTC-USD")
+	require.True(t, ok)
+	require.Equal(t, 15, last)
+
+	require.Equal(t, uint64(1), counters.Get(`sequence_gaps_total{product_id="BTC-USD"}`))
+	require.Equal(t, uint64(3), counters.Get(`sequence_missing_trades_total{product_id="BTC-USD"}`))
+	require.Equal(t, uint64(2), counters.Get(`sequence_duplicates_total{product_id="BTC-USD"}`))
+	require.Zero(t, counters.Get(`sequence_gaps_total{product_id="ETH-USD"}`))
+}
+
+func TestTracker_Forget_ShouldStartANewSequence(t *testing.T) {
+	t.Parallel()
+
+	tracker := NewTracker(metrics.NewCounters())
+	tracker.Observe("BTC-USD", 10)
+	tracker.Forget("BTC-USD")
+
+	_, ok := tracker.Last("BTC-USD")
+	require.False(t, ok)
+
+	result, gap := tracker.Observe("BTC-USD", 100)
+	require.Equal(t, InOrder, result)
+	require.Nil(t, gap)
+}
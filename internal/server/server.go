@@ -0,0 +1,341 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	vwapPath       = "/vwap"
+	metricsPath    = "/metrics"
+	adminPairsPath = "/admin/pairs"
+	latencyPath    = "/latency"
+)
+
+// ErrUnknownTradingPair is returned by an Admin removing a trading pair that isn't subscribed.
+var ErrUnknownTradingPair = errors.New("unknown trading pair")
+
+// tradingPairPattern matches the trading pairs the admin API subscribes to: a base and a quote asset, e.g. BTC-USD.
+var tradingPairPattern = regexp.MustCompile(`^[A-Z0-9]{2,10}-[A-Z0-9]{2,10}$`)
+
+// Admin adds and removes the trading pairs of the live feed at runtime.
+type Admin interface {
+	// TradingPairs returns the subscribed trading pairs.
+	TradingPairs() []string
+	// AddTradingPair subscribes to a trading pair, doing nothing if it is subscribed already.
+	AddTradingPair(tradingPair string) error
+	// RemoveTradingPair unsubscribes from a trading pair and tears down its VWAP state.
+	RemoveTradingPair(tradingPair string) error
+}
+
+// Staleness tells apart the trading pairs whose feed is frozen, so that their VWAP isn't trusted.
+type Staleness interface {
+	// Stale reports whether the feed of a trading pair is frozen on a venue, or on all its venues when venue is empty.
+	Stale(tradingPair, venue string) bool
+}
+
+// Latencies keeps the latency histograms of the pipeline stages of every trading pair.
+type Latencies interface {
+	// Latencies returns the latency histograms of every trading pair, sorted by trading pair.
+	Latencies() []models.Latency
+}
+
+// Option configures optional endpoints of the Server.
+type Option func(s *Server, mux *http.ServeMux)
+
+// WithAdmin serves the admin API managing the trading pairs on /admin/pairs.
+// Admin requests must be authorized with an "Authorization: Bearer <token>" header: with an empty token, all of them
+// are rejected.
+func WithAdmin(admin Admin, token string) Option {
+	return func(s *Server, mux *http.ServeMux) {
+		s.admin = admin
+		s.adminToken = token
+		mux.HandleFunc(adminPairsPath, s.authorize(s.getTradingPairs))
+		mux.HandleFunc(adminPairsPath+"/", s.authorize(s.updateTradingPair))
+	}
+}
+
+// WithStaleness flags the VWAPs of the trading pairs whose feed is frozen as stale.
+func WithStaleness(staleness Staleness) Option {
+	return func(s *Server, _ *http.ServeMux) {
+		s.staleness = staleness
+	}
+}
+
+// WithLatency serves the latency histograms of every trading pair on /latency.
+func WithLatency(latencies Latencies) Option {
+	return func(s *Server, mux *http.ServeMux) {
+		s.latencies = latencies
+		mux.HandleFunc(latencyPath, s.getLatencies)
+	}
+}
+
+// Server is the HTTP query API for the current VWAPs.
+// Handlers only read a storage.Snapshot, never the live VWAP maps.
+type Server struct {
+	httpServer *http.Server
+	listener   net.Listener
+	queue      storage.Vwap
+	metrics    *metrics.Counters
+	admin      Admin
+	adminToken string
+	// staleness, when set, flags the stale VWAPs.
+	staleness Staleness
+	latencies Latencies
+}
+
+// NewServer creates the HTTP query API listening on port, with timeout applied to reads and writes.
+// The counters are exposed on /metrics in the Prometheus text format.
+func NewServer(port uint, timeout time.Duration, queue storage.Vwap, counters *metrics.Counters, opts ...Option) *Server {
+	s := &Server{queue: queue, metrics: counters}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(vwapPath, s.getVwaps)
+	mux.HandleFunc(vwapPath+"/", s.getVwap)
+	mux.HandleFunc(metricsPath, s.getMetrics)
+	for _, opt := range opts {
+		opt(s, mux)
+	}
+
+	s.httpServer = &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      mux,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+	return s
+}
+
+// Handler returns the HTTP handler of the query API.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// Addr returns the address the query API listens on, once started.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.httpServer.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Start listens on the configured port and serves the query API in the background.
+// The server is shut down gracefully once ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+
+	s.listener = listener
+	log.Printf("HTTP query API listening on %s", listener.Addr())
+
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP query API error: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP query API shutdown error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// getVwaps handles GET /vwap, returning the VWAPs of all trading pairs sorted by product ID.
+func (s *Server) getVwaps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	pairs := s.toModels(s.queue.Snapshot())
+
+	vwaps := make([]models.Vwap, 0, len(pairs))
+	for _, vwap := range pairs {
+		vwaps = append(vwaps, *vwap)
+	}
+	sort.Slice(vwaps, func(i, j int) bool { return vwaps[i].ProductID < vwaps[j].ProductID })
+
+	writeJSON(w, http.StatusOK, vwaps)
+}
+
+// getVwap handles GET /vwap/{pair}, returning the VWAP of a trading pair.
+func (s *Server) getVwap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	tradingPair := strings.TrimPrefix(r.URL.Path, vwapPath+"/")
+	if tradingPair == "" || strings.Contains(tradingPair, "/") {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("invalid trading pair %q", tradingPair))
+		return
+	}
+
+	vwap, ok := s.toModels(s.queue.Snapshot())[tradingPair]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no VWAP for trading pair %s", tradingPair))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, vwap)
+}
+
+// getMetrics handles GET /metrics, returning the counters in the Prometheus text format.
+func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := s.metrics.WriteTo(w); err != nil {
+		log.Printf("error writing HTTP response: %v", err)
+	}
+}
+
+// getLatencies handles GET /latency, returning the latency histograms of every trading pair sorted by trading pair.
+func (s *Server) getLatencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.latencies.Latencies())
+}
+
+// getTradingPairs handles GET /admin/pairs, returning the subscribed trading pairs.
+func (s *Server) getTradingPairs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.TradingPairs{TradingPairs: s.admin.TradingPairs()})
+}
+
+// updateTradingPair handles PUT /admin/pairs/{pair}, subscribing to a trading pair,
+// and DELETE /admin/pairs/{pair}, unsubscribing from it. Both return the subscribed trading pairs.
+// A trading pair is validated before subscribing to it, so that a typo isn't sent to the exchanges.
+func (s *Server) updateTradingPair(w http.ResponseWriter, r *http.Request) {
+	tradingPair := strings.TrimPrefix(r.URL.Path, adminPairsPath+"/")
+	if tradingPair == "" || strings.ContainsAny(tradingPair, "/"+storage.VenueSeparator) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid trading pair %q", tradingPair))
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		if !tradingPairPattern.MatchString(tradingPair) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid trading pair %q, e.g. BTC-USD", tradingPair))
+			return
+		}
+		err = s.admin.AddTradingPair(tradingPair)
+	case http.MethodDelete:
+		err = s.admin.RemoveTradingPair(tradingPair)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrUnknownTradingPair):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		// The exchange couldn't be (un)subscribed from.
+		writeError(w, http.StatusBadGateway, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, models.TradingPairs{TradingPairs: s.admin.TradingPairs()})
+	}
+}
+
+// authorize rejects the admin requests without the admin token, all of them when it is empty.
+func (s *Server) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// toModels groups the windows of a snapshot by trading pair: the consolidated VWAP of every trading pair,
+// with the VWAPs of its venues sorted by venue, flagged stale when their feed is frozen.
+func (s *Server) toModels(snapshot storage.Snapshot) map[string]*models.Vwap {
+	vwaps := make(map[string]*models.Vwap, len(snapshot.Pairs))
+	vwapOf := func(tradingPair string) *models.Vwap {
+		vwap, ok := vwaps[tradingPair]
+		if !ok {
+			vwap = &models.Vwap{ProductID: tradingPair}
+			vwaps[tradingPair] = vwap
+		}
+		return vwap
+	}
+
+	for key, pair := range snapshot.Pairs {
+		tradingPair, venue := storage.SplitKey(key)
+		vwap := vwapOf(tradingPair)
+		stale := s.staleness != nil && s.staleness.Stale(tradingPair, venue)
+		if venue == "" {
+			vwap.Vwap = pair.Vwap
+			vwap.CumulativeQuantity = pair.CumulativeQuantity
+			vwap.Count = pair.Count
+			vwap.UpdatedAt = pair.UpdatedAt
+			vwap.Stale = stale
+			continue
+		}
+		vwap.Venues = append(vwap.Venues, models.VenueVwap{
+			Venue:              venue,
+			Vwap:               pair.Vwap,
+			CumulativeQuantity: pair.CumulativeQuantity,
+			Count:              pair.Count,
+			UpdatedAt:          pair.UpdatedAt,
+			Stale:              stale,
+		})
+	}
+
+	for _, vwap := range vwaps {
+		sort.Slice(vwap.Venues, func(i, j int) bool { return vwap.Venues[i].Venue < vwap.Venues[j].Venue })
+	}
+	return vwaps
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("error writing HTTP response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, models.ErrorResponse{Error: message})
+}
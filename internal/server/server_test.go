@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/queue"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func newTestServer(t *testing.T) *Server {
+	vwapQueue, err := queue.NewVwapQueue(3)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewPoint(1, 1, "TradingPair1"))
+	vwapQueue.Push(storage.NewPoint(3, 3, "TradingPair1"))
+	vwapQueue.Push(storage.NewPoint(2, 2, "TradingPair2"))
+
+	counters := metrics.NewCounters()
+	counters.Add(metrics.Name("sequence_gaps_total", "product_id", "TradingPair1"), 2)
+
+	return NewServer(0, time.Second, vwapQueue, counters)
+}
+
+func TestServer_GetVwaps(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	newTestServer(t).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var vwaps []models.Vwap
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&vwaps))
+	require.Len(t, vwaps, 2)
+	require.Equal(t, "TradingPair1", vwaps[0].ProductID)
+	require.Equal(t, 2.5, vwaps[0].Vwap)
+	require.Equal(t, 4.0, vwaps[0].CumulativeQuantity)
+	require.Equal(t, uint(2), vwaps[0].Count)
+	require.False(t, vwaps[0].UpdatedAt.IsZero())
+	require.Equal(t, "TradingPair2", vwaps[1].ProductID)
+}
+
+func TestServer_GetVwap_ShouldNestVenues(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(3)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewPoint(1, 1, storage.VenueKey("BTC-USD", "coinbase")))
+	vwapQueue.Push(storage.NewPoint(3, 1, storage.VenueKey("BTC-USD", "binance")))
+	vwapQueue.Push(storage.NewPoint(1, 1, "BTC-USD"))
+	vwapQueue.Push(storage.NewPoint(3, 1, "BTC-USD"))
+	// A trading pair only traded on excluded venues has no consolidated VWAP.
+	vwapQueue.Push(storage.NewPoint(5, 1, storage.VenueKey("ETH-USD", "kraken")))
+
+	s := NewServer(0, time.Second, vwapQueue, metrics.NewCounters())
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap/BTC-USD", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var vwap models.Vwap
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&vwap))
+	require.Equal(t, "BTC-USD", vwap.ProductID)
+	require.Equal(t, 2.0, vwap.Vwap)
+	require.Len(t, vwap.Venues, 2)
+	require.Equal(t, "binance", vwap.Venues[0].Venue)
+	require.Equal(t, 3.0, vwap.Venues[0].Vwap)
+	require.Equal(t, "coinbase", vwap.Venues[1].Venue)
+	require.Equal(t, 1.0, vwap.Venues[1].Vwap)
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var vwaps []models.Vwap
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&vwaps))
+	require.Len(t, vwaps, 2)
+	require.Equal(t, "ETH-USD", vwaps[1].ProductID)
+	require.Zero(t, vwaps[1].Count)
+	require.Len(t, vwaps[1].Venues, 1)
+	require.Equal(t, "kraken", vwaps[1].Venues[0].Venue)
+}
+
+// fakeStaleness sees the feed of binance frozen.
+type fakeStaleness struct{}
+
+func (fakeStaleness) Stale(_, venue string) bool {
+	return venue == "binance"
+}
+
+func TestServer_GetVwap_WithStaleness_ShouldFlagStaleVwaps(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(3)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewPoint(1, 1, storage.VenueKey("BTC-USD", "coinbase")))
+	vwapQueue.Push(storage.NewPoint(3, 1, storage.VenueKey("BTC-USD", "binance")))
+	vwapQueue.Push(storage.NewPoint(2, 1, "BTC-USD"))
+
+	s := NewServer(0, time.Second, vwapQueue, metrics.NewCounters(), WithStaleness(fakeStaleness{}))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vwap/BTC-USD", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var vwap models.Vwap
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&vwap))
+	require.False(t, vwap.Stale)
+	require.Len(t, vwap.Venues, 2)
+	require.Equal(t, "binance", vwap.Venues[0].Venue)
+	require.True(t, vwap.Venues[0].Stale)
+	require.False(t, vwap.Venues[1].Stale)
+}
+
+// fakeLatencies has the latencies of a single trading pair.
+type fakeLatencies struct{}
+
+func (fakeLatencies) Latencies() []models.Latency {
+	return []models.Latency{{
+		ProductID: "BTC-USD",
+		Stages: map[string]models.LatencyHistogram{
+			"receive_to_push": {Count: 2, MaxMs: 0.5, Buckets: []models.LatencyBucket{{LeMs: 0.512, Count: 2}}},
+		},
+	}}
+}
+
+func TestServer_GetLatencies(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(3)
+	require.NoError(t, err)
+	s := NewServer(0, time.Second, vwapQueue, metrics.NewCounters(), WithLatency(fakeLatencies{}))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/latency", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var latencies []models.Latency
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&latencies))
+	require.Equal(t, fakeLatencies{}.Latencies(), latencies)
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/latency", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// Without latencies, the endpoint isn't served.
+	rec = httptest.NewRecorder()
+	newTestServer(t).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/latency", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_GetVwap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"existing trading pair", http.MethodGet, "/vwap/TradingPair2", http.StatusOK},
+		{"unknown trading pair", http.MethodGet, "/vwap/TradingPair3", http.StatusNotFound},
+		{"missing trading pair", http.MethodGet, "/vwap/", http.StatusNotFound},
+		{"invalid method", http.MethodPost, "/vwap/TradingPair2", http.StatusMethodNotAllowed},
+	}
+
+	s := newTestServer(t)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			require.Equal(t, tt.wantStatus, rec.Code)
+
+			if tt.wantStatus == http.StatusOK {
+				var vwap models.Vwap
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&vwap))
+				require.Equal(t, models.Vwap{
+					ProductID:          "TradingPair2",
+					Vwap:               2,
+					CumulativeQuantity: 2,
+					Count:              1,
+					UpdatedAt:          vwap.UpdatedAt,
+				}, vwap)
+			} else {
+				var errResponse models.ErrorResponse
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&errResponse))
+				require.NotEmpty(t, errResponse.Error)
+			}
+		})
+	}
+}
+
+func TestServer_GetMetrics(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	newTestServer(t).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "sequence_gaps_total{product_id=\"TradingPair1\"} 2\n", rec.Body.String())
+}
+
+// fakeAdmin manages trading pairs in memory, failing to subscribe to FAIL-USD.
+type fakeAdmin struct {
+	tradingPairs []string
+}
+
+func (f *fakeAdmin) TradingPairs() []string {
+	return f.tradingPairs
+}
+
+func (f *fakeAdmin) AddTradingPair(tradingPair string) error {
+	if tradingPair == "FAIL-USD" {
+		return errors.New("exchange unavailable")
+	}
+	f.tradingPairs = append(f.tradingPairs, tradingPair)
+	return nil
+}
+
+func (f *fakeAdmin) RemoveTradingPair(tradingPair string) error {
+	for i, subscribed := range f.tradingPairs {
+		if subscribed == tradingPair {
+			f.tradingPairs = append(f.tradingPairs[:i], f.tradingPairs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownTradingPair, tradingPair)
+}
+
+func TestServer_Admin(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(3)
+	require.NoError(t, err)
+	s := NewServer(0, time.Second, vwapQueue, metrics.NewCounters(),
+		WithAdmin(&fakeAdmin{tradingPairs: []string{"BTC-USD"}}, "secret"))
+
+	// Requests run in order, against the same admin.
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		token            string
+		wantStatus       int
+		wantTradingPairs []string
+	}{
+		{"list trading pairs", http.MethodGet, "/admin/pairs", "secret", http.StatusOK, []string{"BTC-USD"}},
+		{"missing token", http.MethodGet, "/admin/pairs", "", http.StatusUnauthorized, nil},
+		{"invalid token", http.MethodPut, "/admin/pairs/ETH-USD", "guess", http.StatusUnauthorized, nil},
+		{"add trading pair", http.MethodPut, "/admin/pairs/ETH-USD", "secret", http.StatusOK, []string{"BTC-USD", "ETH-USD"}},
+		{"remove trading pair", http.MethodDelete, "/admin/pairs/BTC-USD", "secret", http.StatusOK, []string{"ETH-USD"}},
+		{"remove unknown trading pair", http.MethodDelete, "/admin/pairs/BTC-USD", "secret", http.StatusNotFound, nil},
+		{"exchange failure", http.MethodPut, "/admin/pairs/FAIL-USD", "secret", http.StatusBadGateway, nil},
+		{"venue window", http.MethodPut, "/admin/pairs/BTC-USD@binance", "secret", http.StatusBadRequest, nil},
+		{"lowercase trading pair", http.MethodPut, "/admin/pairs/btc-usd", "secret", http.StatusBadRequest, nil},
+		{"trading pair without quote", http.MethodPut, "/admin/pairs/BTCUSD", "secret", http.StatusBadRequest, nil},
+		{"invalid method", http.MethodPost, "/admin/pairs/BTC-USD", "secret", http.StatusMethodNotAllowed, nil},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+
+		require.Equal(t, tt.wantStatus, rec.Code, tt.name)
+		if tt.wantTradingPairs != nil {
+			var tradingPairs models.TradingPairs
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&tradingPairs))
+			require.Equal(t, tt.wantTradingPairs, tradingPairs.TradingPairs, tt.name)
+		}
+	}
+}
+
+func TestServer_Admin_WithoutToken_ShouldRejectAll(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := queue.NewVwapQueue(3)
+	require.NoError(t, err)
+	s := NewServer(0, time.Second, vwapQueue, metrics.NewCounters(), WithAdmin(&fakeAdmin{}, ""))
+
+	for _, authorization := range []string{"", "Bearer ", "Bearer secret"} {
+		req := httptest.NewRequest(http.MethodPut, "/admin/pairs/ETH-USD", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code, authorization)
+	}
+}
+
+func TestServer_Start_ShouldShutdownOnCancel(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.httpServer.Addr = "127.0.0.1:0"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, s.Start(ctx))
+
+	url := fmt.Sprintf("http://%s/vwap", s.Addr())
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		response, err := http.Get(url)
+		if err == nil {
+			_ = response.Body.Close()
+		}
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
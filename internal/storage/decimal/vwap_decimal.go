@@ -0,0 +1,284 @@
+package decimal
+
+import (
+	"container/list"
+	"errors"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// entry is a data point with its exact values, stamped with the time used to evict it from the window.
+type entry struct {
+	point storage.Point
+	pq    *big.Rat
+	q     *big.Rat
+	at    time.Time
+}
+
+// vwapDecimal represents a doubly linked list as a queue of DataPoints per trading pair, computed with exact decimals.
+// CumulativeQuantity and CumulativePriceQuantity are arbitrary-precision rationals: subtracting an evicted data point
+// removes exactly what was added, so the window sums never drift whatever the number of trades.
+// The window is bounded by a number of data points (Limit), a duration (Window), or both.
+// With a Window, data points arriving out of order, e.g. backfilled, are inserted by time, and those already out of
+// the window are skipped.
+type vwapDecimal struct {
+	mu sync.RWMutex
+	//DataPoints is a list of entries ordered by time with a Window, by arrival otherwise, one per TradingPair.
+	DataPoints              map[string]*list.List
+	CumulativePriceQuantity map[string]*big.Rat  // Equation = Sum(Price*Quantity), Sum of Price * Quantity for each TradingPair for each window
+	CumulativeQuantity      map[string]*big.Rat  // Equation = Sum(Quantity), Sum of Quantities for every TradingPair for each window
+	VWAP                    map[string]float64   //Equation: VWAP = Sum(Price*Quantity) / Sum(Quantity) Volume Weighted Average Price is calculated for every TradingPair for each window
+	UpdatedAt               map[string]time.Time // last time a data point was pushed or evicted for each TradingPair
+	// Limit sets the number of data points used to calculate the VWAP of each TradingPair, 0 for no limit.
+	Limit uint
+	// Window sets the duration of trades used to calculate the VWAP of each TradingPair, 0 for no limit.
+	Window time.Duration
+	// now is the clock used to stamp data points without an exchange time.
+	now func() time.Time
+	// epoch is incremented on every change, to version snapshots.
+	epoch uint64
+}
+
+// NewVwapDecimal creates a new exact VWAP queue bounded by maxSize data points and/or a window duration.
+// Points implementing storage.ExactPoint are used as is, other points are converted from their float64 values.
+func NewVwapDecimal(maxSize uint, window time.Duration) (storage.Vwap, error) {
+	if maxSize == 0 && window <= 0 {
+		return nil, errors.New("invalid decimal VWAP window: a size or a positive duration is required")
+	}
+
+	return &vwapDecimal{
+		DataPoints:              make(map[string]*list.List),
+		Limit:                   maxSize,
+		Window:                  window,
+		CumulativePriceQuantity: make(map[string]*big.Rat),
+		CumulativeQuantity:      make(map[string]*big.Rat),
+		VWAP:                    make(map[string]float64),
+		UpdatedAt:               make(map[string]time.Time),
+		now:                     time.Now,
+	}, nil
+}
+
+// Size returns the length of the queue of a trading pair.
+func (l *vwapDecimal) Size(tradingPair string) uint {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if dataPoints, ok := l.DataPoints[tradingPair]; ok {
+		return uint(dataPoints.Len())
+	}
+	return 0
+}
+
+// GetDataPoints returns the data points of a trading pair, oldest first.
+func (l *vwapDecimal) GetDataPoints(tradingPair string) any {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	dataPoints, ok := l.DataPoints[tradingPair]
+	if !ok {
+		return []storage.Point{}
+	}
+
+	points := make([]storage.Point, 0, dataPoints.Len())
+	for it := dataPoints.Front(); it != nil; it = it.Next() {
+		points = append(points, it.Value.(*entry).point)
+	}
+	return points
+}
+
+// GetVwap returns the VWAP for a  trading pair.
+func (l *vwapDecimal) GetVwap(tradingPair string) float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.VWAP[tradingPair]
+}
+
+// GetVwaps returns a copy of the VWAPs for trading pairs.
+func (l *vwapDecimal) GetVwaps() map[string]float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return storage.Copy(l.VWAP)
+}
+
+// Push pushes an item onto the queue of its trading pair, inserted by time with a Window.
+// When Limit is reached, will delete the first one, then evicts the data points older than Window compared to the
+// latest one. An item older than Window compared to the latest one is skipped.
+func (l *vwapDecimal) Push(d storage.Point) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := newEntry(d)
+	if e.at.IsZero() {
+		e.at = l.now()
+	}
+
+	dataPoints, ok := l.DataPoints[d.ProductID()]
+	if !ok {
+		dataPoints = list.New()
+		l.DataPoints[d.ProductID()] = dataPoints
+		l.CumulativePriceQuantity[d.ProductID()] = new(big.Rat)
+		l.CumulativeQuantity[d.ProductID()] = new(big.Rat)
+	}
+	if latest := dataPoints.Back(); l.Window > 0 && latest != nil && !e.at.After(latest.Value.(*entry).at.Add(-l.Window)) {
+		return
+	}
+
+	if l.Limit > 0 && uint(dataPoints.Len()) == l.Limit {
+		l.remove(d.ProductID())
+	}
+
+	l.computeVwap(e)
+	if l.Window <= 0 {
+		dataPoints.PushBack(e)
+		return
+	}
+	insert(dataPoints, e)
+	l.evict(d.ProductID(), dataPoints.Back().Value.(*entry).at.Add(-l.Window))
+}
+
+// insert inserts an entry after the last one stamped at or before it, so the list stays ordered by time.
+// Entries mostly arrive in order, so the list is walked from the back.
+func insert(dataPoints *list.List, e *entry) {
+	for it := dataPoints.Back(); it != nil; it = it.Prev() {
+		if !it.Value.(*entry).at.After(e.at) {
+			dataPoints.InsertAfter(e, it)
+			return
+		}
+	}
+	dataPoints.PushFront(e)
+}
+
+// Expire evicts the data points of every trading pair older than Window compared to now.
+// It is a no-op for windows bounded by a number of data points only.
+func (l *vwapDecimal) Expire(now time.Time) {
+	if l.Window <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.Window)
+	for tradingPair := range l.DataPoints {
+		l.evict(tradingPair, cutoff)
+	}
+}
+
+func newEntry(d storage.Point) *entry {
+	e := &entry{point: d, at: d.GetTime()}
+
+	if exact, ok := d.(storage.ExactPoint); ok {
+		e.pq = exact.ExactPQ()
+		e.q = exact.ExactQuantity()
+	} else {
+		p := new(big.Rat).SetFloat64(d.GetPrice())
+		e.q = new(big.Rat).SetFloat64(d.GetQuantity())
+		e.pq = p.Mul(p, e.q)
+	}
+	return e
+}
+
+// computeVwap is used to compute the VWAP for a given trading pair.
+func (l *vwapDecimal) computeVwap(e *entry) {
+	tradingPair := e.point.ProductID()
+	l.CumulativePriceQuantity[tradingPair].Add(l.CumulativePriceQuantity[tradingPair], e.pq)
+	l.CumulativeQuantity[tradingPair].Add(l.CumulativeQuantity[tradingPair], e.q)
+	l.updateVwap(tradingPair)
+}
+
+// remove removes 1st item from the queue of a trading pair and subtracts its exact values from the window sums.
+func (l *vwapDecimal) remove(tradingPair string) {
+	dataPoints := l.DataPoints[tradingPair]
+
+	it := dataPoints.Front()
+	e := it.Value.(*entry)
+	l.CumulativePriceQuantity[tradingPair].Sub(l.CumulativePriceQuantity[tradingPair], e.pq)
+	l.CumulativeQuantity[tradingPair].Sub(l.CumulativeQuantity[tradingPair], e.q)
+	l.updateVwap(tradingPair)
+
+	dataPoints.Remove(it)
+}
+
+// evict removes the data points of a trading pair stamped at or before cutoff.
+// Once a trading pair has no data point left, its VWAP is dropped rather than kept stale.
+func (l *vwapDecimal) evict(tradingPair string, cutoff time.Time) {
+	dataPoints := l.DataPoints[tradingPair]
+
+	for it := dataPoints.Front(); it != nil && !it.Value.(*entry).at.After(cutoff); it = dataPoints.Front() {
+		l.remove(tradingPair)
+	}
+
+	if dataPoints.Len() == 0 {
+		delete(l.DataPoints, tradingPair)
+		delete(l.CumulativePriceQuantity, tradingPair)
+		delete(l.CumulativeQuantity, tradingPair)
+		delete(l.VWAP, tradingPair)
+		delete(l.UpdatedAt, tradingPair)
+	}
+}
+
+// updateVwap converts the exact VWAP = Sum(Price*Quantity) / Sum(Quantity) to float64 for readers.
+func (l *vwapDecimal) updateVwap(tradingPair string) {
+	if l.CumulativeQuantity[tradingPair].Sign() != 0 {
+		vwap := new(big.Rat).Quo(l.CumulativePriceQuantity[tradingPair], l.CumulativeQuantity[tradingPair])
+		l.VWAP[tradingPair], _ = vwap.Float64()
+	}
+	l.UpdatedAt[tradingPair] = l.now()
+	l.epoch++
+}
+
+// Delete tears down the window and VWAP of a trading pair.
+func (l *vwapDecimal) Delete(tradingPair string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.DataPoints[tradingPair]; !ok {
+		return
+	}
+	delete(l.DataPoints, tradingPair)
+	delete(l.CumulativePriceQuantity, tradingPair)
+	delete(l.CumulativeQuantity, tradingPair)
+	delete(l.VWAP, tradingPair)
+	delete(l.UpdatedAt, tradingPair)
+	l.epoch++
+}
+
+// Snapshot returns a copy of the VWAP state of every trading pair, taken atomically.
+func (l *vwapDecimal) Snapshot() storage.Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := storage.Snapshot{
+		Epoch: l.epoch,
+		Pairs: make(map[string]storage.PairSnapshot, len(l.DataPoints)),
+	}
+	for tradingPair, dataPoints := range l.DataPoints {
+		cumulativePriceQuantity, _ := l.CumulativePriceQuantity[tradingPair].Float64()
+		cumulativeQuantity, _ := l.CumulativeQuantity[tradingPair].Float64()
+		snapshot.Pairs[tradingPair] = storage.PairSnapshot{
+			Vwap:                    l.VWAP[tradingPair],
+			CumulativePriceQuantity: cumulativePriceQuantity,
+			CumulativeQuantity:      cumulativeQuantity,
+			Count:                   uint(dataPoints.Len()),
+			UpdatedAt:               l.UpdatedAt[tradingPair],
+		}
+	}
+	return snapshot
+}
+
+func (l *vwapDecimal) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return strings.Join(storage.Format(l.VWAP), " | ")
+}
@@ -0,0 +1,171 @@
+package decimal_test
+
+import (
+	"fmt"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/decimal"
+	"github.com/reactivejson/vwap-engine/internal/storage/queue"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+var start = time.Date(2022, 5, 21, 9, 12, 0, 0, time.UTC)
+
+func decimalPoint(t *testing.T, price, quantity, tradingPair string, ts time.Time) storage.Point {
+	d, err := storage.NewDecimalPoint(price, quantity, tradingPair, ts)
+	require.NoError(t, err)
+	return d
+}
+
+// trades returns n trades whose prices and sizes can't be represented exactly by float64.
+func trades(n int) (prices, sizes []string) {
+	for i := 0; i < n; i++ {
+		prices = append(prices, fmt.Sprintf("29303.%02d", i%97))
+		sizes = append(sizes, fmt.Sprintf("0.%08d", 1+i*7919%99999989))
+	}
+	return
+}
+
+func TestNewVwapDecimal_WithInvalidWindow_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	_, err := decimal.NewVwapDecimal(0, 0)
+	require.Error(t, err)
+}
+
+func TestVwapDecimal_SumsReturnToExactlyZero_WhenAllPointsAreEvicted(t *testing.T) {
+	t.Parallel()
+
+	const limit = 5
+	vwapDecimal, err := decimal.NewVwapDecimal(limit, 0)
+	require.NoError(t, err)
+	vwapFloat, err := queue.NewVwapQueue(limit)
+	require.NoError(t, err)
+
+	prices, sizes := trades(10000)
+	for i := range prices {
+		d := decimalPoint(t, prices[i], sizes[i], "BTC-USD", time.Time{})
+		vwapDecimal.Push(d)
+		vwapFloat.Push(storage.NewPoint(d.GetPrice(), d.GetQuantity(), "BTC-USD"))
+	}
+
+	// Evict every trade with empty ones.
+	for i := 0; i < limit; i++ {
+		vwapDecimal.Push(decimalPoint(t, "29303.34", "0", "BTC-USD", time.Time{}))
+		vwapFloat.Push(storage.NewPoint(29303.34, 0, "BTC-USD"))
+	}
+
+	exact := vwapDecimal.Snapshot().Pairs["BTC-USD"]
+	require.Zero(t, exact.CumulativePriceQuantity)
+	require.Zero(t, exact.CumulativeQuantity)
+
+	// float64 rolling sums drift away from zero.
+	drifted := vwapFloat.Snapshot().Pairs["BTC-USD"]
+	require.NotZero(t, drifted.CumulativePriceQuantity)
+}
+
+func TestVwapDecimal_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := decimal.NewVwapDecimal(2, 0)
+	require.NoError(t, err)
+
+	vwapQueue.Push(decimalPoint(t, "1", "1", "TradingPair1", time.Time{}))
+	vwapQueue.Push(storage.NewPoint(2, 2, "TradingPair2"))
+	vwapQueue.Push(decimalPoint(t, "3", "3", "TradingPair1", time.Time{}))
+	require.Equal(t, 2.5, vwapQueue.GetVwap("TradingPair1"))
+	require.Equal(t, 2.0, vwapQueue.GetVwap("TradingPair2"))
+
+	vwapQueue.Push(decimalPoint(t, "0.1", "0.2", "TradingPair1", time.Time{}))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	// (3*3 + 0.1*0.2) / (3 + 0.2) = 9.02 / 3.2
+	require.Equal(t, 2.81875, vwapQueue.GetVwap("TradingPair1"))
+
+	snapshot := vwapQueue.Snapshot()
+	require.Equal(t, 9.02, snapshot.Pairs["TradingPair1"].CumulativePriceQuantity)
+	require.Equal(t, 3.2, snapshot.Pairs["TradingPair1"].CumulativeQuantity)
+	require.Equal(t, 2, len(vwapQueue.GetVwaps()))
+}
+
+func TestVwapDecimal_Expire_ShouldEvictAllPoints(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := decimal.NewVwapDecimal(0, time.Minute)
+	require.NoError(t, err)
+
+	prices, sizes := trades(100)
+	for i := range prices {
+		vwapQueue.Push(decimalPoint(t, prices[i], sizes[i], "BTC-USD", start.Add(time.Duration(i)*time.Second)))
+	}
+	require.Equal(t, 60, int(vwapQueue.Size("BTC-USD")))
+
+	vwapQueue.(storage.Expirer).Expire(start.Add(time.Hour))
+	require.Equal(t, 0, int(vwapQueue.Size("BTC-USD")))
+	require.Empty(t, vwapQueue.Snapshot().Pairs)
+}
+
+func TestVwapDecimal_Push_OutOfOrder_ShouldEvictByTime(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := decimal.NewVwapDecimal(0, time.Minute)
+	require.NoError(t, err)
+
+	vwapQueue.Push(decimalPoint(t, "1", "1", "BTC-USD", start.Add(50*time.Second)))
+	// Backfilled, older than the latest trade but still in the window.
+	vwapQueue.Push(decimalPoint(t, "2", "2", "BTC-USD", start.Add(10*time.Second)))
+	// Out of the window of the latest trade.
+	vwapQueue.Push(decimalPoint(t, "3", "3", "BTC-USD", start.Add(-20*time.Second)))
+	require.Equal(t, 2, int(vwapQueue.Size("BTC-USD")))
+	require.Equal(t, 5.0, vwapQueue.Snapshot().Pairs["BTC-USD"].CumulativePriceQuantity)
+
+	// The backfilled trade is the 1st one out of the window, although pushed last.
+	vwapQueue.Push(decimalPoint(t, "4", "4", "BTC-USD", start.Add(70*time.Second)))
+	require.Equal(t, 2, int(vwapQueue.Size("BTC-USD")))
+	require.Equal(t, 3.4, vwapQueue.GetVwap("BTC-USD"))
+}
+
+func TestVwapDecimal_ConcurrencyMangnt(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := decimal.NewVwapDecimal(3, 0)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			vwapQueue.Push(decimalPoint(t, "1.1", "2.2", "TradingPair1", time.Time{}))
+			_ = vwapQueue.Snapshot()
+			wg.Done()
+		}()
+	}
+
+	wg.Wait()
+	require.Equal(t, 3, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1.1, vwapQueue.GetVwap("TradingPair1"))
+}
+
+func TestNewDecimalPoint_WithInvalidDecimal_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	for _, invalid := range []string{"fail", "", ".", "1/3", "0x1p-2", "1e9999999", "-1", "+1", "1.2.3", " 1", "Inf"} {
+		_, err := storage.NewDecimalPoint(invalid, "1", "TradingPair1", time.Time{})
+		require.Error(t, err, invalid)
+
+		_, err = storage.NewDecimalPoint("1", invalid, "TradingPair1", time.Time{})
+		require.Error(t, err, invalid)
+	}
+
+	for _, valid := range []string{"29303.35000000", "0", "1.", ".5"} {
+		_, err := storage.NewDecimalPoint(valid, valid, "TradingPair1", time.Time{})
+		require.NoError(t, err, valid)
+	}
+}
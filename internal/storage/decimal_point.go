@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// ExactPoint is a Point whose price and quantity are exact decimals, so rolling window sums don't drift.
+type ExactPoint interface {
+	Point
+	//ExactPrice returns the exact Price of trading pair
+	ExactPrice() *big.Rat
+	//ExactQuantity returns the exact Quantity of trading pair
+	ExactQuantity() *big.Rat
+	//ExactPQ returns the exact Price * Quantity
+	ExactPQ() *big.Rat
+}
+
+//DecimalPoint provides the data required to calculate an exact VWAP for a specific pair from coinbase.
+//Price and Quantity are parsed from the decimal strings of the feed, without going through float64.
+type DecimalPoint struct {
+	//Price of trading pair
+	Price *big.Rat
+	//Quantity of trading pair
+	Quantity *big.Rat
+	//TradingPair is the coinbase product ID
+	TradingPair string
+	//Time is the exchange time of the trade
+	Time time.Time
+}
+
+// NewDecimalPoint parses price and quantity decimal strings, e.g. "29303.34", into an exact Point.
+// Only plain non-negative decimals are valid, see parseDecimal.
+func NewDecimalPoint(price, quantity, t string, ts time.Time) (Point, error) {
+	p, ok := parseDecimal(price)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal price %q", price)
+	}
+
+	q, ok := parseDecimal(quantity)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal quantity %q", quantity)
+	}
+
+	return &DecimalPoint{
+		Price:       p,
+		Quantity:    q,
+		TradingPair: t,
+		Time:        ts,
+	}, nil
+}
+
+// parseDecimal parses a plain non-negative decimal, digits with an optional single '.', e.g. "0.00029900".
+// The fractions, exponents, signs and hexadecimal floats big.Rat.SetString accepts are rejected: no exchange sends
+// them, an exponent such as 1e9999999 is costly to expand, and a negative quantity could zero the sum of quantities.
+func parseDecimal(s string) (*big.Rat, bool) {
+	digits, dots := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digits++
+		case s[i] == '.':
+			dots++
+		default:
+			return nil, false
+		}
+	}
+	if digits == 0 || dots > 1 {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+func (d *DecimalPoint) ComputePQ() float64 {
+	pq, _ := d.ExactPQ().Float64()
+	return pq
+}
+
+func (d *DecimalPoint) GetPrice() float64 {
+	p, _ := d.Price.Float64()
+	return p
+}
+
+func (d *DecimalPoint) GetQuantity() float64 {
+	q, _ := d.Quantity.Float64()
+	return q
+}
+
+func (d *DecimalPoint) ProductID() string {
+	return d.TradingPair
+}
+
+func (d *DecimalPoint) GetTime() time.Time {
+	return d.Time
+}
+
+func (d *DecimalPoint) ExactPrice() *big.Rat {
+	return new(big.Rat).Set(d.Price)
+}
+
+func (d *DecimalPoint) ExactQuantity() *big.Rat {
+	return new(big.Rat).Set(d.Quantity)
+}
+
+func (d *DecimalPoint) ExactPQ() *big.Rat {
+	return new(big.Rat).Mul(d.Price, d.Quantity)
+}
@@ -0,0 +1,23 @@
+package storage
+
+import "strings"
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// VenueSeparator separates the trading pair from the venue in the key of a per-venue window.
+const VenueSeparator = "@"
+
+// VenueKey returns the key of the per-venue window of a trading pair, e.g. BTC-USD@binance.
+// Data points pushed with a trading pair as product ID feed the consolidated window of all venues instead.
+func VenueKey(tradingPair, venue string) string {
+	return tradingPair + VenueSeparator + venue
+}
+
+// SplitKey returns the trading pair and venue of a window key, with an empty venue for a consolidated window.
+func SplitKey(key string) (tradingPair, venue string) {
+	tradingPair, venue, _ = strings.Cut(key, VenueSeparator)
+	return tradingPair, venue
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"sync"
+	"time"
 )
 
 /**
@@ -13,64 +14,95 @@ import (
  * © 2022
  */
 
-// vwapLinkedList represents a doubly linked list as a queue of DataPoints.
+// vwapLinkedList represents a doubly linked list as a queue of DataPoints per trading pair.
 // Manipulation with Linked List is faster than Array List because it uses a doubly linked list, so no bit shifting is required in memory.
 //Every time a new data point is added to the queue and saved for each trading pair, the VWAP computation is updated accordingly.
 // For performance, and to avoid exponential complexity, the computation is cached for VWAP, CumulativeQuantity,
 //and CumulativePriceQuantity for existing data points and updated with new entries.
 type vwapLinkedList struct {
-	mu sync.Mutex
+	mu sync.RWMutex
 	//The arrays allocated in memory are never returned. Therefor A dynamic doubly Linked list structure, is better to be used for a long-living queue.
-	//DataPoints  is fast circular fifo data structure (aka., Linked list queue) with a specific limit.
-	DataPoints              *list.List         //doubly linked list as a queue
-	CumulativePriceQuantity map[string]float64 // Equation = Sum(Price*Quantity), Sum of Price * Quantity for each TradingPair for each window
-	CumulativeQuantity      map[string]float64 // Equation = Sum(Quantity), Sum of Quantities for every TradingPair for each window
-	VWAP                    map[string]float64 //Equation: VWAP = Sum(Price*Quantity) / Sum(Quantity) Volume Weighted Average Price is calculated for every TradingPair for each window
-	// Limit sets the number of data points used to calculate the VWAP.
+	//DataPoints  is fast circular fifo data structure (aka., Linked list queue) with a specific limit, one per TradingPair.
+	DataPoints              map[string]*list.List //doubly linked list as a queue
+	CumulativePriceQuantity map[string]float64    // Equation = Sum(Price*Quantity), Sum of Price * Quantity for each TradingPair for each window
+	CumulativeQuantity      map[string]float64    // Equation = Sum(Quantity), Sum of Quantities for every TradingPair for each window
+	VWAP                    map[string]float64    //Equation: VWAP = Sum(Price*Quantity) / Sum(Quantity) Volume Weighted Average Price is calculated for every TradingPair for each window
+	UpdatedAt               map[string]time.Time  // last time a data point was pushed for each TradingPair
+	// Limit sets the number of data points used to calculate the VWAP of each TradingPair.
 	Limit uint
+	// epoch is incremented on every change, to version snapshots.
+	epoch uint64
 }
 
 //NewVwapLinkedList  creates a new VWAP queue and initializes all fields needed to make the VWAP Queue.
 func NewVwapLinkedList(maxSize uint) (storage.Vwap, error) {
 	return &vwapLinkedList{
-		DataPoints:              list.New(),
+		DataPoints:              make(map[string]*list.List),
 		Limit:                   maxSize,
 		CumulativePriceQuantity: make(map[string]float64),
 		CumulativeQuantity:      make(map[string]float64),
 		VWAP:                    make(map[string]float64),
+		UpdatedAt:               make(map[string]time.Time),
 	}, nil
 }
 
-// Size returns the length of the queue.
-func (l *vwapLinkedList) Size() uint {
-	return uint(l.DataPoints.Len())
+// Size returns the length of the queue of a trading pair.
+func (l *vwapLinkedList) Size(tradingPair string) uint {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if dataPoints, ok := l.DataPoints[tradingPair]; ok {
+		return uint(dataPoints.Len())
+	}
+	return 0
 }
 
-func (l *vwapLinkedList) GetDataPoints() any {
-	return *l.DataPoints
+// GetDataPoints returns a copy of the queue of a trading pair.
+func (l *vwapLinkedList) GetDataPoints(tradingPair string) any {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	copied := list.New()
+	if dataPoints, ok := l.DataPoints[tradingPair]; ok {
+		copied.PushBackList(dataPoints)
+	}
+	return *copied
 }
 
 // GetVwap returns the VWAP for a  trading pair.
 func (l *vwapLinkedList) GetVwap(tradingPair string) float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return l.VWAP[tradingPair]
 }
 
+// GetVwaps returns a copy of the VWAPs for trading pairs.
 func (l *vwapLinkedList) GetVwaps() map[string]float64 {
-	return l.VWAP
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return storage.Copy(l.VWAP)
 }
 
-// Push pushes an item onto the queue
+// Push pushes an item onto the queue of its trading pair
 //When Limit is reached, will delete  the first one.
 func (l *vwapLinkedList) Push(d storage.Point) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.Size() == l.Limit {
-		l.remove()
+	dataPoints, ok := l.DataPoints[d.ProductID()]
+	if !ok {
+		dataPoints = list.New()
+		l.DataPoints[d.ProductID()] = dataPoints
+	}
+
+	if uint(dataPoints.Len()) == l.Limit {
+		l.remove(dataPoints)
 	}
 
 	l.computeVwap(d)
-	l.DataPoints.PushBack(d)
+	dataPoints.PushBack(d)
 }
 
 //computeVwap is used to compute the VWAP for a given trading pair.
@@ -80,25 +112,68 @@ func (l *vwapLinkedList) computeVwap(d storage.Point) {
 	l.CumulativeQuantity[d.ProductID()] = l.CumulativeQuantity[d.ProductID()] + d.GetQuantity()
 	//VWAP = Sum(Price*Quantity) / Sum(Quantity)
 	l.VWAP[d.ProductID()] = l.CumulativePriceQuantity[d.ProductID()] / l.CumulativeQuantity[d.ProductID()]
+	l.UpdatedAt[d.ProductID()] = time.Now()
+	l.epoch++
 }
 
-// Remove removes 1st item from the queue.
-func (l *vwapLinkedList) remove() {
+// Remove removes 1st item from the queue of a trading pair.
+func (l *vwapLinkedList) remove(dataPoints *list.List) {
 
-	it := l.DataPoints.Front()
+	it := dataPoints.Front()
+	d := it.Value.(storage.Point)
 	// Subtract the values of 1st item from the VWAP computation.
-	l.CumulativePriceQuantity[it.Value.(storage.Point).ProductID()] = l.CumulativePriceQuantity[it.Value.(storage.Point).ProductID()] - it.Value.(storage.Point).ComputePQ()
-	l.CumulativeQuantity[it.Value.(storage.Point).ProductID()] = l.CumulativeQuantity[it.Value.(storage.Point).ProductID()] - it.Value.(storage.Point).GetQuantity()
+	l.CumulativePriceQuantity[d.ProductID()] = l.CumulativePriceQuantity[d.ProductID()] - d.ComputePQ()
+	l.CumulativeQuantity[d.ProductID()] = l.CumulativeQuantity[d.ProductID()] - d.GetQuantity()
 
 	//VWAP = Sum(Price*Quantity) / Sum(Quantity)
-	if l.CumulativeQuantity[it.Value.(storage.Point).ProductID()] != 0 {
-		l.VWAP[it.Value.(storage.Point).ProductID()] = l.CumulativePriceQuantity[it.Value.(storage.Point).ProductID()] / l.CumulativeQuantity[it.Value.(storage.Point).ProductID()]
+	if l.CumulativeQuantity[d.ProductID()] != 0 {
+		l.VWAP[d.ProductID()] = l.CumulativePriceQuantity[d.ProductID()] / l.CumulativeQuantity[d.ProductID()]
 	}
 
 	//removes 1st item from the queue
-	l.DataPoints.Remove(it)
+	dataPoints.Remove(it)
+}
+
+// Delete tears down the window and VWAP of a trading pair.
+func (l *vwapLinkedList) Delete(tradingPair string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.DataPoints[tradingPair]; !ok {
+		return
+	}
+	delete(l.DataPoints, tradingPair)
+	delete(l.CumulativePriceQuantity, tradingPair)
+	delete(l.CumulativeQuantity, tradingPair)
+	delete(l.VWAP, tradingPair)
+	delete(l.UpdatedAt, tradingPair)
+	l.epoch++
+}
+
+// Snapshot returns a copy of the VWAP state of every trading pair, taken atomically.
+func (l *vwapLinkedList) Snapshot() storage.Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := storage.Snapshot{
+		Epoch: l.epoch,
+		Pairs: make(map[string]storage.PairSnapshot, len(l.DataPoints)),
+	}
+	for tradingPair, dataPoints := range l.DataPoints {
+		snapshot.Pairs[tradingPair] = storage.PairSnapshot{
+			Vwap:                    l.VWAP[tradingPair],
+			CumulativePriceQuantity: l.CumulativePriceQuantity[tradingPair],
+			CumulativeQuantity:      l.CumulativeQuantity[tradingPair],
+			Count:                   uint(dataPoints.Len()),
+			UpdatedAt:               l.UpdatedAt[tradingPair],
+		}
+	}
+	return snapshot
 }
 
 func (l *vwapLinkedList) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return strings.Join(storage.Format(l.VWAP), " | ")
 }
@@ -29,23 +29,32 @@ func TestLinkedListPush_withLimits_ShouldSucceed(t *testing.T) {
 
 	vwapQueue.Push(points["1"])
 
-	require.Equal(t, 1, int(vwapQueue.Size()))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
 
-	l := vwapQueue.GetDataPoints().(list.List)
+	l := vwapQueue.GetDataPoints("TradingPair1").(list.List)
 
 	require.Equal(t, points["1"], l.Back().Value.(storage.Point))
 
 	vwapQueue.Push(points["2"])
-	l = vwapQueue.GetDataPoints().(list.List)
-	require.Equal(t, 2, int(vwapQueue.Size()))
+	l = vwapQueue.GetDataPoints("TradingPair2").(list.List)
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
 	require.Equal(t, points["2"], l.Back().Value.(storage.Point))
 
 	vwapQueue.Push(points["3"])
-	l = vwapQueue.GetDataPoints().(list.List)
-	require.Equal(t, 2, int(vwapQueue.Size()))
+	l = vwapQueue.GetDataPoints("TradingPair1").(list.List)
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
 	require.Equal(t, points["3"], l.Back().Value.(storage.Point))
 
+	vwapQueue.Push(storage.NewPoint(4, 4, "TradingPair1"))
+	l = vwapQueue.GetDataPoints("TradingPair1").(list.List)
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
+	require.Equal(t, points["3"], l.Front().Value.(storage.Point))
+
 	require.Equal(t, 2, len(vwapQueue.GetVwaps()))
+	l = vwapQueue.GetDataPoints("TradingPair3").(list.List)
+	require.Equal(t, 0, l.Len())
 }
 
 func TestVwapLinkedList_Size(t *testing.T) {
@@ -55,10 +64,11 @@ func TestVwapLinkedList_Size(t *testing.T) {
 	require.NoError(t, err)
 
 	vwapQueue.Push(points["1"])
-	require.Equal(t, 1, int(vwapQueue.Size()))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
 
-	vwapQueue.Push(points["2"])
-	require.Equal(t, 2, int(vwapQueue.Size()))
+	vwapQueue.Push(points["3"])
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 0, int(vwapQueue.Size("TradingPair2")))
 }
 
 func TestLinkedList_ConcurrencyMangnt(t *testing.T) {
@@ -84,7 +94,8 @@ func TestLinkedList_ConcurrencyMangnt(t *testing.T) {
 	}()
 
 	wg.Wait()
-	require.Equal(t, 3, int(vwapQueue.Size()))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
 }
 
 func TestVwapLinkedList_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
@@ -108,7 +119,7 @@ func TestVwapLinkedList_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
 			},
 		},
 		{
-			Name: "4 DataPoints and limited to 3",
+			Name: "4 DataPoints and limited to 3 per trading pair",
 			Data: []storage.Point{
 				storage.NewPoint(1, 1, "TradingPair1"),
 				storage.NewPoint(2, 2, "TradingPair2"),
@@ -117,10 +128,25 @@ func TestVwapLinkedList_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
 			},
 			Limit: 3,
 			Expected: map[string]float64{
-				"TradingPair1": 3,
+				"TradingPair1": 2.5,
 				"TradingPair2": 3.3333333333333333,
 			},
 		},
+		{
+			Name: "A busy trading pair doesn't evict a quiet one",
+			Data: []storage.Point{
+				storage.NewPoint(10, 1, "TradingPair2"),
+				storage.NewPoint(1, 1, "TradingPair1"),
+				storage.NewPoint(2, 1, "TradingPair1"),
+				storage.NewPoint(3, 1, "TradingPair1"),
+				storage.NewPoint(4, 1, "TradingPair1"),
+			},
+			Limit: 2,
+			Expected: map[string]float64{
+				"TradingPair1": 3.5,
+				"TradingPair2": 10,
+			},
+		},
 		{
 			Name: "2 DataPoints and limited to 3",
 			Data: []storage.Point{
@@ -153,3 +179,25 @@ func TestVwapLinkedList_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
 		})
 	}
 }
+
+func TestVwapLinkedList_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := linked_list.NewVwapLinkedList(2)
+	require.NoError(t, err)
+
+	vwapQueue.Push(points["1"])
+	vwapQueue.Push(points["2"])
+	vwapQueue.Push(points["3"])
+
+	snapshot := vwapQueue.Snapshot()
+	require.Len(t, snapshot.Pairs, 2)
+	require.Equal(t, 2.5, snapshot.Pairs["TradingPair1"].Vwap)
+	require.Equal(t, 4.0, snapshot.Pairs["TradingPair1"].CumulativeQuantity)
+	require.Equal(t, uint(2), snapshot.Pairs["TradingPair1"].Count)
+	require.False(t, snapshot.Pairs["TradingPair1"].UpdatedAt.IsZero())
+
+	// The snapshot is a copy: later pushes don't change it.
+	vwapQueue.Push(storage.NewPoint(5, 5, "TradingPair2"))
+	require.Equal(t, uint(1), snapshot.Pairs["TradingPair2"].Count)
+}
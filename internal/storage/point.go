@@ -1,13 +1,15 @@
 package storage
 
+import "time"
+
 /**
  * @author Mohamed-Aly Bou-Hanane
  * © 2022
  */
 
 //Point provides the data required to calculate a VWAP for a specific pair from coinbase.
-// since this engine is dealing with financial operations, and for precise results maybe it's better to use libs
-// like https://github.com/shopspring/decimal, but in this code we went with float64.
+// since this engine is dealing with financial operations, float64 is imprecise: DataPoint is fast, while
+// DecimalPoint (ARITHMETIC=decimal) keeps exact decimals parsed from the feed.
 type Point interface {
 	//ComputePQ returns Price * Quantity
 	ComputePQ() float64
@@ -17,6 +19,8 @@ type Point interface {
 	GetQuantity() float64
 	//ProductID returns the TradingPair of coinbase product ID
 	ProductID() string
+	//GetTime returns the exchange time of the trade, zero when unknown
+	GetTime() time.Time
 }
 
 //DataPoint provides the data required to calculate a VWAP for a specific pair from coinbase.
@@ -27,6 +31,8 @@ type DataPoint struct {
 	Quantity float64
 	//TradingPair is the coinbase product ID
 	TradingPair string
+	//Time is the exchange time of the trade
+	Time time.Time
 }
 
 func (d *DataPoint) ComputePQ() float64 {
@@ -45,6 +51,10 @@ func (d *DataPoint) ProductID() string {
 	return d.TradingPair
 }
 
+func (d *DataPoint) GetTime() time.Time {
+	return d.Time
+}
+
 func NewPoint(p, q float64, t string) Point {
 	return &DataPoint{
 		Price:       p,
@@ -52,3 +62,13 @@ func NewPoint(p, q float64, t string) Point {
 		TradingPair: t,
 	}
 }
+
+// NewTimedPoint returns a Point traded at the given exchange time, used by the windows bounded by time.
+func NewTimedPoint(p, q float64, t string, ts time.Time) Point {
+	return &DataPoint{
+		Price:       p,
+		Quantity:    q,
+		TradingPair: t,
+		Time:        ts,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/reactivejson/vwap-engine/internal/storage"
 	"strings"
 	"sync"
+	"time"
 )
 
 /**
@@ -11,62 +12,81 @@ import (
  * © 2022
  */
 
-// VwapQueue represents a queue of DataPoints.
+// VwapQueue represents a queue of DataPoints per trading pair.
 // Manipulation with ArrayList is slow because it internally uses an array. If any element is removed from the array, all the other elements are shifted in memory.
 //Every time a new data point is added to the queue and saved for each trading pair, the VWAP computation is updated accordingly.
 // For performance, and to avoid exponential complexity, the computation is cached for VWAP, CumulativeQuantity,
 //and CumulativePriceQuantity for existing data points and updated with new entries.
 type vwapQueue struct {
-	mu sync.Mutex
-	//DataPoints  is fast circular fifo data structure (aka., queue) with a specific limit.
-	DataPoints              []storage.Point
-	CumulativePriceQuantity map[string]float64 // Equation = Sum(Price*Quantity), Sum of Price * Quantity for each TradingPair for each window
-	CumulativeQuantity      map[string]float64 // Equation = Sum(Quantity), Sum of Quantities for every TradingPair for each window
-	VWAP                    map[string]float64 //Equation: VWAP = Sum(Price*Quantity) / Sum(Quantity) Volume Weighted Average Price is calculated for every TradingPair for each window
-	// Limit sets the number of data points used to calculate the VWAP.
+	mu sync.RWMutex
+	//DataPoints  is fast circular fifo data structure (aka., queue) with a specific limit, one per TradingPair.
+	DataPoints              map[string][]storage.Point
+	CumulativePriceQuantity map[string]float64   // Equation = Sum(Price*Quantity), Sum of Price * Quantity for each TradingPair for each window
+	CumulativeQuantity      map[string]float64   // Equation = Sum(Quantity), Sum of Quantities for every TradingPair for each window
+	VWAP                    map[string]float64   //Equation: VWAP = Sum(Price*Quantity) / Sum(Quantity) Volume Weighted Average Price is calculated for every TradingPair for each window
+	UpdatedAt               map[string]time.Time // last time a data point was pushed for each TradingPair
+	// Limit sets the number of data points used to calculate the VWAP of each TradingPair.
 	Limit uint
+	// epoch is incremented on every change, to version snapshots.
+	epoch uint64
 }
 
 //NewVwapQueue  creates a new VWAP queue and initializes all fields needed to make the VWAP Queue.
 func NewVwapQueue(maxSize uint) (storage.Vwap, error) {
 	return &vwapQueue{
-		DataPoints:              []storage.Point{},
+		DataPoints:              make(map[string][]storage.Point),
 		Limit:                   maxSize,
 		CumulativePriceQuantity: make(map[string]float64),
 		CumulativeQuantity:      make(map[string]float64),
 		VWAP:                    make(map[string]float64),
+		UpdatedAt:               make(map[string]time.Time),
 	}, nil
 }
 
-// Size returns the length of the queue.
-func (l *vwapQueue) Size() uint {
-	return uint(len(l.DataPoints))
+// Size returns the length of the queue of a trading pair.
+func (l *vwapQueue) Size(tradingPair string) uint {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return uint(len(l.DataPoints[tradingPair]))
 }
-func (l *vwapQueue) GetDataPoints() any {
-	return l.DataPoints
+
+// GetDataPoints returns a copy of the queue of a trading pair.
+func (l *vwapQueue) GetDataPoints(tradingPair string) any {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return append([]storage.Point{}, l.DataPoints[tradingPair]...)
 }
 
 // GetVwap returns the VWAP for a  trading pair.
 func (l *vwapQueue) GetVwap(tradingPair string) float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return l.VWAP[tradingPair]
 }
 
+// GetVwaps returns a copy of the VWAPs for trading pairs.
 func (l *vwapQueue) GetVwaps() map[string]float64 {
-	return l.VWAP
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return storage.Copy(l.VWAP)
 }
 
-// Push pushes an item onto the queue
+// Push pushes an item onto the queue of its trading pair
 //When Limit is reached, will delete  the first one.
 func (l *vwapQueue) Push(d storage.Point) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.Size() == l.Limit {
-		l.remove()
+	if uint(len(l.DataPoints[d.ProductID()])) == l.Limit {
+		l.remove(d.ProductID())
 	}
 
 	l.computeVwap(d)
-	l.DataPoints = append(l.DataPoints, d)
+	l.DataPoints[d.ProductID()] = append(l.DataPoints[d.ProductID()], d)
 
 }
 
@@ -77,27 +97,69 @@ func (l *vwapQueue) computeVwap(d storage.Point) {
 	l.CumulativeQuantity[d.ProductID()] = l.CumulativeQuantity[d.ProductID()] + d.GetQuantity()
 	//VWAP = Sum(Price*Quantity) / Sum(Quantity)
 	l.VWAP[d.ProductID()] = l.CumulativePriceQuantity[d.ProductID()] / l.CumulativeQuantity[d.ProductID()]
+	l.UpdatedAt[d.ProductID()] = time.Now()
+	l.epoch++
 }
 
-// Remove removes 1st item from the queue.
-func (l *vwapQueue) remove() {
+// Remove removes 1st item from the queue of a trading pair.
+func (l *vwapQueue) remove(tradingPair string) {
 
-	it := l.DataPoints[0]
-	l.DataPoints[0] = nil
+	it := l.DataPoints[tradingPair][0]
+	l.DataPoints[tradingPair][0] = nil
 
 	// Subtract the values of 1st item from the VWAP computation..
-	l.CumulativePriceQuantity[it.ProductID()] = l.CumulativePriceQuantity[it.ProductID()] - it.ComputePQ()
-	l.CumulativeQuantity[it.ProductID()] = l.CumulativeQuantity[it.ProductID()] - it.GetQuantity()
+	l.CumulativePriceQuantity[tradingPair] = l.CumulativePriceQuantity[tradingPair] - it.ComputePQ()
+	l.CumulativeQuantity[tradingPair] = l.CumulativeQuantity[tradingPair] - it.GetQuantity()
 
 	//VWAP = Sum(Price*Quantity) / Sum(Quantity)
-	if l.CumulativeQuantity[it.ProductID()] != 0 {
-		l.VWAP[it.ProductID()] = l.CumulativePriceQuantity[it.ProductID()] / l.CumulativeQuantity[it.ProductID()]
+	if l.CumulativeQuantity[tradingPair] != 0 {
+		l.VWAP[tradingPair] = l.CumulativePriceQuantity[tradingPair] / l.CumulativeQuantity[tradingPair]
 	}
 
 	//removes 1st item from the queue
-	l.DataPoints = l.DataPoints[1:]
+	l.DataPoints[tradingPair] = l.DataPoints[tradingPair][1:]
+}
+
+// Delete tears down the window and VWAP of a trading pair.
+func (l *vwapQueue) Delete(tradingPair string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.DataPoints[tradingPair]; !ok {
+		return
+	}
+	delete(l.DataPoints, tradingPair)
+	delete(l.CumulativePriceQuantity, tradingPair)
+	delete(l.CumulativeQuantity, tradingPair)
+	delete(l.VWAP, tradingPair)
+	delete(l.UpdatedAt, tradingPair)
+	l.epoch++
+}
+
+// Snapshot returns a copy of the VWAP state of every trading pair, taken atomically.
+func (l *vwapQueue) Snapshot() storage.Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := storage.Snapshot{
+		Epoch: l.epoch,
+		Pairs: make(map[string]storage.PairSnapshot, len(l.DataPoints)),
+	}
+	for tradingPair, dataPoints := range l.DataPoints {
+		snapshot.Pairs[tradingPair] = storage.PairSnapshot{
+			Vwap:                    l.VWAP[tradingPair],
+			CumulativePriceQuantity: l.CumulativePriceQuantity[tradingPair],
+			CumulativeQuantity:      l.CumulativeQuantity[tradingPair],
+			Count:                   uint(len(dataPoints)),
+			UpdatedAt:               l.UpdatedAt[tradingPair],
+		}
+	}
+	return snapshot
 }
 
 func (l *vwapQueue) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return strings.Join(storage.Format(l.VWAP), " | ")
 }
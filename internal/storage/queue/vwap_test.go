@@ -27,22 +27,29 @@ func TestPushQueue_withLimits_ShouldSucceed(t *testing.T) {
 	require.NoError(t, err)
 
 	vwapQueue.Push(dps["1"])
-	require.Equal(t, 1, int(vwapQueue.Size()))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
 
-	l := vwapQueue.GetDataPoints().([]storage.Point)
+	l := vwapQueue.GetDataPoints("TradingPair1").([]storage.Point)
 	require.Equal(t, dps["1"], l[0])
 
 	vwapQueue.Push(dps["2"])
-	require.Equal(t, 2, int(vwapQueue.Size()))
-	l = vwapQueue.GetDataPoints().([]storage.Point)
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
+	l = vwapQueue.GetDataPoints("TradingPair2").([]storage.Point)
 
-	require.Equal(t, dps["2"], l[1])
+	require.Equal(t, dps["2"], l[0])
 
 	vwapQueue.Push(dps["3"])
-	require.Equal(t, 2, int(vwapQueue.Size()))
-	l = vwapQueue.GetDataPoints().([]storage.Point)
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	l = vwapQueue.GetDataPoints("TradingPair1").([]storage.Point)
 	require.Equal(t, dps["3"], l[1])
 
+	vwapQueue.Push(storage.NewPoint(4, 4, "TradingPair1"))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
+	l = vwapQueue.GetDataPoints("TradingPair1").([]storage.Point)
+	require.Equal(t, dps["3"], l[0])
+
 	require.Equal(t, 2, len(vwapQueue.GetVwaps()))
 }
 
@@ -53,10 +60,11 @@ func TestVwapQueue_Size(t *testing.T) {
 	require.NoError(t, err)
 
 	vwapQueue.Push(dps["1"])
-	require.Equal(t, 1, int(vwapQueue.Size()))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
 
-	vwapQueue.Push(dps["2"])
-	require.Equal(t, 2, int(vwapQueue.Size()))
+	vwapQueue.Push(dps["3"])
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 0, int(vwapQueue.Size("TradingPair2")))
 }
 
 func TestConcurrencyMangnt(t *testing.T) {
@@ -82,7 +90,8 @@ func TestConcurrencyMangnt(t *testing.T) {
 	}()
 
 	wg.Wait()
-	require.Equal(t, 3, int(vwapQueue.Size()))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
 }
 
 func TestVwapQueue_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
@@ -106,7 +115,7 @@ func TestVwapQueue_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
 			},
 		},
 		{
-			Name: "4 DataPoints and limited to 3",
+			Name: "4 DataPoints and limited to 3 per trading pair",
 			Data: []storage.Point{
 				storage.NewPoint(1, 1, "TradingPair1"),
 				storage.NewPoint(2, 2, "TradingPair2"),
@@ -115,10 +124,25 @@ func TestVwapQueue_GetVwap_ShouldCompute_AndSucceed(t *testing.T) {
 			},
 			Limit: 3,
 			Expected: map[string]float64{
-				"TradingPair1": 3,
+				"TradingPair1": 2.5,
 				"TradingPair2": 3.3333333333333333,
 			},
 		},
+		{
+			Name: "A busy trading pair doesn't evict a quiet one",
+			Data: []storage.Point{
+				storage.NewPoint(10, 1, "TradingPair2"),
+				storage.NewPoint(1, 1, "TradingPair1"),
+				storage.NewPoint(2, 1, "TradingPair1"),
+				storage.NewPoint(3, 1, "TradingPair1"),
+				storage.NewPoint(4, 1, "TradingPair1"),
+			},
+			Limit: 2,
+			Expected: map[string]float64{
+				"TradingPair1": 3.5,
+				"TradingPair2": 10,
+			},
+		},
 		{
 			Name: "2 DataPoints and limited to 3",
 			Data: []storage.Point{
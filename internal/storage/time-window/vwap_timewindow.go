@@ -0,0 +1,239 @@
+package time_window
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// entry is a data point stamped with the time used to evict it from the window.
+type entry struct {
+	point storage.Point
+	at    time.Time
+}
+
+// vwapTimeWindow represents a doubly linked list as a queue of DataPoints per trading pair, bounded by time.
+// A data point is evicted once it is older than Window compared to the latest trade of its trading pair,
+// or to the wall clock when Expire is called. Data points arriving out of order, e.g. backfilled, are inserted by time,
+// and those already out of the window are skipped, e.g. a 5-minute VWAP only covers the trades of the last 5 minutes.
+// As for the count-based queues, VWAP, CumulativeQuantity and CumulativePriceQuantity are cached and updated
+// with new and evicted entries.
+type vwapTimeWindow struct {
+	mu sync.RWMutex
+	//DataPoints is a list of entries ordered by time, one per TradingPair.
+	DataPoints              map[string]*list.List
+	CumulativePriceQuantity map[string]float64   // Equation = Sum(Price*Quantity), Sum of Price * Quantity for each TradingPair for each window
+	CumulativeQuantity      map[string]float64   // Equation = Sum(Quantity), Sum of Quantities for every TradingPair for each window
+	VWAP                    map[string]float64   //Equation: VWAP = Sum(Price*Quantity) / Sum(Quantity) Volume Weighted Average Price is calculated for every TradingPair for each window
+	UpdatedAt               map[string]time.Time // last time a data point was pushed or evicted for each TradingPair
+	// Window sets the duration of trades used to calculate the VWAP of each TradingPair.
+	Window time.Duration
+	// now is the clock used to stamp data points without an exchange time.
+	now func() time.Time
+	// epoch is incremented on every change, to version snapshots.
+	epoch uint64
+}
+
+// NewVwapTimeWindow creates a new VWAP queue whose data points are evicted once they are older than window.
+func NewVwapTimeWindow(window time.Duration) (storage.Vwap, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid VWAP time window %v: must be positive", window)
+	}
+
+	return &vwapTimeWindow{
+		DataPoints:              make(map[string]*list.List),
+		Window:                  window,
+		CumulativePriceQuantity: make(map[string]float64),
+		CumulativeQuantity:      make(map[string]float64),
+		VWAP:                    make(map[string]float64),
+		UpdatedAt:               make(map[string]time.Time),
+		now:                     time.Now,
+	}, nil
+}
+
+// Size returns the length of the queue of a trading pair.
+func (l *vwapTimeWindow) Size(tradingPair string) uint {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if dataPoints, ok := l.DataPoints[tradingPair]; ok {
+		return uint(dataPoints.Len())
+	}
+	return 0
+}
+
+// GetDataPoints returns the data points of a trading pair, oldest first.
+func (l *vwapTimeWindow) GetDataPoints(tradingPair string) any {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	dataPoints, ok := l.DataPoints[tradingPair]
+	if !ok {
+		return []storage.Point{}
+	}
+
+	points := make([]storage.Point, 0, dataPoints.Len())
+	for it := dataPoints.Front(); it != nil; it = it.Next() {
+		points = append(points, it.Value.(*entry).point)
+	}
+	return points
+}
+
+// GetVwap returns the VWAP for a  trading pair.
+func (l *vwapTimeWindow) GetVwap(tradingPair string) float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.VWAP[tradingPair]
+}
+
+// GetVwaps returns a copy of the VWAPs for trading pairs.
+func (l *vwapTimeWindow) GetVwaps() map[string]float64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return storage.Copy(l.VWAP)
+}
+
+// Push inserts an item into the queue of its trading pair by time, then evicts the data points older than Window
+// compared to the latest one. An item older than Window compared to the latest one is skipped.
+func (l *vwapTimeWindow) Push(d storage.Point) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	at := d.GetTime()
+	if at.IsZero() {
+		at = l.now()
+	}
+
+	dataPoints, ok := l.DataPoints[d.ProductID()]
+	if !ok {
+		dataPoints = list.New()
+		l.DataPoints[d.ProductID()] = dataPoints
+	}
+	if latest := dataPoints.Back(); latest != nil && !at.After(latest.Value.(*entry).at.Add(-l.Window)) {
+		return
+	}
+
+	l.computeVwap(d)
+	insert(dataPoints, &entry{point: d, at: at})
+
+	l.evict(d.ProductID(), dataPoints.Back().Value.(*entry).at.Add(-l.Window))
+}
+
+// insert inserts an entry after the last one stamped at or before it, so the list stays ordered by time.
+// Entries mostly arrive in order, so the list is walked from the back.
+func insert(dataPoints *list.List, e *entry) {
+	for it := dataPoints.Back(); it != nil; it = it.Prev() {
+		if !it.Value.(*entry).at.After(e.at) {
+			dataPoints.InsertAfter(e, it)
+			return
+		}
+	}
+	dataPoints.PushFront(e)
+}
+
+// Expire evicts the data points of every trading pair older than Window compared to now.
+func (l *vwapTimeWindow) Expire(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.Window)
+	for tradingPair := range l.DataPoints {
+		l.evict(tradingPair, cutoff)
+	}
+}
+
+// computeVwap is used to compute the VWAP for a given trading pair.
+func (l *vwapTimeWindow) computeVwap(d storage.Point) {
+	vw := d.ComputePQ()
+	l.CumulativePriceQuantity[d.ProductID()] = l.CumulativePriceQuantity[d.ProductID()] + vw
+	l.CumulativeQuantity[d.ProductID()] = l.CumulativeQuantity[d.ProductID()] + d.GetQuantity()
+	//VWAP = Sum(Price*Quantity) / Sum(Quantity)
+	l.VWAP[d.ProductID()] = l.CumulativePriceQuantity[d.ProductID()] / l.CumulativeQuantity[d.ProductID()]
+	l.UpdatedAt[d.ProductID()] = l.now()
+	l.epoch++
+}
+
+// evict removes the data points of a trading pair stamped at or before cutoff.
+// Data points are kept in time order, so eviction stops at the first one still inside the window.
+// Once a trading pair has no data point left, its VWAP is dropped rather than kept stale.
+func (l *vwapTimeWindow) evict(tradingPair string, cutoff time.Time) {
+	dataPoints := l.DataPoints[tradingPair]
+
+	for it := dataPoints.Front(); it != nil && !it.Value.(*entry).at.After(cutoff); it = dataPoints.Front() {
+		d := it.Value.(*entry).point
+		// Subtract the values of 1st item from the VWAP computation.
+		l.CumulativePriceQuantity[tradingPair] = l.CumulativePriceQuantity[tradingPair] - d.ComputePQ()
+		l.CumulativeQuantity[tradingPair] = l.CumulativeQuantity[tradingPair] - d.GetQuantity()
+
+		//VWAP = Sum(Price*Quantity) / Sum(Quantity)
+		if l.CumulativeQuantity[tradingPair] != 0 {
+			l.VWAP[tradingPair] = l.CumulativePriceQuantity[tradingPair] / l.CumulativeQuantity[tradingPair]
+		}
+
+		dataPoints.Remove(it)
+		l.UpdatedAt[tradingPair] = l.now()
+		l.epoch++
+	}
+
+	if dataPoints.Len() == 0 {
+		delete(l.DataPoints, tradingPair)
+		delete(l.CumulativePriceQuantity, tradingPair)
+		delete(l.CumulativeQuantity, tradingPair)
+		delete(l.VWAP, tradingPair)
+		delete(l.UpdatedAt, tradingPair)
+	}
+}
+
+// Delete tears down the window and VWAP of a trading pair.
+func (l *vwapTimeWindow) Delete(tradingPair string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.DataPoints[tradingPair]; !ok {
+		return
+	}
+	delete(l.DataPoints, tradingPair)
+	delete(l.CumulativePriceQuantity, tradingPair)
+	delete(l.CumulativeQuantity, tradingPair)
+	delete(l.VWAP, tradingPair)
+	delete(l.UpdatedAt, tradingPair)
+	l.epoch++
+}
+
+// Snapshot returns a copy of the VWAP state of every trading pair, taken atomically.
+func (l *vwapTimeWindow) Snapshot() storage.Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := storage.Snapshot{
+		Epoch: l.epoch,
+		Pairs: make(map[string]storage.PairSnapshot, len(l.DataPoints)),
+	}
+	for tradingPair, dataPoints := range l.DataPoints {
+		snapshot.Pairs[tradingPair] = storage.PairSnapshot{
+			Vwap:                    l.VWAP[tradingPair],
+			CumulativePriceQuantity: l.CumulativePriceQuantity[tradingPair],
+			CumulativeQuantity:      l.CumulativeQuantity[tradingPair],
+			Count:                   uint(dataPoints.Len()),
+			UpdatedAt:               l.UpdatedAt[tradingPair],
+		}
+	}
+	return snapshot
+}
+
+func (l *vwapTimeWindow) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return strings.Join(storage.Format(l.VWAP), " | ")
+}
@@ -0,0 +1,137 @@
+package time_window_test
+
+import (
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/time-window"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+var start = time.Date(2022, 5, 21, 9, 12, 0, 0, time.UTC)
+
+func TestNewVwapTimeWindow_WithInvalidWindow_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	_, err := time_window.NewVwapTimeWindow(0)
+	require.Error(t, err)
+}
+
+func TestTimeWindowPush_ShouldEvictOldDataPoints(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := time_window.NewVwapTimeWindow(time.Minute)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewTimedPoint(1, 1, "TradingPair1", start))
+	vwapQueue.Push(storage.NewTimedPoint(2, 2, "TradingPair2", start))
+	vwapQueue.Push(storage.NewTimedPoint(3, 3, "TradingPair1", start.Add(30*time.Second)))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 2.5, vwapQueue.GetVwap("TradingPair1"))
+
+	// The 1st data point is exactly one window old.
+	p := storage.NewTimedPoint(4, 4, "TradingPair1", start.Add(time.Minute))
+	vwapQueue.Push(p)
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 25.0/7, vwapQueue.GetVwap("TradingPair1"))
+	require.Equal(t, p, vwapQueue.GetDataPoints("TradingPair1").([]storage.Point)[1])
+
+	// Other trading pairs are only evicted by their own trades or by Expire.
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
+	require.Equal(t, 2.0, vwapQueue.GetVwap("TradingPair2"))
+}
+
+func TestTimeWindowPush_OutOfOrder_ShouldEvictByTime(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := time_window.NewVwapTimeWindow(time.Minute)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewTimedPoint(1, 1, "TradingPair1", start.Add(50*time.Second)))
+	// Backfilled, older than the latest trade but still in the window.
+	late := storage.NewTimedPoint(2, 2, "TradingPair1", start.Add(10*time.Second))
+	vwapQueue.Push(late)
+	// Out of the window of the latest trade.
+	vwapQueue.Push(storage.NewTimedPoint(3, 3, "TradingPair1", start.Add(-20*time.Second)))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 5.0/3, vwapQueue.GetVwap("TradingPair1"))
+	require.Equal(t, late, vwapQueue.GetDataPoints("TradingPair1").([]storage.Point)[0])
+
+	// The backfilled trade is the 1st one out of the window, although pushed last.
+	vwapQueue.Push(storage.NewTimedPoint(4, 4, "TradingPair1", start.Add(70*time.Second)))
+	require.Equal(t, 2, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 17.0/5, vwapQueue.GetVwap("TradingPair1"))
+
+	vwapQueue.(storage.Expirer).Expire(start.Add(115 * time.Second))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 4.0, vwapQueue.GetVwap("TradingPair1"))
+}
+
+func TestTimeWindowExpire_ShouldDropStaleTradingPairs(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := time_window.NewVwapTimeWindow(time.Minute)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewTimedPoint(1, 1, "TradingPair1", start))
+	vwapQueue.Push(storage.NewTimedPoint(2, 2, "TradingPair2", start.Add(45*time.Second)))
+	vwapQueue.Push(storage.NewTimedPoint(3, 3, "TradingPair2", start.Add(50*time.Second)))
+
+	expirer, ok := vwapQueue.(storage.Expirer)
+	require.True(t, ok)
+
+	expirer.Expire(start.Add(30 * time.Second))
+	require.Equal(t, 2, len(vwapQueue.GetVwaps()))
+
+	expirer.Expire(start.Add(time.Minute + 47*time.Second))
+	require.Equal(t, 0, int(vwapQueue.Size("TradingPair1")))
+	require.Equal(t, 0.0, vwapQueue.GetVwap("TradingPair1"))
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair2")))
+	require.Equal(t, 3.0, vwapQueue.GetVwap("TradingPair2"))
+	require.Equal(t, 1, len(vwapQueue.GetVwaps()))
+
+	expirer.Expire(start.Add(time.Hour))
+	require.Empty(t, vwapQueue.GetVwaps())
+	require.Empty(t, vwapQueue.GetDataPoints("TradingPair2"))
+}
+
+func TestTimeWindow_ConcurrencyMangnt(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := time_window.NewVwapTimeWindow(time.Hour)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			vwapQueue.Push(storage.NewTimedPoint(1, 1, "TradingPair1", start.Add(time.Duration(i)*time.Second)))
+			vwapQueue.(storage.Expirer).Expire(start)
+			wg.Done()
+		}(i)
+	}
+
+	wg.Wait()
+	require.Equal(t, 3, int(vwapQueue.Size("TradingPair1")))
+}
+
+func TestTimeWindowPush_WithoutExchangeTime_ShouldUseWallClock(t *testing.T) {
+	t.Parallel()
+
+	vwapQueue, err := time_window.NewVwapTimeWindow(time.Minute)
+	require.NoError(t, err)
+
+	vwapQueue.Push(storage.NewPoint(1, 1, "TradingPair1"))
+	vwapQueue.(storage.Expirer).Expire(time.Now())
+	require.Equal(t, 1, int(vwapQueue.Size("TradingPair1")))
+
+	vwapQueue.(storage.Expirer).Expire(time.Now().Add(time.Minute))
+	require.Equal(t, 0, int(vwapQueue.Size("TradingPair1")))
+}
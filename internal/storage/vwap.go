@@ -1,6 +1,9 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 /**
  * @author Mohamed-Aly Bou-Hanane
@@ -9,22 +12,67 @@ import "fmt"
 
 // Vwap represents a queue of DataPoints and their VWAPs.
 //DataPoints  is fast circular fifo data structure (aka., queue) with a specific limit.
+//Every trading pair has its own window, so a busy pair never evicts the data points of a quiet one.
+//Per-venue windows are keyed by VenueKey next to the consolidated window of their trading pair.
 type Vwap interface {
-	// Push pushes an item onto the queue and calculates the new VWAP.
-	//When Limit is reached, will delete  the first one.
+	// Push pushes an item onto the queue of its trading pair and calculates the new VWAP.
+	//When Limit is reached for that trading pair, will delete  the first one.
 	Push(d Point)
 
-	// Size returns the length of the dara points queue.
-	Size() uint
+	// Size returns the length of the data points queue of a trading pair.
+	Size(tradingPair string) uint
 
-	// GetDataPoints returns the data point items.
-	GetDataPoints() any
+	// GetDataPoints returns the data point items of a trading pair.
+	GetDataPoints(tradingPair string) any
 
 	// GetVwap returns the VWAP for a  trading pair.
 	GetVwap(tradingPair string) float64
 
 	//GetVwaps returns the VWAPs for trading pairs
 	GetVwaps() map[string]float64
+
+	// Snapshot returns a copy of the VWAP state of every trading pair, taken atomically.
+	Snapshot() Snapshot
+
+	// Delete tears down the window and VWAP of a trading pair, e.g. once it is unsubscribed.
+	Delete(tradingPair string)
+}
+
+// Snapshot is an immutable copy of the VWAP state of every trading pair, safe to read while new data points are pushed.
+type Snapshot struct {
+	// Epoch is the version of the storage the snapshot was taken at. It is incremented on every change,
+	// so two snapshots with the same Epoch hold the same state.
+	Epoch uint64
+	Pairs map[string]PairSnapshot
+}
+
+// PairSnapshot is a copy of the VWAP state of a trading pair.
+type PairSnapshot struct {
+	// Vwap is the Volume Weighted Average Price of the window.
+	Vwap float64
+	// CumulativePriceQuantity is the Sum(Price*Quantity) of the window.
+	CumulativePriceQuantity float64
+	// CumulativeQuantity is the Sum(Quantity) of the window.
+	CumulativeQuantity float64
+	// Count is the number of data points in the window.
+	Count uint
+	// UpdatedAt is the last time a data point was pushed or evicted.
+	UpdatedAt time.Time
+}
+
+// Expirer is implemented by the Vwap windows bounded by time. Expire evicts the data points that fell out of the
+// window at now, so a quiet trading pair's VWAP doesn't keep reflecting old trades when no new data point arrives.
+type Expirer interface {
+	Expire(now time.Time)
+}
+
+// Copy returns a shallow copy of a map, to hand internal state over to concurrent readers.
+func Copy[M ~map[K]V, K comparable, V any](m M) M {
+	result := make(M, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
 }
 
 func Format[M ~map[K]V, K comparable, V any](m M) (result []string) {
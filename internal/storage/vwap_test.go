@@ -0,0 +1,115 @@
+package storage_test
+
+import (
+	"fmt"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/reactivejson/vwap-engine/internal/storage/decimal"
+	"github.com/reactivejson/vwap-engine/internal/storage/linked-list"
+	"github.com/reactivejson/vwap-engine/internal/storage/queue"
+	"github.com/reactivejson/vwap-engine/internal/storage/time-window"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+var start = time.Date(2022, 5, 21, 9, 12, 0, 0, time.UTC)
+
+// vwaps are the storage.Vwap implementations, with the number of data points a window keeps once 200 trades one
+// second apart are pushed.
+var vwaps = []struct {
+	name  string
+	new   func() (storage.Vwap, error)
+	count uint
+}{
+	{name: "queue", new: func() (storage.Vwap, error) { return queue.NewVwapQueue(50) }, count: 50},
+	{name: "linked list", new: func() (storage.Vwap, error) { return linked_list.NewVwapLinkedList(50) }, count: 50},
+	{name: "time window", new: func() (storage.Vwap, error) { return time_window.NewVwapTimeWindow(time.Minute) }, count: 60},
+	{name: "decimal size", new: func() (storage.Vwap, error) { return decimal.NewVwapDecimal(50, 0) }, count: 50},
+	{name: "decimal duration", new: func() (storage.Vwap, error) { return decimal.NewVwapDecimal(0, time.Minute) }, count: 60},
+}
+
+func TestVwap_ConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range vwaps {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			vwapQueue, err := tt.new()
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 1; i <= 200; i++ {
+					vwapQueue.Push(storage.NewTimedPoint(float64(i), 1, "TradingPair1", start.Add(time.Duration(i)*time.Second)))
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+				var epoch uint64
+				for i := 0; i < 200; i++ {
+					snapshot := vwapQueue.Snapshot()
+					assert.GreaterOrEqual(t, snapshot.Epoch, epoch)
+					epoch = snapshot.Epoch
+					for _, pair := range snapshot.Pairs {
+						assert.InDelta(t, pair.CumulativePriceQuantity/pair.CumulativeQuantity, pair.Vwap, 1e-9)
+					}
+
+					_ = vwapQueue.GetVwap("TradingPair1")
+					_ = vwapQueue.Size("TradingPair1")
+					_ = vwapQueue.GetDataPoints("TradingPair1")
+					for k := range vwapQueue.GetVwaps() {
+						_ = k
+					}
+					_ = fmt.Sprint(vwapQueue)
+				}
+			}()
+
+			wg.Wait()
+
+			snapshot := vwapQueue.Snapshot()
+			require.Equal(t, tt.count, snapshot.Pairs["TradingPair1"].Count)
+			require.Equal(t, snapshot, vwapQueue.Snapshot())
+		})
+	}
+}
+
+func TestVwap_Delete_ShouldTearDownTradingPair(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range vwaps {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			vwapQueue, err := tt.new()
+			require.NoError(t, err)
+
+			vwapQueue.Push(storage.NewPoint(1, 1, "TradingPair1"))
+			vwapQueue.Push(storage.NewPoint(2, 2, "TradingPair2"))
+			epoch := vwapQueue.Snapshot().Epoch
+
+			vwapQueue.Delete("TradingPair1")
+			vwapQueue.Delete("TradingPair3")
+
+			snapshot := vwapQueue.Snapshot()
+			require.Equal(t, epoch+1, snapshot.Epoch)
+			require.NotContains(t, snapshot.Pairs, "TradingPair1")
+			require.Contains(t, snapshot.Pairs, "TradingPair2")
+			require.Zero(t, vwapQueue.Size("TradingPair1"))
+			require.NotContains(t, vwapQueue.GetVwaps(), "TradingPair1")
+		})
+	}
+}
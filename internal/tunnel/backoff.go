@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// DefaultBackoff is the reconnect policy used by NewReceiver.
+var DefaultBackoff = Backoff{
+	Min:    500 * time.Millisecond,
+	Max:    30 * time.Second,
+	Factor: 2,
+	Jitter: 0.2,
+}
+
+// Backoff is a jittered exponential delay between two reconnect attempts.
+type Backoff struct {
+	// Min is the delay before the first attempt.
+	Min time.Duration
+	// Max caps the delay, whatever the number of attempts.
+	Max time.Duration
+	// Factor multiplies the delay after every failed attempt.
+	Factor float64
+	// Jitter is the fraction (0..1) of the delay randomly added or subtracted, so reconnecting clients don't stampede.
+	Jitter float64
+}
+
+// Duration returns the delay to wait before the given attempt, starting at 0.
+func (b Backoff) Duration(attempt int) time.Duration {
+	delay := float64(b.Min) * math.Pow(b.Factor, float64(attempt))
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,36 @@
+package tunnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestBackoff_Duration(t *testing.T) {
+	t.Parallel()
+
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Factor: 2}
+
+	require.Equal(t, 100*time.Millisecond, b.Duration(0))
+	require.Equal(t, 200*time.Millisecond, b.Duration(1))
+	require.Equal(t, 800*time.Millisecond, b.Duration(3))
+	require.Equal(t, time.Second, b.Duration(10))
+}
+
+func TestBackoff_Duration_WithJitter(t *testing.T) {
+	t.Parallel()
+
+	b := Backoff{Min: time.Second, Max: time.Second, Factor: 2, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		d := b.Duration(i)
+		require.GreaterOrEqual(t, d, 500*time.Millisecond)
+		require.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+}
@@ -0,0 +1,126 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"strings"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	// binanceTrade is the event type of the Binance <symbol>@trade stream.
+	binanceTrade = "trade"
+	// binanceTradeStream is the suffix of the trade stream names.
+	binanceTradeStream = "@trade"
+)
+
+// NewBinanceReceiver returns a Tunnel receiving the trades of the Binance <symbol>@trade streams, e.g. from
+// wss://stream.binance.com:9443. Binance subscribes through the URL of a combined stream, so the websocket is only
+// dialed by Subscribe. Trades are normalized with Coinbase product IDs, e.g. BTCUSDT to BTC-USD.
+func NewBinanceReceiver(websocketUrl string, opts ...ReceiverOption) (Tunnel, error) {
+	return newReceiver(strings.TrimSuffix(websocketUrl, "/"), newBinance(), newDialer(), nil, opts...), nil
+}
+
+// binance subscribes to the trade streams of a combined stream URL and maps the Binance symbols of the
+// subscribed trading pairs back to their product IDs.
+type binance struct {
+	names *symbols
+}
+
+func newBinance() *binance {
+	return &binance{names: newSymbols(BinanceSymbol, BinanceProductID)}
+}
+
+func (b *binance) venue() string {
+	return VenueBinance
+}
+
+func (b *binance) symbols() *symbols {
+	return b.names
+}
+
+// endpoint builds the combined stream URL of the trading pairs, e.g. /stream?streams=btcusdt@trade/ethusdt@trade.
+func (b *binance) endpoint(websocketUrl string, tradingPairs []string) string {
+	streams := make([]string, 0, len(tradingPairs))
+	for _, tradingPair := range tradingPairs {
+		streams = append(streams, strings.ToLower(b.names.venue(tradingPair))+binanceTradeStream)
+	}
+	return websocketUrl + "/stream?streams=" + strings.Join(streams, "/")
+}
+
+func (b *binance) reset() {}
+
+// subscribe is a no-op: the streams are part of the endpoint.
+func (b *binance) subscribe(_ *ws.Conn, _ []string) error {
+	return nil
+}
+
+// unsubscribe is a no-op: the endpoint is redialed without the streams.
+func (b *binance) unsubscribe(_ *ws.Conn, _ []string) error {
+	return nil
+}
+
+// decode normalizes a trade of a combined stream. As on Coinbase, the side is the maker's side.
+func (b *binance) decode(frame []byte) ([]*models.Trade, error) {
+	message := models.BinanceStream{}
+	if err := json.Unmarshal(frame, &message); err != nil {
+		return nil, err
+	}
+	trade := message.Data
+	if trade.EventType != binanceTrade {
+		return nil, nil
+	}
+
+	side := models.SideSell
+	if trade.BuyerIsMaker {
+		side = models.SideBuy
+	}
+
+	return []*models.Trade{{
+		Venue:     VenueBinance,
+		ProductID: b.names.pair(trade.Symbol),
+		TradeID:   trade.TradeID,
+		Price:     trade.Price,
+		Size:      trade.Quantity,
+		Side:      side,
+		Time:      time.UnixMilli(trade.TradeTime).UTC(),
+	}}, nil
+}
+
+// BinanceSymbol maps a Coinbase product ID to a Binance symbol, e.g. BTC-USD to BTCUSDT and ETH-BTC to ETHBTC.
+// Binance quotes US dollars in USDT.
+func BinanceSymbol(tradingPair string) string {
+	base, quote, ok := strings.Cut(strings.ToUpper(tradingPair), "-")
+	if !ok {
+		return strings.ToUpper(tradingPair)
+	}
+	if quote == "USD" {
+		quote = "USDT"
+	}
+	return base + quote
+}
+
+// BinanceProductID maps a Binance symbol back to a Coinbase product ID, e.g. BTCUSDT to BTC-USD, for the quote
+// currencies of binanceQuotes. Other symbols are returned as is.
+func BinanceProductID(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+	for _, quote := range binanceQuotes {
+		if base := strings.TrimSuffix(symbol, quote); base != symbol && base != "" {
+			if quote == "USDT" {
+				quote = "USD"
+			}
+			return fmt.Sprintf("%s-%s", base, quote)
+		}
+	}
+	return symbol
+}
+
+// binanceQuotes are the quote currencies recognized by BinanceProductID, longest first.
+var binanceQuotes = []string{"USDT", "BUSD", "USDC", "BTC", "ETH", "BNB", "EUR"}
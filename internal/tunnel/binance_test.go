@@ -0,0 +1,233 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestBinanceSymbol(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		tradingPair string
+		symbol      string
+	}{
+		{"BTC-USD", "BTCUSDT"},
+		{"eth-usd", "ETHUSDT"},
+		{"ETH-BTC", "ETHBTC"},
+		{"BNBBUSD", "BNBBUSD"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.symbol, BinanceSymbol(tt.tradingPair))
+	}
+}
+
+func TestBinanceProductID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		symbol    string
+		productID string
+	}{
+		{"BTCUSDT", "BTC-USD"},
+		{"ethbtc", "ETH-BTC"},
+		{"SOLBUSD", "SOL-BUSD"},
+		{"USDT", "USDT"},
+		{"XYZ", "XYZ"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.productID, BinanceProductID(tt.symbol))
+	}
+}
+
+func TestBinance_Decode(t *testing.T) {
+	t.Parallel()
+
+	b := newBinance()
+	b.endpoint("wss://stream.binance.com:9443", []string{"BTC-USD"})
+
+	responses, err := b.decode([]byte(`{"stream":"btcusdt@trade","data":{"e":"trade","E":1653124324863,"s":"BTCUSDT",` +
+		`"t":1380339443,"p":"29303.35000000","q":"0.00029900","b":10602839853,"a":10602839885,"T":1653124324862,"m":true,"M":true}}`))
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.Equal(t, &models.Trade{
+		Venue:     "binance",
+		ProductID: "BTC-USD",
+		TradeID:   1380339443,
+		Price:     "29303.35000000",
+		Size:      "0.00029900",
+		Side:      models.SideBuy,
+		Time:      time.Date(2022, 5, 21, 9, 12, 4, 862000000, time.UTC),
+	}, responses[0])
+
+	responses, err = b.decode([]byte(`{"result":null,"id":1}`))
+	require.NoError(t, err)
+	assert.Empty(t, responses)
+
+	_, err = b.decode([]byte(`{"stream":`))
+	require.Error(t, err)
+}
+
+func TestBinanceReceiver_Read(t *testing.T) {
+	streams := make(chan string, 1)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+	defer server.Close()
+
+	tunnel, err := NewBinanceReceiver(webSocketURL + "/")
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "ETH-BTC"}))
+	assert.Equal(t, "btcusdt@trade/ethbtc@trade", <-streams)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	for _, want := range []struct {
+		productID string
+		side      string
+	}{{"BTC-USD", "buy"}, {"ETH-BTC", "sell"}} {
+		select {
+		case response := <-receiver:
+			assert.Equal(t, want.productID, response.ProductID)
+			assert.Equal(t, want.side, string(response.Side))
+			assert.Equal(t, "0.00029900", response.Size)
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trade", want.productID)
+		}
+	}
+}
+
+func TestBinanceReceiver_Unsubscribe_ShouldRedialWithoutTheStreams(t *testing.T) {
+	streams := make(chan string, 2)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+	defer server.Close()
+
+	tunnel, err := NewBinanceReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "ETH-BTC"}))
+	assert.Equal(t, "btcusdt@trade/ethbtc@trade", <-streams)
+
+	require.NoError(t, tunnel.Unsubscribe([]string{"BTC-USD"}))
+	assert.Equal(t, "ethbtc@trade", <-streams)
+}
+
+func TestBinanceReceiver_Subscribe_WhileReading_ShouldDialOnce(t *testing.T) {
+	streams := make(chan string, 10)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+	defer server.Close()
+
+	tunnel, err := NewBinanceReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	tunnel.(*Receiver).backoff = Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond}
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	assert.Equal(t, "btcusdt@trade", <-streams)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+	assert.Equal(t, "BTC-USD", (<-receiver).ProductID)
+
+	// The read of the replaced connection fails, and Read goes on with the new one instead of reconnecting.
+	require.NoError(t, tunnel.Subscribe([]string{"ETH-BTC"}))
+	assert.Equal(t, "btcusdt@trade/ethbtc@trade", <-streams)
+	for _, productID := range []string{"BTC-USD", "ETH-BTC"} {
+		assert.Equal(t, productID, (<-receiver).ProductID)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, streams, "redialed")
+}
+
+func TestBinanceReceiver_Unsubscribe_ShouldKeepTheLastStream(t *testing.T) {
+	streams := make(chan string, 2)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+	defer server.Close()
+
+	tunnel, err := NewBinanceReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	assert.Equal(t, "btcusdt@trade", <-streams)
+
+	require.Error(t, tunnel.Unsubscribe([]string{"BTC-USD"}))
+	assert.Equal(t, []string{"BTC-USD"}, tunnel.(*Receiver).tradingPairs)
+	assert.Empty(t, streams)
+}
+
+func TestBinanceReceiver_Read_BeforeSubscribe_ShouldWaitForTheConnection(t *testing.T) {
+	streams := make(chan string, 1)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+	defer server.Close()
+
+	// Without connection, pings are skipped and the read waits for Subscribe to dial.
+	tunnel, err := NewBinanceReceiver(webSocketURL, WithKeepalive(Keepalive{PingInterval: time.Millisecond}))
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	assert.Equal(t, "btcusdt@trade", <-streams)
+	assert.Equal(t, "BTC-USD", (<-receiver).ProductID)
+}
+
+func TestBinanceReceiver_Read_NeverSubscribed_ShouldStopOnCancel(t *testing.T) {
+	tunnel, err := NewBinanceReceiver(webSocketURL, WithKeepalive(Keepalive{PingInterval: time.Millisecond}))
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case _, ok := <-receiver:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timeout waiting for the receiver channel to close")
+	}
+	require.NoError(t, tunnel.Err())
+}
+
+func TestBinanceReceiver_Subscribe_ShouldRollBackOnError(t *testing.T) {
+	streams := make(chan string, 2)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+
+	tunnel, err := NewBinanceReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	assert.Equal(t, "btcusdt@trade", <-streams)
+
+	// Redialing fails: ETH-BTC isn't resubscribed on the next reconnect.
+	server.Close()
+	require.Error(t, tunnel.Subscribe([]string{"ETH-BTC"}))
+	assert.Equal(t, []string{"BTC-USD"}, tunnel.(*Receiver).tradingPairs)
+}
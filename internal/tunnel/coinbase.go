@@ -0,0 +1,372 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Types of the Coinbase websocket messages.
+const (
+	// coinbaseSubscriptions acknowledges a subscribe or unsubscribe request with all the current subscriptions.
+	coinbaseSubscriptions = "subscriptions"
+	// coinbaseError rejects a request, e.g. a subscription to an invalid product.
+	coinbaseError = "error"
+	// coinbaseHeartbeat is sent every second per product of the heartbeat channel.
+	coinbaseHeartbeat = "heartbeat"
+	// tradeLastMatch is the type of the last trade sent by Coinbase on subscription to the matches channel.
+	tradeLastMatch = "last_match"
+
+	// coinbaseMatches is the channel of the trades, coinbaseHeartbeats the channel of the heartbeats.
+	coinbaseMatches    = "matches"
+	coinbaseHeartbeats = "heartbeat"
+)
+
+// Heartbeat is the last heartbeat received for a product: the exchange is alive and LastTradeID is its latest trade.
+type Heartbeat struct {
+	ProductID   string
+	LastTradeID int
+	// Time is the exchange time of the heartbeat, ReceivedAt the time it was received by the engine.
+	Time       time.Time
+	ReceivedAt time.Time
+}
+
+// coinbase subscribes to the matches channel of a single websocket endpoint, and routes the other messages by type.
+type coinbase struct {
+	names *symbols
+
+	mu sync.Mutex
+	// pending holds the requests sent waiting for their acknowledgement, in request order.
+	pending []coinbaseRequest
+	// requested holds the product IDs subscribed to, once all the pending requests are acknowledged.
+	requested  []string
+	heartbeats map[string]Heartbeat // by trading pair
+	// onHeartbeat, when set, is called with every heartbeat received.
+	onHeartbeat func(heartbeat Heartbeat)
+
+	// frame, amounts and batch are reused by decode, which is only called by the goroutine reading the feed.
+	frame   coinbaseFrame
+	amounts []byte
+	batch   [1]*models.Trade
+}
+
+// coinbaseRequest is a request waiting for its acknowledgement: expected holds the product IDs the acknowledgement
+// must hold, added those subscribed to by the request, rejected if it fails.
+type coinbaseRequest struct {
+	expected []string
+	added    []string
+}
+
+func newCoinbase() *coinbase {
+	return &coinbase{
+		names:      newSymbols(identity, identity),
+		heartbeats: make(map[string]Heartbeat),
+	}
+}
+
+func (c *coinbase) venue() string {
+	return VenueCoinbase
+}
+
+func (c *coinbase) symbols() *symbols {
+	return c.names
+}
+
+func (c *coinbase) endpoint(websocketUrl string, _ []string) string {
+	return websocketUrl
+}
+
+func (c *coinbase) subscribe(conn *ws.Conn, tradingPairs []string) error {
+	return c.request(conn, TunnelSubscribe, tradingPairs)
+}
+
+func (c *coinbase) unsubscribe(conn *ws.Conn, tradingPairs []string) error {
+	return c.request(conn, TunnelUnsubscribe, tradingPairs)
+}
+
+// request sends a subscribe or unsubscribe request of the matches and heartbeat channels of the trading pairs,
+// and remembers the product IDs its acknowledgement must hold.
+func (c *coinbase) request(conn *ws.Conn, requestType string, tradingPairs []string) error {
+	productIDs := make([]string, 0, len(tradingPairs))
+	for _, tradingPair := range tradingPairs {
+		productIDs = append(productIDs, c.names.venue(tradingPair))
+	}
+
+	sbPayload := models.CoinbaseRequest{
+		Type:       requestType,
+		ProductIDs: productIDs,
+		Channels: []models.Channel{
+			{Name: coinbaseMatches},
+			{Name: coinbaseHeartbeats},
+		},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := conn.WriteJSON(sbPayload); err != nil {
+		return fmt.Errorf("error writing JSON to %s: %v", requestType, err)
+	}
+
+	pending := coinbaseRequest{expected: c.expected()}
+	if requestType == TunnelSubscribe {
+		for _, productID := range productIDs {
+			if !containsPair(pending.expected, productID) {
+				pending.expected = append(pending.expected, productID)
+				pending.added = append(pending.added, productID)
+			}
+		}
+	} else {
+		pending.expected = withoutPairs(pending.expected, productIDs)
+	}
+	c.pending = append(c.pending, pending)
+	return nil
+}
+
+// reset forgets the requests of the previous connection, never acknowledged once the connection is lost.
+func (c *coinbase) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = nil
+	c.requested = nil
+}
+
+// expected returns the product IDs subscribed to once the last request is acknowledged. c.mu must be held.
+func (c *coinbase) expected() []string {
+	if len(c.pending) > 0 {
+		return append([]string(nil), c.pending[len(c.pending)-1].expected...)
+	}
+	return append([]string(nil), c.requested...)
+}
+
+// decode routes a message by type: matches are converted to trades, last_match to a snapshot trade,
+// subscriptions acknowledgements are validated against the requests, error messages are returned as an ExchangeError
+// and heartbeats are tracked per product. Other messages are skipped.
+// Matches are scanned on the fast path when possible, the other messages are decoded with encoding/json.
+func (c *coinbase) decode(frame []byte) ([]*models.Trade, error) {
+	if c.frame.scan(frame) {
+		if typ := string(c.frame.typ); typ == tradeMatch || typ == tradeLastMatch {
+			return c.decodeMatch()
+		}
+	}
+	return c.decodeJSON(frame)
+}
+
+// decodeMatch converts the scanned match to a trade, allocating only the trade and a string holding its price and
+// size. The returned slice is reused by the next call.
+func (c *coinbase) decodeMatch() ([]*models.Trade, error) {
+	f := &c.frame
+	trade := &models.Trade{
+		Venue:     VenueCoinbase,
+		ProductID: c.names.pairOf(f.productID),
+		Side:      scannedSide(f.side),
+		TradeID:   f.tradeID,
+		// last_match is the last trade before the subscription, not a live one.
+		Snapshot: string(f.typ) == tradeLastMatch,
+	}
+
+	c.amounts = append(append(c.amounts[:0], f.price...), f.size...)
+	amounts := string(c.amounts)
+	trade.Price, trade.Size = amounts[:len(f.price)], amounts[len(f.price):]
+
+	if len(f.time) > 0 {
+		tradeTime, err := time.Parse(time.RFC3339Nano, string(f.time))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time %s of trade %d: %w", f.time, f.tradeID, err)
+		}
+		trade.Time = tradeTime
+	}
+
+	c.batch[0] = trade
+	return c.batch[:], nil
+}
+
+// scannedSide returns the side of a scanned trade, without allocating for buy and sell.
+func scannedSide(side []byte) models.Side {
+	switch string(side) {
+	case string(models.SideBuy):
+		return models.SideBuy
+	case string(models.SideSell):
+		return models.SideSell
+	default:
+		return models.Side(side)
+	}
+}
+
+// decodeJSON decodes a message with encoding/json, see decode.
+func (c *coinbase) decodeJSON(frame []byte) ([]*models.Trade, error) {
+	response := &models.CoinbaseResponse{}
+	if err := json.Unmarshal(frame, response); err != nil {
+		return nil, err
+	}
+
+	switch response.Type {
+	case tradeMatch, tradeLastMatch:
+		trade, err := coinbaseTrade(response)
+		if err != nil {
+			return nil, err
+		}
+		trade.ProductID = c.names.pair(trade.ProductID)
+		// last_match is the last trade before the subscription, not a live one.
+		trade.Snapshot = response.Type == tradeLastMatch
+		return []*models.Trade{trade}, nil
+
+	case coinbaseSubscriptions:
+		return nil, c.acknowledge(response.Channels)
+
+	case coinbaseError:
+		return nil, c.reject(&ExchangeError{Venue: VenueCoinbase, Message: response.Message, Reason: response.Reason})
+
+	case coinbaseHeartbeat:
+		return nil, c.heartbeat(response)
+
+	default:
+		return nil, nil
+	}
+}
+
+// acknowledge checks that the subscriptions acknowledge the oldest pending request.
+func (c *coinbase) acknowledge(channels []models.Channel) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) == 0 {
+		return nil
+	}
+	expected := c.pending[0].expected
+	c.pending = c.pending[1:]
+	c.requested = expected
+
+	var subscribed []string
+	for _, channel := range channels {
+		if channel.Name == coinbaseMatches {
+			subscribed = channel.ProductIDs
+		}
+	}
+
+	var missing []string
+	for _, productID := range expected {
+		if !containsPair(subscribed, productID) {
+			missing = append(missing, productID)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		c.drop(missing)
+		return &ExchangeError{
+			Venue:        VenueCoinbase,
+			Message:      "subscription not acknowledged",
+			Reason:       "missing " + strings.Join(missing, ", "),
+			TradingPairs: c.pairs(missing),
+		}
+	}
+	return nil
+}
+
+// reject answers the oldest pending request with an error message instead of its acknowledgement: the trading pairs
+// it subscribed to, if any, are rejected.
+func (c *coinbase) reject(err *ExchangeError) *ExchangeError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) == 0 {
+		return err
+	}
+	rejected := c.pending[0]
+	c.pending = c.pending[1:]
+	c.drop(rejected.added)
+	err.TradingPairs = c.pairs(rejected.added)
+	return err
+}
+
+// drop removes product IDs from the subscriptions, acknowledged or pending. c.mu must be held.
+func (c *coinbase) drop(productIDs []string) {
+	c.requested = withoutPairs(c.requested, productIDs)
+	for i := range c.pending {
+		c.pending[i].expected = withoutPairs(c.pending[i].expected, productIDs)
+	}
+}
+
+// pairs returns the trading pairs of product IDs, nil if there is none.
+func (c *coinbase) pairs(productIDs []string) []string {
+	var tradingPairs []string
+	for _, productID := range productIDs {
+		tradingPairs = append(tradingPairs, c.names.pair(productID))
+	}
+	return tradingPairs
+}
+
+// heartbeat records the last heartbeat of a product.
+func (c *coinbase) heartbeat(response *models.CoinbaseResponse) error {
+	heartbeat := Heartbeat{
+		ProductID:   c.names.pair(response.ProductID),
+		LastTradeID: response.LastTradeID,
+		ReceivedAt:  time.Now(),
+	}
+	if response.Time != "" {
+		heartbeatTime, err := time.Parse(time.RFC3339Nano, response.Time)
+		if err != nil {
+			return fmt.Errorf("error parsing time %s of heartbeat: %w", response.Time, err)
+		}
+		heartbeat.Time = heartbeatTime
+	}
+
+	c.mu.Lock()
+	c.heartbeats[heartbeat.ProductID] = heartbeat
+	onHeartbeat := c.onHeartbeat
+	c.mu.Unlock()
+
+	if onHeartbeat != nil {
+		onHeartbeat(heartbeat)
+	}
+	return nil
+}
+
+// lastHeartbeat returns the last heartbeat received for a trading pair.
+func (c *coinbase) lastHeartbeat(tradingPair string) (Heartbeat, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	heartbeat, ok := c.heartbeats[tradingPair]
+	return heartbeat, ok
+}
+
+// notify calls onHeartbeat with every heartbeat received from now on.
+func (c *coinbase) notify(onHeartbeat func(heartbeat Heartbeat)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onHeartbeat = onHeartbeat
+}
+
+// coinbaseTrade normalizes a Coinbase match, from the websocket feed or the REST API.
+func coinbaseTrade(response *models.CoinbaseResponse) (*models.Trade, error) {
+	trade := &models.Trade{
+		Venue:     VenueCoinbase,
+		ProductID: response.ProductID,
+		Price:     response.Price,
+		Size:      response.Size,
+		Side:      models.Side(response.Side),
+		TradeID:   response.TradeID,
+	}
+
+	if response.Time != "" {
+		tradeTime, err := time.Parse(time.RFC3339Nano, response.Time)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time %s of trade %d: %w", response.Time, response.TradeID, err)
+		}
+		trade.Time = tradeTime
+	}
+	return trade, nil
+}
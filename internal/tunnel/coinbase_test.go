@@ -0,0 +1,205 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestCoinbase_Decode(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		frame    string
+		snapshot bool
+	}{
+		{`{"type":"match","trade_id":341498074,"side":"sell","size":"0.0000299","price":"29303.35","product_id":"BTC-USD","time":"2022-05-21T09:12:04.862866Z"}`, false},
+		{`{"type":"last_match","trade_id":341498074,"side":"sell","size":"0.0000299","price":"29303.35","product_id":"BTC-USD","time":"2022-05-21T09:12:04.862866Z"}`, true},
+	} {
+		trades, err := newCoinbase().decode([]byte(tt.frame))
+		require.NoError(t, err)
+		require.Len(t, trades, 1)
+		assert.Equal(t, &models.Trade{
+			Venue:     "coinbase",
+			ProductID: "BTC-USD",
+			TradeID:   341498074,
+			Price:     "29303.35",
+			Size:      "0.0000299",
+			Side:      models.SideSell,
+			Time:      time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC),
+			Snapshot:  tt.snapshot,
+		}, trades[0])
+	}
+
+	trades, err := newCoinbase().decode([]byte(`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`))
+	require.NoError(t, err)
+	assert.Empty(t, trades)
+
+	_, err = newCoinbase().decode([]byte(`{"type":"match","trade_id":1,"time":"yesterday"}`))
+	require.Error(t, err)
+}
+
+func TestCoinbase_Decode_Error_ShouldReturnExchangeError(t *testing.T) {
+	t.Parallel()
+
+	_, err := newCoinbase().decode([]byte(`{"type":"error","message":"Failed to subscribe","reason":"BTC-XYZ is not a valid product"}`))
+
+	var exchangeErr *ExchangeError
+	require.True(t, errors.As(err, &exchangeErr))
+	assert.Equal(t, &ExchangeError{Venue: VenueCoinbase, Message: "Failed to subscribe", Reason: "BTC-XYZ is not a valid product"}, exchangeErr)
+}
+
+func TestCoinbase_Decode_Subscriptions_ShouldAcknowledgeRequests(t *testing.T) {
+	requests := make(chan models.CoinbaseRequest, 3)
+	server := setUpWSServer(wsRequests(requests))
+	defer server.Close()
+
+	tunnel, err := NewReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	c := tunnel.(*Receiver).exchange.(*coinbase)
+
+	// Requests are acknowledged in order, each with all the current subscriptions.
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+	require.NoError(t, tunnel.Subscribe([]string{"SOL-USD"}))
+	require.NoError(t, tunnel.Unsubscribe([]string{"ETH-USD"}))
+
+	for _, ack := range []string{
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD","ETH-USD"]}]}`,
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD","ETH-USD","SOL-USD"]}]}`,
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD","SOL-USD"]}]}`,
+	} {
+		_, err = c.decode([]byte(ack))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tunnel.Subscribe([]string{"ETH-USD"}))
+	_, err = c.decode([]byte(`{"type":"subscriptions","channels":[{"name":"heartbeat","product_ids":["ETH-USD"]},{"name":"matches","product_ids":["BTC-USD"]}]}`))
+
+	var exchangeErr *ExchangeError
+	require.True(t, errors.As(err, &exchangeErr))
+	assert.Equal(t, "missing ETH-USD, SOL-USD", exchangeErr.Reason)
+}
+
+func TestCoinbase_Decode_Error_ShouldRejectTheTradingPairsOfTheRequest(t *testing.T) {
+	requests := make(chan models.CoinbaseRequest, 3)
+	server := setUpWSServer(wsRequests(requests))
+	defer server.Close()
+
+	tunnel, err := NewReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	c := tunnel.(*Receiver).exchange.(*coinbase)
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "BTC-XYZ"}))
+	require.NoError(t, tunnel.Subscribe([]string{"ETH-USD"}))
+	_, err = c.decode([]byte(`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`))
+	require.NoError(t, err)
+
+	// The error answers the second request, whose new trading pair is no longer expected by the third one.
+	_, err = c.decode([]byte(`{"type":"error","message":"Failed to subscribe","reason":"BTC-XYZ is not a valid product"}`))
+	var exchangeErr *ExchangeError
+	require.True(t, errors.As(err, &exchangeErr))
+	assert.Equal(t, []string{"BTC-XYZ"}, exchangeErr.TradingPairs)
+
+	_, err = c.decode([]byte(`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD","ETH-USD"]}]}`))
+	require.NoError(t, err)
+}
+
+func TestCoinbase_Decode_Heartbeat_ShouldBeTracked(t *testing.T) {
+	t.Parallel()
+
+	c := newCoinbase()
+	trades, err := c.decode([]byte(`{"type":"heartbeat","sequence":90,"last_trade_id":20,"product_id":"BTC-USD","time":"2022-05-21T09:12:04.862866Z"}`))
+	require.NoError(t, err)
+	assert.Empty(t, trades)
+
+	heartbeat, ok := c.lastHeartbeat("BTC-USD")
+	require.True(t, ok)
+	assert.Equal(t, 20, heartbeat.LastTradeID)
+	assert.Equal(t, time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC), heartbeat.Time)
+	assert.False(t, heartbeat.ReceivedAt.IsZero())
+
+	_, ok = c.lastHeartbeat("ETH-USD")
+	assert.False(t, ok)
+}
+
+func TestReceiver_Read_ShouldStopOnExchangeError(t *testing.T) {
+	server := setUpWSServer(wsReject(t, `{"type":"error","message":"Failed to subscribe","reason":"BTC-XYZ is not a valid product"}`))
+	defer server.Close()
+
+	tunnel, err := NewReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-XYZ"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	select {
+	case _, ok := <-receiver:
+		require.False(t, ok)
+	case <-ctx.Done():
+		require.Fail(t, "receiver channel not closed on an error message")
+	}
+
+	var exchangeErr *ExchangeError
+	require.True(t, errors.As(tunnel.Err(), &exchangeErr))
+	assert.Equal(t, "BTC-XYZ is not a valid product", exchangeErr.Reason)
+}
+
+func TestReceiver_Read_WithRejections_ShouldDropRejectedTradingPairs(t *testing.T) {
+	server := setUpWSServer(wsAnswers(t,
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`,
+		`{"type":"error","message":"Failed to subscribe","reason":"BTC-XYZ is not a valid product"}`,
+		`{"type":"match","trade_id":1,"product_id":"BTC-USD","price":"1","size":"1","side":"buy","time":"2022-05-21T09:12:04.862866Z"}`,
+	))
+	defer server.Close()
+
+	rejected := make(chan *ExchangeError, 1)
+	rejections := NewRejections()
+	rejections.Handle(func(err *ExchangeError) error {
+		rejected <- err
+		return nil
+	})
+	tunnel, err := NewReceiver(webSocketURL, WithRejections(rejections))
+	require.NoError(t, err)
+	defer tunnel.Close()
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-XYZ"}))
+	assert.Equal(t, []string{"BTC-XYZ"}, (<-rejected).TradingPairs)
+
+	// The other trading pairs are still read, the rejected one is no longer subscribed to.
+	require.NoError(t, tunnel.Subscribe([]string{"ETH-USD"}))
+	select {
+	case trade, ok := <-receiver:
+		require.True(t, ok, "stopped reading on a rejection")
+		assert.Equal(t, "BTC-USD", trade.ProductID)
+	case <-ctx.Done():
+		require.Fail(t, "timeout waiting for trade")
+	}
+	r := tunnel.(*Receiver)
+	r.mu.Lock()
+	assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, r.tradingPairs)
+	r.mu.Unlock()
+	require.NoError(t, tunnel.Err())
+}
@@ -0,0 +1,282 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// newTLSWSServer starts a wss:// server, answering subscriptions like wsRequests, configured by configure,
+// and writes the PEM of its certificate to a CA file. The certificate is valid for example.com and 127.0.0.1.
+func newTLSWSServer(t *testing.T, requests chan models.CoinbaseRequest, configure func(config *tls.Config)) (server *httptest.Server, wsURL, caFile string) {
+	server = httptest.NewUnstartedServer(http.HandlerFunc(wsRequests(requests)))
+	server.TLS = &tls.Config{}
+	configure(server.TLS)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	return server, "wss" + strings.TrimPrefix(server.URL, "https"), caFile
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key, returning the certificate as a CA pool.
+func writeClientCertificate(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vwap-engine"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	pool = x509.NewCertPool()
+	pool.AddCert(certificate)
+	return certFile, keyFile, pool
+}
+
+// pipe copies between two connections until either is closed.
+func pipe(a, b net.Conn) {
+	go func() {
+		_, _ = io.Copy(a, b)
+		_ = a.Close()
+	}()
+	_, _ = io.Copy(b, a)
+	_ = b.Close()
+}
+
+// newConnectProxy starts an HTTP CONNECT proxy, sending the address of every tunnel to the tunnels channel.
+func newConnectProxy(t *testing.T, tunnels chan string) *httptest.Server {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		tunnels <- r.Host
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = target.Close()
+			return
+		}
+		pipe(conn, target)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// newSOCKS5Proxy starts a SOCKS5 proxy without authentication, sending the address of every tunnel to the
+// tunnels channel.
+func newSOCKS5Proxy(t *testing.T, tunnels chan string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				reader := bufio.NewReader(conn)
+				// greeting: version, methods count and methods, answered with no authentication
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(reader, header); err != nil {
+					_ = conn.Close()
+					return
+				}
+				if _, err := io.ReadFull(reader, make([]byte, header[1])); err != nil {
+					_ = conn.Close()
+					return
+				}
+				_, _ = conn.Write([]byte{5, 0})
+
+				// request: version, connect, reserved, then an IPv4 address or a domain name, and a port
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(reader, request); err != nil {
+					_ = conn.Close()
+					return
+				}
+				var host string
+				switch request[3] {
+				case 1:
+					ip := make([]byte, 4)
+					_, _ = io.ReadFull(reader, ip)
+					host = net.IP(ip).String()
+				case 3:
+					length, _ := reader.ReadByte()
+					name := make([]byte, length)
+					_, _ = io.ReadFull(reader, name)
+					host = string(name)
+				}
+				port := make([]byte, 2)
+				_, _ = io.ReadFull(reader, port)
+				address := net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port)))
+
+				target, err := net.Dial("tcp", address)
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					_ = conn.Close()
+					return
+				}
+				tunnels <- address
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				pipe(conn, target)
+			}(conn)
+		}
+	}()
+	return listener
+}
+
+// subscribeThrough dials wsURL with the dialer of cfg, subscribes to BTC-USD and waits for the server to receive it.
+func subscribeThrough(t *testing.T, cfg DialerConfig, wsURL string, requests chan models.CoinbaseRequest) error {
+	dialer, err := NewDialer(cfg)
+	require.NoError(t, err)
+
+	tunnel, err := NewReceiver(wsURL, WithDialer(dialer))
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	select {
+	case request := <-requests:
+		assert.Equal(t, []string{"BTC-USD"}, request.ProductIDs)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "subscription not received")
+	}
+	return nil
+}
+
+func TestNewDialer_TLS(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan models.CoinbaseRequest, 1)
+	_, wsURL, caFile := newTLSWSServer(t, requests, func(*tls.Config) {})
+
+	require.NoError(t, subscribeThrough(t, DialerConfig{CAFile: caFile}, wsURL, requests))
+	require.NoError(t, subscribeThrough(t, DialerConfig{CAFile: caFile, ServerName: "example.com"}, wsURL, requests))
+
+	for name, cfg := range map[string]DialerConfig{
+		"unknown CA":     {},
+		"unverified SNI": {CAFile: caFile, ServerName: "exchange.invalid"},
+	} {
+		err := subscribeThrough(t, cfg, wsURL, requests)
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), "certificate", name)
+	}
+}
+
+func TestNewDialer_TLSMinVersion(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan models.CoinbaseRequest, 1)
+	_, wsURL, caFile := newTLSWSServer(t, requests, func(config *tls.Config) {
+		config.MaxVersion = tls.VersionTLS12
+	})
+
+	require.NoError(t, subscribeThrough(t, DialerConfig{CAFile: caFile, TLSMinVersion: "1.2"}, wsURL, requests))
+	require.Error(t, subscribeThrough(t, DialerConfig{CAFile: caFile, TLSMinVersion: "1.3"}, wsURL, requests))
+}
+
+func TestNewDialer_ClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile, pool := writeClientCertificate(t)
+	requests := make(chan models.CoinbaseRequest, 1)
+	_, wsURL, caFile := newTLSWSServer(t, requests, func(config *tls.Config) {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = pool
+	})
+
+	require.NoError(t, subscribeThrough(t, DialerConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, wsURL, requests))
+	require.Error(t, subscribeThrough(t, DialerConfig{CAFile: caFile}, wsURL, requests))
+}
+
+func TestNewDialer_Proxy(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan models.CoinbaseRequest, 1)
+	server, wsURL, caFile := newTLSWSServer(t, requests, func(*tls.Config) {})
+	target := strings.TrimPrefix(server.URL, "https://")
+
+	tunnels := make(chan string, 2)
+	connectProxy := newConnectProxy(t, tunnels)
+	socksProxy := newSOCKS5Proxy(t, tunnels)
+
+	for _, proxyURL := range []string{connectProxy.URL, "socks5://" + socksProxy.Addr().String()} {
+		require.NoError(t, subscribeThrough(t, DialerConfig{ProxyURL: proxyURL, CAFile: caFile}, wsURL, requests), proxyURL)
+		assert.Equal(t, target, <-tunnels, proxyURL)
+	}
+}
+
+func TestNewDialer_InvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	certFile, _, _ := writeClientCertificate(t)
+	for name, cfg := range map[string]DialerConfig{
+		"proxy scheme":            {ProxyURL: "ftp://proxy:21"},
+		"missing CA file":         {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"CA file without PEM":     {CAFile: writeFile(t, "not a certificate")},
+		"TLS min version":         {TLSMinVersion: "1.4"},
+		"certificate without key": {CertFile: certFile},
+	} {
+		_, err := NewDialer(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
@@ -0,0 +1,113 @@
+package tunnel
+
+import (
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	// VenueCoinbase is the venue of the trades of the Coinbase matches channel.
+	VenueCoinbase = "coinbase"
+	// VenueBinance is the venue of the trades of the Binance trade streams.
+	VenueBinance = "binance"
+	// VenueKraken is the venue of the trades of the Kraken v2 trade channel.
+	VenueKraken = "kraken"
+)
+
+// exchange adapts a Receiver to the websocket protocol of an exchange, so every exchange shares the Receiver
+// reconnect, resubscribe and recording logic.
+type exchange interface {
+	// venue returns the name of the exchange, e.g. coinbase.
+	venue() string
+
+	// symbols maps our trading pairs to the symbols of the exchange and back.
+	symbols() *symbols
+
+	// endpoint returns the URL to dial to receive the trades of the trading pairs.
+	endpoint(websocketUrl string, tradingPairs []string) string
+
+	// reset forgets the state of the previous connection, once a new one is dialed.
+	reset()
+
+	// subscribe sends the subscribe request of the trading pairs on a new connection, if the exchange needs one.
+	subscribe(conn *ws.Conn, tradingPairs []string) error
+
+	// unsubscribe stops receiving the trades of the trading pairs on an open connection.
+	unsubscribe(conn *ws.Conn, tradingPairs []string) error
+
+	// decode converts a raw frame to the normalized trades it holds, none for frames without trade.
+	// Exchanges batching trades return them in the order of the batch. The frame may be reused once decode returns,
+	// and so may the returned slice, but not the trades.
+	decode(frame []byte) ([]*models.Trade, error)
+}
+
+// ExchangeError is an error message sent by an exchange, e.g. the rejection of a subscription to an invalid product.
+// A Receiver stops reading once it receives one, and returns it from Err, unless its Rejections drop the trading
+// pairs it rejects.
+type ExchangeError struct {
+	Venue   string
+	Message string
+	Reason  string
+	// TradingPairs are the trading pairs whose subscription is rejected, when the exchange tells them.
+	TradingPairs []string
+}
+
+func (e *ExchangeError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%s error: %s", e.Venue, e.Message)
+	}
+	return fmt.Sprintf("%s error: %s: %s", e.Venue, e.Message, e.Reason)
+}
+
+// newExchange returns the protocol of a venue.
+func newExchange(venue string) (exchange, error) {
+	switch venue {
+	case VenueCoinbase:
+		return newCoinbase(), nil
+	case VenueBinance:
+		return newBinance(), nil
+	case VenueKraken:
+		return newKraken(), nil
+	default:
+		return nil, fmt.Errorf("unsupported venue %q", venue)
+	}
+}
+
+// Rejections handles the ExchangeErrors rejecting trading pairs, e.g. an invalid product subscribed to at runtime,
+// so that a Receiver drops them and keeps reading the others. It is shared by the receivers of every venue.
+type Rejections struct {
+	mu      sync.Mutex
+	handler func(err *ExchangeError) error
+}
+
+// NewRejections returns Rejections stopping the receivers, until a handler is set.
+func NewRejections() *Rejections {
+	return &Rejections{}
+}
+
+// Handle sets the handler of the rejections. It returns an error to stop the Receiver on the rejection, nil to drop
+// the trading pairs rejected.
+func (r *Rejections) Handle(handler func(err *ExchangeError) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handler = handler
+}
+
+// reject returns the error a rejection stops the Receiver on, nil if its trading pairs are dropped.
+func (r *Rejections) reject(err *ExchangeError) error {
+	r.mu.Lock()
+	handler := r.handler
+	r.mu.Unlock()
+
+	if handler == nil || len(err.TradingPairs) == 0 {
+		return err
+	}
+	return handler(err)
+}
@@ -0,0 +1,34 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestNewExchange(t *testing.T) {
+	t.Parallel()
+
+	for _, venue := range []string{VenueCoinbase, VenueBinance, VenueKraken} {
+		_, err := newExchange(venue)
+		require.NoError(t, err)
+	}
+
+	_, err := newExchange("mtgox")
+	require.Error(t, err)
+}
+
+func TestExchangeError_Error(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "coinbase error: Failed to subscribe: BTC-XYZ is not a valid product",
+		(&ExchangeError{Venue: VenueCoinbase, Message: "Failed to subscribe", Reason: "BTC-XYZ is not a valid product"}).Error())
+	assert.Equal(t, "kraken error: subscribe request failed",
+		(&ExchangeError{Venue: VenueKraken, Message: "subscribe request failed"}).Error())
+}
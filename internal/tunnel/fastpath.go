@@ -0,0 +1,216 @@
+package tunnel
+
+import (
+	"bytes"
+	ws "github.com/gorilla/websocket"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// maxScannedDigits is the longest integer scanned without overflowing, longer ones are left to encoding/json.
+const maxScannedDigits = 18
+
+// coinbaseFrame holds the fields of a Coinbase message needed for its trade, scanned from a frame without
+// reflection nor allocation. The byte slices point into the frame, so they are only valid until it is reused.
+// Decoding a match isn't allocation-free though: the trade handed to the pipeline, and the string of its price and
+// size, are allocated for every match.
+type coinbaseFrame struct {
+	typ       []byte
+	productID []byte
+	price     []byte
+	size      []byte
+	side      []byte
+	time      []byte
+	tradeID   int
+}
+
+// scan reads the fields of a frame holding a JSON object. It returns false when the frame can't be read on the fast
+// path, e.g. an escaped string, a null field or invalid JSON: it is then left to encoding/json, which reports the
+// error, if any. Other fields are skipped.
+func (f *coinbaseFrame) scan(frame []byte) bool {
+	*f = coinbaseFrame{}
+
+	i := skipSpace(frame, 0)
+	if i == len(frame) || frame[i] != '{' {
+		return false
+	}
+	i = skipSpace(frame, i+1)
+	if i < len(frame) && frame[i] == '}' {
+		return skipSpace(frame, i+1) == len(frame)
+	}
+
+	for {
+		key, next, ok := scanString(frame, i)
+		if !ok {
+			return false
+		}
+		i = skipSpace(frame, next)
+		if i == len(frame) || frame[i] != ':' {
+			return false
+		}
+		i = skipSpace(frame, i+1)
+
+		switch string(key) {
+		case "type":
+			f.typ, i, ok = scanString(frame, i)
+		case "product_id":
+			f.productID, i, ok = scanString(frame, i)
+		case "price":
+			f.price, i, ok = scanString(frame, i)
+		case "size":
+			f.size, i, ok = scanString(frame, i)
+		case "side":
+			f.side, i, ok = scanString(frame, i)
+		case "time":
+			f.time, i, ok = scanString(frame, i)
+		case "trade_id":
+			f.tradeID, i, ok = scanInt(frame, i)
+		default:
+			i, ok = skipValue(frame, i)
+		}
+		if !ok {
+			return false
+		}
+
+		i = skipSpace(frame, i)
+		if i == len(frame) {
+			return false
+		}
+		switch frame[i] {
+		case ',':
+			i = skipSpace(frame, i+1)
+		case '}':
+			return skipSpace(frame, i+1) == len(frame)
+		default:
+			return false
+		}
+	}
+}
+
+// skipSpace returns the index of the first non-space byte from i.
+func skipSpace(frame []byte, i int) int {
+	for i < len(frame) && (frame[i] == ' ' || frame[i] == '\t' || frame[i] == '\n' || frame[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// scanString returns the content of the string starting at i and the index following it. Strings with escapes or
+// control characters aren't scanned.
+func scanString(frame []byte, i int) ([]byte, int, bool) {
+	if i == len(frame) || frame[i] != '"' {
+		return nil, i, false
+	}
+	for j := i + 1; j < len(frame); j++ {
+		switch c := frame[j]; {
+		case c == '"':
+			return frame[i+1 : j], j + 1, true
+		case c == '\\' || c < ' ':
+			return nil, i, false
+		}
+	}
+	return nil, i, false
+}
+
+// scanInt returns the integer starting at i and the index following it. Numbers with a fraction or an exponent, and
+// those too long to fit, aren't scanned.
+func scanInt(frame []byte, i int) (int, int, bool) {
+	start := i
+	negative := i < len(frame) && frame[i] == '-'
+	if negative {
+		i++
+	}
+	digits := i
+
+	value := 0
+	for ; i < len(frame) && frame[i] >= '0' && frame[i] <= '9'; i++ {
+		value = value*10 + int(frame[i]-'0')
+	}
+	switch {
+	case i == digits || i-digits > maxScannedDigits:
+		return 0, start, false
+	case frame[digits] == '0' && i-digits > 1:
+		return 0, start, false
+	case i < len(frame) && (frame[i] == '.' || frame[i] == 'e' || frame[i] == 'E'):
+		return 0, start, false
+	}
+	if negative {
+		value = -value
+	}
+	return value, i, true
+}
+
+// skipValue returns the index following the value starting at i: a string, a number, a literal, or an array or
+// object whose strings are skipped with their escapes.
+func skipValue(frame []byte, i int) (int, bool) {
+	if i == len(frame) {
+		return i, false
+	}
+
+	switch c := frame[i]; {
+	case c == '"':
+		for j := i + 1; j < len(frame); j++ {
+			switch frame[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1, true
+			}
+		}
+		return i, false
+
+	case c == '{' || c == '[':
+		depth := 0
+		for j := i; j < len(frame); j++ {
+			switch frame[j] {
+			case '"':
+				end, ok := skipValue(frame, j)
+				if !ok {
+					return i, false
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, true
+				}
+			}
+		}
+		return i, false
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		j := i + 1
+		for j < len(frame) && (frame[j] >= '0' && frame[j] <= '9' || frame[j] == '.' || frame[j] == 'e' ||
+			frame[j] == 'E' || frame[j] == '+' || frame[j] == '-') {
+			j++
+		}
+		return j, true
+
+	default:
+		for _, literal := range [...]string{"true", "false", "null"} {
+			if len(frame)-i >= len(literal) && string(frame[i:i+len(literal)]) == literal {
+				return i + len(literal), true
+			}
+		}
+		return i, false
+	}
+}
+
+// readFrame reads the next data frame of conn into buffer, reused from a frame to another instead of allocating one
+// per frame as conn.ReadMessage does. The frame is only valid until the buffer is reused.
+func readFrame(conn *ws.Conn, buffer *bytes.Buffer) ([]byte, error) {
+	_, reader, err := conn.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	buffer.Reset()
+	if _, err = buffer.ReadFrom(reader); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
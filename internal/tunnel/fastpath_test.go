@@ -0,0 +1,161 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// matchFrame is a match as sent by the Coinbase matches channel.
+const matchFrame = `{"type":"match","trade_id":341498074,"maker_order_id":"ac928c66-ca53-498f-9c13-a110027a60e8",` +
+	`"taker_order_id":"132fb6ae-456b-4654-b4e0-d681ac05cea1","side":"sell","size":"0.0000299","price":"29303.35",` +
+	`"product_id":"BTC-USD","sequence":38312302045,"time":"2022-05-21T09:12:04.862866Z"}`
+
+func TestCoinbaseFrame_Scan(t *testing.T) {
+	t.Parallel()
+
+	var f coinbaseFrame
+	require.True(t, f.scan([]byte(matchFrame)))
+	assert.Equal(t, "match", string(f.typ))
+	assert.Equal(t, "BTC-USD", string(f.productID))
+	assert.Equal(t, "29303.35", string(f.price))
+	assert.Equal(t, "0.0000299", string(f.size))
+	assert.Equal(t, "sell", string(f.side))
+	assert.Equal(t, "2022-05-21T09:12:04.862866Z", string(f.time))
+	assert.Equal(t, 341498074, f.tradeID)
+
+	for frame, ok := range map[string]bool{
+		` { "type" : "match" , "trade_id" : -1 } `: true,
+		`{}`: true,
+		`{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`: true,
+		`{"type":"match","flags":[true,false,null,{"a":"\"}"}],"x":1.5e3}`:                   true,
+		`{"type":"match","product_id":"BTC\u002dUSD"}`:                                       false,
+		`{"type":"match","time":null}`:                                                       false,
+		`{"type":"match","trade_id":1.0}`:                                                    false,
+		`{"type":"match","trade_id":01}`:                                                     false,
+		`{"type":"match","trade_id":"1"}`:                                                    false,
+		`{"type":"match","trade_id":1234567890123456789}`:                                    false,
+		`{"type":"match",}`:                                                                  false,
+		`{"type":"match"`:                                                                    false,
+		`{"type":"match"} {}`:                                                                false,
+		`{"type":"match","x":nope}`:                                                          false,
+		`["match"]`:                                                                          false,
+		``:                                                                                   false,
+	} {
+		assert.Equal(t, ok, f.scan([]byte(frame)), frame)
+	}
+}
+
+func TestCoinbase_Decode_ShouldMatchJSONDecoding(t *testing.T) {
+	t.Parallel()
+
+	for _, frame := range []string{
+		matchFrame,
+		`{"type":"last_match","trade_id":1,"product_id":"ETH-USD","size":"1","price":"2000","side":"buy"}`,
+		`{"type":"match","trade_id":2,"product_id":"SOL-USD","price":"","side":"sideways"}`,
+		`{"type":"match","trade_id":3,"product_id":"BTC-USD","size":"1","price":"1"}`,
+	} {
+		fast, err := newCoinbase().decode([]byte(frame))
+		require.NoError(t, err, frame)
+		decoded, err := newCoinbase().decodeJSON([]byte(frame))
+		require.NoError(t, err, frame)
+		assert.Equal(t, decoded, fast, frame)
+	}
+
+	_, err := newCoinbase().decode([]byte(`{"type":"match","trade_id":1,"time":"yesterday"}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error parsing time yesterday of trade 1")
+}
+
+func TestCoinbase_Decode_ShouldNotAllocateButTheTrade(t *testing.T) {
+	c := newCoinbase()
+	c.names.venue("BTC-USD")
+	frame := []byte(matchFrame)
+
+	var f coinbaseFrame
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		f.scan(frame)
+	}))
+	// The trade, and the string holding its price and size.
+	assert.Equal(t, 2.0, testing.AllocsPerRun(100, func() {
+		_, _ = c.decode(frame)
+	}))
+}
+
+// BenchmarkCoinbase_Decode compares the fast path with encoding/json decoding the same match.
+func BenchmarkCoinbase_Decode(b *testing.B) {
+	frame := []byte(matchFrame)
+	for name, decode := range map[string]func(c *coinbase) ([]*models.Trade, error){
+		"fast path":     func(c *coinbase) ([]*models.Trade, error) { return c.decode(frame) },
+		"encoding/json": func(c *coinbase) ([]*models.Trade, error) { return c.decodeJSON(frame) },
+	} {
+		b.Run(name, func(b *testing.B) {
+			c := newCoinbase()
+			c.names.venue("BTC-USD")
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decode(c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// toPoint converts a trade to the data point pushed onto the VWAP storage, as the app does with float arithmetic.
+func toPoint(trade *models.Trade) (storage.Point, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+	quantity, err := strconv.ParseFloat(trade.Size, 64)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewTimedPoint(price, quantity, trade.ProductID, trade.Time), nil
+}
+
+// BenchmarkCoinbase_FrameToPoint compares the whole path of a match, from its frame to its data point, on the fast
+// path and on the previous one: websocket.Conn.ReadJSON decoding a fresh models.CoinbaseResponse.
+func BenchmarkCoinbase_FrameToPoint(b *testing.B) {
+	frame := []byte(matchFrame)
+	for name, decode := range map[string]func(c *coinbase) ([]*models.Trade, error){
+		"fast path": func(c *coinbase) ([]*models.Trade, error) { return c.decode(frame) },
+		"ReadJSON": func(c *coinbase) ([]*models.Trade, error) {
+			response := &models.CoinbaseResponse{}
+			if err := json.NewDecoder(bytes.NewReader(frame)).Decode(response); err != nil {
+				return nil, err
+			}
+			trade, err := coinbaseTrade(response)
+			return []*models.Trade{trade}, err
+		},
+	} {
+		b.Run(name, func(b *testing.B) {
+			c := newCoinbase()
+			c.names.venue("BTC-USD")
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				trades, err := decode(c)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err = toPoint(trades[0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
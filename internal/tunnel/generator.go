@@ -0,0 +1,353 @@
+package tunnel
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	// defaultSyntheticPrice is the first price of the trading pairs without one in GeneratorConfig.Prices.
+	defaultSyntheticPrice = 100
+	// secondsPerYear converts the time between two trades to the unit of the annualized drift and volatility.
+	secondsPerYear = 365 * 24 * 60 * 60
+	// pacingSlack is how far ahead of the generated trades time may run before the Generator sleeps, so that
+	// high rates are sent in batches rather than one timer per trade.
+	pacingSlack = time.Millisecond
+)
+
+// GeneratorConfig configures the synthetic trades of a Generator.
+type GeneratorConfig struct {
+	// Venue the trades are stamped with, e.g. coinbase.
+	Venue string
+	// Seed makes the trades of every trading pair the same from a run to another.
+	Seed int64
+	// Start is the exchange time of the first trades, the time Read is called at when zero.
+	Start time.Time
+	// Rate is the average number of trades per second of every trading pair, arriving as a Poisson process.
+	Rate float64
+	// Speed scales the pace of the trades: 1 sends them in real time, N times faster, or 0 as fast as the consumer
+	// reads. Their exchange time is the same whatever the speed.
+	Speed float64
+	// Prices are the first prices of trading pairs, defaultSyntheticPrice for the others.
+	Prices map[string]float64
+	// Drift and Volatility are the annualized drift and volatility of the geometric random walk of the prices,
+	// e.g. 0 and 0.8.
+	Drift      float64
+	Volatility float64
+	// MedianSize and SizeSigma are the median and the log standard deviation of the lognormal trade sizes.
+	MedianSize float64
+	SizeSigma  float64
+	// BuyRatio is the share of trades whose maker side is buy, e.g. 0.5.
+	BuyRatio float64
+	// BurstProbability is the probability that a trade starts a burst of BurstLength trades, arriving BurstFactor
+	// times faster than Rate.
+	BurstProbability float64
+	BurstLength      int
+	BurstFactor      float64
+}
+
+// DefaultGeneratorConfig is a Coinbase-like feed of 1000 trades per second per trading pair, in real time.
+var DefaultGeneratorConfig = GeneratorConfig{
+	Venue:            VenueCoinbase,
+	Seed:             1,
+	Rate:             1000,
+	Speed:            1,
+	Volatility:       0.8,
+	MedianSize:       0.05,
+	SizeSigma:        1,
+	BuyRatio:         0.5,
+	BurstProbability: 0.001,
+	BurstLength:      100,
+	BurstFactor:      10,
+}
+
+// Generator is a Tunnel generating synthetic trades for the subscribed trading pairs, without network, to load
+// and soak test the engine. Prices follow a geometric random walk, sizes are lognormal, and trades arrive as a
+// Poisson process with occasional bursts.
+// Every trading pair has its own random source derived from the seed, so the trades of a trading pair, exchange time
+// included when Start is set, are the same from a run to another whatever the other trading pairs.
+type Generator struct {
+	cfg GeneratorConfig
+
+	mu sync.Mutex
+	// pairs are the states of the trading pairs ever subscribed to, kept when unsubscribed so that their
+	// trade IDs carry on once subscribed again.
+	pairs      map[string]*syntheticPair
+	subscribed map[string]bool
+	// version is incremented on every subscription change, for Read to pick it up.
+	version int
+	done    chan struct{}
+	once    sync.Once
+}
+
+// syntheticPair is the state of the trades of a trading pair.
+type syntheticPair struct {
+	productID string
+	random    *rand.Rand
+	logPrice  float64
+	decimals  int
+	tradeID   int
+	// next is the time of the next trade, since Start.
+	next time.Duration
+	// burst is the number of trades left in the current burst.
+	burst int
+}
+
+// NewGenerator creates a Generator of the trades configured by cfg.
+func NewGenerator(cfg GeneratorConfig) (Tunnel, error) {
+	if _, err := newExchange(cfg.Venue); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.Rate <= 0:
+		return nil, fmt.Errorf("invalid synthetic rate %v: must be positive", cfg.Rate)
+	case cfg.Speed < 0:
+		return nil, fmt.Errorf("invalid synthetic speed %v: must be positive, or 0 for maximum speed", cfg.Speed)
+	case cfg.Volatility < 0:
+		return nil, fmt.Errorf("invalid synthetic volatility %v: must be positive", cfg.Volatility)
+	case cfg.MedianSize <= 0 || cfg.SizeSigma < 0:
+		return nil, fmt.Errorf("invalid synthetic sizes: median %v must be positive and sigma %v positive", cfg.MedianSize, cfg.SizeSigma)
+	case cfg.BuyRatio < 0 || cfg.BuyRatio > 1:
+		return nil, fmt.Errorf("invalid synthetic buy ratio %v: must be between 0 and 1", cfg.BuyRatio)
+	case cfg.BurstProbability < 0 || cfg.BurstProbability > 1:
+		return nil, fmt.Errorf("invalid synthetic burst probability %v: must be between 0 and 1", cfg.BurstProbability)
+	case cfg.BurstProbability > 0 && (cfg.BurstLength < 1 || cfg.BurstFactor <= 0):
+		return nil, fmt.Errorf("invalid synthetic bursts of %d trades %v times faster", cfg.BurstLength, cfg.BurstFactor)
+	}
+	for tradingPair, price := range cfg.Prices {
+		if price <= 0 {
+			return nil, fmt.Errorf("invalid synthetic price %v of %s: must be positive", price, tradingPair)
+		}
+	}
+
+	return &Generator{
+		cfg:        cfg,
+		pairs:      make(map[string]*syntheticPair),
+		subscribed: make(map[string]bool),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Subscribe starts generating the trades of the trading pairs (productIDs).
+func (g *Generator) Subscribe(tradingPairs []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, tradingPair := range tradingPairs {
+		if _, ok := g.pairs[tradingPair]; !ok {
+			g.pairs[tradingPair] = g.newPair(tradingPair)
+		}
+		g.subscribed[tradingPair] = true
+	}
+	g.version++
+	return nil
+}
+
+// Unsubscribe stops generating the trades of the trading pairs.
+func (g *Generator) Unsubscribe(tradingPairs []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, tradingPair := range tradingPairs {
+		delete(g.subscribed, tradingPair)
+	}
+	g.version++
+	return nil
+}
+
+// newPair creates the state of a trading pair, with a random source seeded from the seed and the trading pair.
+func (g *Generator) newPair(tradingPair string) *syntheticPair {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(tradingPair))
+
+	price, ok := g.cfg.Prices[tradingPair]
+	if !ok {
+		price = defaultSyntheticPrice
+	}
+	// Prices keep 7 significant digits of the first price, at least cents.
+	decimals := 6 - int(math.Floor(math.Log10(price)))
+	if decimals < 2 {
+		decimals = 2
+	}
+
+	return &syntheticPair{
+		productID: tradingPair,
+		random:    rand.New(rand.NewSource(g.cfg.Seed ^ int64(hash.Sum64()))),
+		logPrice:  math.Log(price),
+		decimals:  decimals,
+	}
+}
+
+// Read sends the trades of the subscribed trading pairs to the receiver channel, in exchange time order, until ctx is
+// done or the Generator is closed, and then closes the channel.
+func (g *Generator) Read(ctx context.Context, receiver chan *models.Trade) {
+	go func() {
+		defer close(receiver)
+
+		started := time.Now()
+		start := g.cfg.Start
+		if start.IsZero() {
+			start = started
+		}
+
+		var queue syntheticQueue
+		// now is the time of the last trade sent, since start.
+		var now time.Duration
+		version := -1
+		for {
+			g.mu.Lock()
+			if version != g.version {
+				queue = g.queue(now)
+				version = g.version
+			}
+			g.mu.Unlock()
+
+			if len(queue) == 0 {
+				// Nothing subscribed, wait for a subscription. Time goes on meanwhile.
+				if g.wait(ctx, time.Now().Add(10*time.Millisecond)) != nil {
+					return
+				}
+				if g.cfg.Speed > 0 {
+					now = time.Duration(float64(time.Since(started)) * g.cfg.Speed)
+				}
+				continue
+			}
+
+			pair := queue[0]
+			now = pair.next
+			if g.cfg.Speed > 0 {
+				due := started.Add(time.Duration(float64(pair.next) / g.cfg.Speed))
+				if time.Until(due) > pacingSlack && g.wait(ctx, due) != nil {
+					return
+				}
+			}
+
+			trade := g.trade(pair, start)
+			heap.Fix(&queue, 0)
+			select {
+			case receiver <- trade:
+			case <-ctx.Done():
+				return
+			case <-g.done:
+				return
+			}
+		}
+	}()
+}
+
+// queue returns the subscribed trading pairs ordered by the time of their next trade, now at the earliest: those
+// subscribed again don't catch up on the time they were unsubscribed for. g.mu must be held.
+func (g *Generator) queue(now time.Duration) syntheticQueue {
+	queue := make(syntheticQueue, 0, len(g.subscribed))
+	for tradingPair := range g.subscribed {
+		pair := g.pairs[tradingPair]
+		if pair.next < now {
+			pair.next = now
+		}
+		queue = append(queue, pair)
+	}
+	heap.Init(&queue)
+	return queue
+}
+
+// wait sleeps until a time. It returns an error once ctx is done or the Generator is closed.
+func (g *Generator) wait(ctx context.Context, until time.Time) error {
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-g.done:
+		return errReceiverClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+// trade generates the next trade of a trading pair, at its next time since start, and draws the time of the one after.
+func (g *Generator) trade(pair *syntheticPair, start time.Time) *models.Trade {
+	random := pair.random
+
+	// Time between two trades, exponential for a Poisson process, shorter during a burst.
+	rate := g.cfg.Rate
+	if pair.burst == 0 && g.cfg.BurstProbability > 0 && random.Float64() < g.cfg.BurstProbability {
+		pair.burst = g.cfg.BurstLength
+	}
+	if pair.burst > 0 {
+		rate *= g.cfg.BurstFactor
+		pair.burst--
+	}
+	interval := random.ExpFloat64() / rate
+
+	// Geometric Brownian motion over the interval.
+	years := interval / secondsPerYear
+	pair.logPrice += (g.cfg.Drift-g.cfg.Volatility*g.cfg.Volatility/2)*years + g.cfg.Volatility*math.Sqrt(years)*random.NormFloat64()
+	size := math.Exp(math.Log(g.cfg.MedianSize) + g.cfg.SizeSigma*random.NormFloat64())
+	side := models.SideSell
+	if random.Float64() < g.cfg.BuyRatio {
+		side = models.SideBuy
+	}
+
+	pair.tradeID++
+	trade := &models.Trade{
+		Venue:      g.cfg.Venue,
+		ProductID:  pair.productID,
+		Price:      strconv.FormatFloat(math.Exp(pair.logPrice), 'f', pair.decimals, 64),
+		Size:       strconv.FormatFloat(size, 'f', 8, 64),
+		Side:       side,
+		TradeID:    pair.tradeID,
+		Time:       start.Add(pair.next),
+		ReceivedAt: time.Now(),
+	}
+	pair.next += time.Duration(interval * float64(time.Second))
+	return trade
+}
+
+// Err returns nil: the Generator never fails.
+func (g *Generator) Err() error {
+	return nil
+}
+
+// Close stops generating trades.
+func (g *Generator) Close() {
+	g.once.Do(func() { close(g.done) })
+	log.Printf("Generator closed")
+}
+
+// syntheticQueue is a min-heap of trading pairs by the time of their next trade, then by product ID so that the
+// order of the trades doesn't depend on the order of the subscriptions.
+type syntheticQueue []*syntheticPair
+
+func (q syntheticQueue) Len() int { return len(q) }
+
+func (q syntheticQueue) Less(i, j int) bool {
+	if q[i].next != q[j].next {
+		return q[i].next < q[j].next
+	}
+	return q[i].productID < q[j].productID
+}
+
+func (q syntheticQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *syntheticQueue) Push(x interface{}) { *q = append(*q, x.(*syntheticPair)) }
+
+func (q *syntheticQueue) Pop() interface{} {
+	old := *q
+	pair := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return pair
+}
@@ -0,0 +1,253 @@
+package tunnel
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+var generatorStart = time.Date(2022, 5, 21, 9, 12, 0, 0, time.UTC)
+
+// generate reads count trades of the trading pairs generated at maximum speed with cfg.
+func generate(t testing.TB, cfg GeneratorConfig, count int, tradingPairs ...string) []*models.Trade {
+	cfg.Start = generatorStart
+	cfg.Speed = 0
+	generator, err := NewGenerator(cfg)
+	require.NoError(t, err)
+	require.NoError(t, generator.Subscribe(tradingPairs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	generator.Read(ctx, receiver)
+
+	trades := make([]*models.Trade, 0, count)
+	for trade := range receiver {
+		trades = append(trades, trade)
+		if len(trades) == count {
+			generator.Close()
+			break
+		}
+	}
+	return trades
+}
+
+func TestGenerator_Read_ShouldBeDeterministic(t *testing.T) {
+	t.Parallel()
+
+	key := func(trade *models.Trade) string {
+		return trade.ProductID + " " + strconv.Itoa(trade.TradeID) + " " + trade.Price + " " + trade.Size + " " +
+			string(trade.Side) + " " + trade.Time.Format(time.RFC3339Nano)
+	}
+	keys := func(trades []*models.Trade, productID string) []string {
+		var result []string
+		for _, trade := range trades {
+			if trade.ProductID == productID {
+				result = append(result, key(trade))
+			}
+		}
+		return result
+	}
+
+	first := generate(t, DefaultGeneratorConfig, 1000, "BTC-USD", "ETH-USD")
+	second := generate(t, DefaultGeneratorConfig, 1000, "ETH-USD", "BTC-USD")
+	assert.Equal(t, keys(first, "BTC-USD"), keys(second, "BTC-USD"))
+	assert.Equal(t, keys(first, "ETH-USD"), keys(second, "ETH-USD"))
+
+	// The trades of a trading pair don't depend on the others.
+	alone := generate(t, DefaultGeneratorConfig, 200, "BTC-USD")
+	assert.Equal(t, keys(alone, "BTC-USD"), keys(first, "BTC-USD")[:200])
+
+	cfg := DefaultGeneratorConfig
+	cfg.Seed = 2
+	assert.NotEqual(t, keys(generate(t, cfg, 200, "BTC-USD"), "BTC-USD"), keys(alone, "BTC-USD"))
+}
+
+func TestGenerator_Read_ShouldGenerateRealisticTrades(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultGeneratorConfig
+	cfg.Prices = map[string]float64{"BTC-USD": 30000, "ETH-BTC": 0.07}
+	cfg.BuyRatio = 0.7
+	cfg.BurstProbability = 0
+	trades := generate(t, cfg, 20000, "BTC-USD", "ETH-BTC")
+
+	last := map[string]int{}
+	var previous time.Time
+	buys := 0
+	var logSizes []float64
+	for _, trade := range trades {
+		assert.Equal(t, VenueCoinbase, trade.Venue)
+		// Trades are sent in exchange time order, with sequential trade IDs per trading pair.
+		assert.False(t, trade.Time.Before(previous))
+		previous = trade.Time
+		assert.Equal(t, last[trade.ProductID]+1, trade.TradeID)
+		last[trade.ProductID] = trade.TradeID
+
+		price, err := strconv.ParseFloat(trade.Price, 64)
+		require.NoError(t, err)
+		if trade.ProductID == "BTC-USD" {
+			assert.InEpsilon(t, 30000, price, 0.05)
+		} else {
+			assert.InEpsilon(t, 0.07, price, 0.05)
+			assert.Len(t, trade.Price, len("0.07000000"))
+		}
+
+		size, err := strconv.ParseFloat(trade.Size, 64)
+		require.NoError(t, err)
+		logSizes = append(logSizes, math.Log(size))
+		if trade.Side == models.SideBuy {
+			buys++
+		}
+	}
+
+	assert.InDelta(t, 0.7, float64(buys)/float64(len(trades)), 0.02)
+	mean := 0.0
+	for _, logSize := range logSizes {
+		mean += logSize
+	}
+	mean /= float64(len(logSizes))
+	assert.InEpsilon(t, cfg.MedianSize, math.Exp(mean), 0.05)
+
+	// 1000 trades per second per trading pair.
+	elapsed := previous.Sub(generatorStart).Seconds()
+	assert.InEpsilon(t, 10, elapsed, 0.1)
+}
+
+func TestGenerator_Read_ShouldBurst(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultGeneratorConfig
+	cfg.BurstProbability = 1
+	cfg.BurstLength = 10
+	cfg.BurstFactor = 100
+	trades := generate(t, cfg, 5000, "BTC-USD")
+
+	// Always bursting, the trades arrive 100 times faster.
+	elapsed := trades[len(trades)-1].Time.Sub(generatorStart).Seconds()
+	assert.InEpsilon(t, 0.05, elapsed, 0.1)
+}
+
+func TestGenerator_Read_ShouldPaceTrades(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultGeneratorConfig
+	cfg.Rate = 100
+	generator, err := NewGenerator(cfg)
+	require.NoError(t, err)
+	require.NoError(t, generator.Subscribe([]string{"BTC-USD"}))
+
+	receiver := make(chan *models.Trade)
+	start := time.Now()
+	generator.Read(context.Background(), receiver)
+	for i := 0; i < 50; i++ {
+		<-receiver
+	}
+	assert.InDelta(t, 500*time.Millisecond, time.Since(start), float64(300*time.Millisecond))
+
+	generator.Close()
+	for range receiver {
+	}
+}
+
+func TestGenerator_Subscribe_ShouldChangeTradingPairs(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultGeneratorConfig
+	cfg.Speed = 0
+	generator, err := NewGenerator(cfg)
+	require.NoError(t, err)
+	require.NoError(t, generator.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	generator.Read(ctx, receiver)
+
+	read := func(count int) map[string]int {
+		last := map[string]int{}
+		for i := 0; i < count; i++ {
+			trade := <-receiver
+			last[trade.ProductID] = trade.TradeID
+		}
+		return last
+	}
+	before := read(100)
+	require.NoError(t, generator.Unsubscribe([]string{"ETH-USD"}))
+	read(10)
+	assert.Equal(t, []string{"BTC-USD"}, keysOf(read(100)))
+
+	// Trade IDs carry on once subscribed again.
+	require.NoError(t, generator.Subscribe([]string{"ETH-USD"}))
+	for {
+		trade := <-receiver
+		if trade.ProductID == "ETH-USD" {
+			assert.Greater(t, trade.TradeID, before["ETH-USD"])
+			break
+		}
+	}
+
+	cancel()
+	for range receiver {
+	}
+	require.NoError(t, generator.Err())
+}
+
+func keysOf(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestNewGenerator_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	for name, configure := range map[string]func(cfg *GeneratorConfig){
+		"venue":             func(cfg *GeneratorConfig) { cfg.Venue = "ftx" },
+		"rate":              func(cfg *GeneratorConfig) { cfg.Rate = 0 },
+		"speed":             func(cfg *GeneratorConfig) { cfg.Speed = -1 },
+		"volatility":        func(cfg *GeneratorConfig) { cfg.Volatility = -0.1 },
+		"median size":       func(cfg *GeneratorConfig) { cfg.MedianSize = 0 },
+		"buy ratio":         func(cfg *GeneratorConfig) { cfg.BuyRatio = 1.5 },
+		"burst probability": func(cfg *GeneratorConfig) { cfg.BurstProbability = 2 },
+		"burst length":      func(cfg *GeneratorConfig) { cfg.BurstLength = 0 },
+		"price":             func(cfg *GeneratorConfig) { cfg.Prices = map[string]float64{"BTC-USD": 0} },
+	} {
+		cfg := DefaultGeneratorConfig
+		configure(&cfg)
+		_, err := NewGenerator(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func BenchmarkGenerator_Read(b *testing.B) {
+	cfg := DefaultGeneratorConfig
+	cfg.Speed = 0
+	generator, err := NewGenerator(cfg)
+	require.NoError(b, err)
+	require.NoError(b, generator.Subscribe([]string{"BTC-USD", "ETH-USD", "ETH-BTC"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiver := make(chan *models.Trade, 1024)
+	generator.Read(ctx, receiver)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		<-receiver
+	}
+}
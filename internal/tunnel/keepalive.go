@@ -0,0 +1,113 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"net"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// controlTimeout bounds the time spent writing a ping or a pong.
+const controlTimeout = 5 * time.Second
+
+// DefaultKeepalive is the keepalive policy used by NewReceiver.
+var DefaultKeepalive = Keepalive{
+	PingInterval: 15 * time.Second,
+	PongTimeout:  10 * time.Second,
+	ReadTimeout:  time.Minute,
+}
+
+// Keepalive detects dead connections, e.g. half-open TCP connections on which a read would block forever,
+// with read deadlines and pings. Zero durations disable the matching check.
+type Keepalive struct {
+	// PingInterval is the time between two pings sent to the exchange.
+	PingInterval time.Duration
+	// PongTimeout is the time the exchange has to answer a ping, with a pong or any other frame.
+	// It should be shorter than ReadTimeout.
+	PongTimeout time.Duration
+	// ReadTimeout is the longest time without any frame, pong or ping, read from the exchange.
+	ReadTimeout time.Duration
+}
+
+// DeadConnectionError is returned when a connection stops answering within the Keepalive timeouts.
+// The Receiver redials a dead connection right away.
+type DeadConnectionError struct {
+	Venue string
+	Err   error
+}
+
+func (e *DeadConnectionError) Error() string {
+	return fmt.Sprintf("dead connection to %s: %v", e.Venue, e.Err)
+}
+
+func (e *DeadConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// prepare sets the first read deadline of a new connection, and extends it on every pong and ping.
+// Pings are answered like the default gorilla ping handler does.
+func (r *Receiver) prepare(conn *ws.Conn) {
+	r.alive(conn)
+	conn.SetPongHandler(func(string) error {
+		r.alive(conn)
+		return nil
+	})
+	conn.SetPingHandler(func(appData string) error {
+		r.alive(conn)
+		err := conn.WriteControl(ws.PongMessage, []byte(appData), time.Now().Add(controlTimeout))
+		var netErr net.Error
+		if errors.Is(err, ws.ErrCloseSent) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil
+		}
+		return err
+	})
+}
+
+// alive records that a frame, a pong or a ping was just read from a connection, which answers the pending ping if any,
+// and moves its read deadline ReadTimeout away.
+func (r *Receiver) alive(conn *ws.Conn) {
+	now := time.Now()
+	r.mu.Lock()
+	r.lastFrame = now
+	r.awaitingPong = false
+	r.mu.Unlock()
+
+	var deadline time.Time
+	if r.keepalive.ReadTimeout > 0 {
+		deadline = now.Add(r.keepalive.ReadTimeout)
+	}
+	_ = conn.SetReadDeadline(deadline)
+}
+
+// ping sends a ping on a connection. The first ping left unanswered must be answered within PongTimeout.
+func (r *Receiver) ping(conn *ws.Conn) error {
+	now := time.Now()
+	if err := conn.WriteControl(ws.PingMessage, nil, now.Add(controlTimeout)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	awaiting := r.awaitingPong
+	r.awaitingPong = true
+	r.mu.Unlock()
+
+	if !awaiting && r.keepalive.PongTimeout > 0 {
+		_ = conn.SetReadDeadline(now.Add(r.keepalive.PongTimeout))
+	}
+	return nil
+}
+
+// deadConnection wraps the read timeouts set by the Keepalive into a DeadConnectionError.
+func deadConnection(venue string, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &DeadConnectionError{Venue: venue, Err: err}
+	}
+	return err
+}
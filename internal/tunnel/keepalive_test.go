@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestDeadConnection(t *testing.T) {
+	t.Parallel()
+
+	err := deadConnection(VenueCoinbase, timeoutError{})
+	var dead *DeadConnectionError
+	require.True(t, errors.As(err, &dead))
+	assert.Equal(t, VenueCoinbase, dead.Venue)
+	assert.Equal(t, "dead connection to coinbase: i/o timeout", err.Error())
+
+	closed := errors.New("connection reset by peer")
+	assert.Equal(t, closed, deadConnection(VenueCoinbase, closed))
+}
+
+func TestReceiver_Read_WithKeepalive_ShouldRedialUnansweredPings(t *testing.T) {
+	requests := make(chan models.CoinbaseRequest, 10)
+	release := make(chan struct{})
+	server := setUpWSServer(wsUnresponsive(requests, release))
+	defer server.Close()
+	defer close(release)
+
+	tunnel, err := NewReceiver(webSocketURL, WithKeepalive(Keepalive{
+		PingInterval: 50 * time.Millisecond,
+		PongTimeout:  100 * time.Millisecond,
+	}))
+	require.NoError(t, err)
+	defer tunnel.Close()
+	// Dead connections are redialed right away, whatever the backoff.
+	tunnel.(*Receiver).backoff = Backoff{Min: time.Hour, Max: time.Hour}
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tunnel.Read(ctx, make(chan *models.Trade))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case request := <-requests:
+			assert.Equal(t, TunnelSubscribe, request.Type)
+			assert.Equal(t, []string{"BTC-USD"}, request.ProductIDs)
+		case <-ctx.Done():
+			require.Fail(t, "dead connection not redialed")
+		}
+	}
+}
+
+func TestReceiver_Read_ShouldStopOnCancel_WhenConnectionIsHalfOpen(t *testing.T) {
+	requests := make(chan models.CoinbaseRequest, 1)
+	release := make(chan struct{})
+	server := setUpWSServer(wsUnresponsive(requests, release))
+	defer server.Close()
+	defer close(release)
+
+	// Without pings nor read deadline, only the cancellation can interrupt the read.
+	tunnel, err := NewReceiver(webSocketURL, WithKeepalive(Keepalive{}))
+	require.NoError(t, err)
+	defer tunnel.Close()
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	<-requests
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case _, ok := <-receiver:
+		require.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Read hangs on a half-open connection after cancellation")
+	}
+}
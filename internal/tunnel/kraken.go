@@ -0,0 +1,150 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"strings"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	// krakenTrade is the Kraken v2 trade channel.
+	krakenTrade = "trade"
+	// krakenSubscribe and krakenUnsubscribe are the methods of the Kraken v2 subscription requests.
+	krakenSubscribe   = "subscribe"
+	krakenUnsubscribe = "unsubscribe"
+)
+
+// krakenAssets maps the legacy Kraken asset codes to our canonical ones.
+var krakenAssets = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// NewKrakenReceiver initializes a Tunnel receiving the trades of the Kraken v2 trade channel and dials the Kraken
+// websocket, e.g. wss://ws.kraken.com/v2. Trades are normalized with Coinbase product IDs, e.g. XBT/USD to BTC-USD.
+func NewKrakenReceiver(websocketUrl string, opts ...ReceiverOption) (Tunnel, error) {
+	r, err := dial(websocketUrl, newKraken(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating Kraken websocket receiver: %v", err)
+	}
+
+	return r, nil
+}
+
+// kraken subscribes to the trade channel of a single websocket endpoint.
+type kraken struct {
+	names *symbols
+}
+
+func newKraken() *kraken {
+	return &kraken{names: newSymbols(KrakenSymbol, KrakenProductID)}
+}
+
+func (k *kraken) venue() string {
+	return VenueKraken
+}
+
+func (k *kraken) symbols() *symbols {
+	return k.names
+}
+
+func (k *kraken) endpoint(websocketUrl string, _ []string) string {
+	return websocketUrl
+}
+
+func (k *kraken) reset() {}
+
+func (k *kraken) subscribe(conn *ws.Conn, tradingPairs []string) error {
+	return k.request(conn, krakenSubscribe, tradingPairs)
+}
+
+func (k *kraken) unsubscribe(conn *ws.Conn, tradingPairs []string) error {
+	return k.request(conn, krakenUnsubscribe, tradingPairs)
+}
+
+// request sends a subscribe or unsubscribe request of the trade channel of the trading pairs.
+func (k *kraken) request(conn *ws.Conn, method string, tradingPairs []string) error {
+	symbols := make([]string, 0, len(tradingPairs))
+	for _, tradingPair := range tradingPairs {
+		symbols = append(symbols, k.names.venue(tradingPair))
+	}
+
+	request := models.KrakenRequest{
+		Method: method,
+		Params: models.KrakenParams{Channel: krakenTrade, Symbol: symbols},
+	}
+	if err := conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("error writing JSON to %s: %v", method, err)
+	}
+	return nil
+}
+
+// decode normalizes the batch of trades of a trade channel message, in the order of the batch.
+// Kraken gives the taker's side, inverted to the maker's side of Coinbase.
+// Heartbeats, status messages and acknowledgements are skipped, failed requests are returned as errors.
+func (k *kraken) decode(frame []byte) ([]*models.Trade, error) {
+	message := models.KrakenMessage{}
+	if err := json.Unmarshal(frame, &message); err != nil {
+		return nil, err
+	}
+	if message.Method != "" && !message.Success {
+		err := &ExchangeError{Venue: VenueKraken, Message: message.Method + " request failed", Reason: message.Error}
+		// A failed subscription names the symbol it rejects.
+		if message.Method == krakenSubscribe && message.Symbol != "" {
+			err.TradingPairs = []string{k.names.pair(message.Symbol)}
+		}
+		return nil, err
+	}
+	if message.Channel != krakenTrade {
+		return nil, nil
+	}
+
+	trades := make([]*models.Trade, 0, len(message.Data))
+	for _, trade := range message.Data {
+		side := models.SideBuy
+		if trade.Side == string(models.SideBuy) {
+			side = models.SideSell
+		}
+
+		tradeTime, err := time.Parse(time.RFC3339Nano, trade.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time %s of trade %d: %w", trade.Timestamp, trade.TradeID, err)
+		}
+
+		trades = append(trades, &models.Trade{
+			Venue:     VenueKraken,
+			ProductID: k.names.pair(trade.Symbol),
+			TradeID:   trade.TradeID,
+			Price:     trade.Price.String(),
+			Size:      trade.Qty.String(),
+			Side:      side,
+			Time:      tradeTime,
+		})
+	}
+	return trades, nil
+}
+
+// KrakenSymbol maps a Coinbase product ID to a Kraken v2 symbol, e.g. BTC-USD to BTC/USD.
+func KrakenSymbol(tradingPair string) string {
+	return strings.ReplaceAll(strings.ToUpper(tradingPair), "-", "/")
+}
+
+// KrakenProductID maps a Kraken symbol to a Coinbase product ID, including the legacy asset codes,
+// e.g. XBT/USD to BTC-USD.
+func KrakenProductID(symbol string) string {
+	assets := strings.Split(strings.ToUpper(symbol), "/")
+	for i, asset := range assets {
+		if canonical, ok := krakenAssets[asset]; ok {
+			assets[i] = canonical
+		}
+	}
+	return strings.Join(assets, "-")
+}
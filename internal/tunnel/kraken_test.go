@@ -0,0 +1,132 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestKrakenSymbols(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "BTC/USD", KrakenSymbol("BTC-USD"))
+	assert.Equal(t, "ETH/BTC", KrakenSymbol("eth-btc"))
+
+	assert.Equal(t, "BTC-USD", KrakenProductID("XBT/USD"))
+	assert.Equal(t, "BTC-USD", KrakenProductID("BTC/USD"))
+	assert.Equal(t, "DOGE-BTC", KrakenProductID("XDG/XBT"))
+	assert.Equal(t, "ETH-EUR", KrakenProductID("eth/eur"))
+}
+
+func TestKraken_Decode(t *testing.T) {
+	t.Parallel()
+
+	responses, err := newKraken().decode([]byte(`{"channel":"trade","type":"update","data":[` +
+		`{"symbol":"XBT/USD","side":"buy","price":29303.3,"qty":0.000299,"ord_type":"market","trade_id":1,"timestamp":"2022-05-21T09:12:04.862866Z"},` +
+		`{"symbol":"XBT/USD","side":"sell","price":29303.2,"qty":1,"ord_type":"limit","trade_id":2,"timestamp":"2022-05-21T09:12:04.862866Z"}]}`))
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Equal(t, &models.Trade{
+		Venue:     "kraken",
+		ProductID: "BTC-USD",
+		TradeID:   1,
+		Price:     "29303.3",
+		Size:      "0.000299",
+		Side:      models.SideSell,
+		Time:      time.Date(2022, 5, 21, 9, 12, 4, 862866000, time.UTC),
+	}, responses[0])
+	assert.Equal(t, models.SideBuy, responses[1].Side)
+	assert.Equal(t, 2, responses[1].TradeID)
+
+	for _, frame := range []string{
+		`{"channel":"heartbeat"}`,
+		`{"channel":"status","type":"update","data":[{"system":"online"}]}`,
+		`{"method":"subscribe","result":{"channel":"trade","symbol":"BTC/USD"},"success":true}`,
+	} {
+		responses, err = newKraken().decode([]byte(frame))
+		require.NoError(t, err)
+		assert.Empty(t, responses, frame)
+	}
+
+	_, err = newKraken().decode([]byte(`{"method":"subscribe","error":"Currency pair not supported FOO/BAR","success":false}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FOO/BAR")
+
+	_, err = newKraken().decode([]byte(`{"method":"subscribe","error":"Currency pair not supported","success":false,"symbol":"XBT/FOO"}`))
+	var exchangeErr *ExchangeError
+	require.True(t, errors.As(err, &exchangeErr))
+	assert.Equal(t, []string{"BTC-FOO"}, exchangeErr.TradingPairs)
+}
+
+func TestKrakenReceiver_Read_ShouldSplitBatches(t *testing.T) {
+	subscriptions := make(chan models.KrakenRequest, 1)
+	server := setUpWSServer(fakeKrakenServer(t, subscriptions, false))
+	defer server.Close()
+
+	tunnel, err := NewKrakenReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+	assert.Equal(t, models.KrakenRequest{
+		Method: "subscribe",
+		Params: models.KrakenParams{Channel: "trade", Symbol: []string{"BTC/USD", "ETH/USD"}},
+	}, <-subscriptions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	for i, productID := range []string{"BTC-USD", "BTC-USD", "ETH-USD"} {
+		select {
+		case response := <-receiver:
+			assert.Equal(t, productID, response.ProductID)
+			assert.Equal(t, i+1, response.TradeID)
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trade", "trade_id %d", i+1)
+		}
+	}
+}
+
+func TestKrakenReceiver_Read_ShouldReconnectAndResubscribe(t *testing.T) {
+	subscriptions := make(chan models.KrakenRequest, 2)
+	server := setUpWSServer(fakeKrakenServer(t, subscriptions, true))
+	defer server.Close()
+
+	tunnel, err := NewKrakenReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	tunnel.(*Receiver).backoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	for tradeID := 1; tradeID <= 6; tradeID++ {
+		select {
+		case response, ok := <-receiver:
+			require.True(t, ok, "receiver channel closed after a connection loss")
+			assert.Equal(t, tradeID, response.TradeID)
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trade", "trade_id %d", tradeID)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, []string{"BTC/USD"}, (<-subscriptions).Params.Symbol)
+	}
+}
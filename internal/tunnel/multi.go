@@ -0,0 +1,93 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Multi is a Tunnel merging the trades of several Tunnels, e.g. one per venue, into a single feed.
+// The trades of each Tunnel keep their order, trades of different Tunnels are interleaved as they arrive.
+type Multi struct {
+	tunnels []Tunnel
+}
+
+// NewMulti creates a Tunnel merging the trades of tunnels.
+func NewMulti(tunnels ...Tunnel) Tunnel {
+	return &Multi{tunnels: tunnels}
+}
+
+// Subscribe subscribes every Tunnel to the trading pairs, and returns the first error if any of them fails.
+func (m *Multi) Subscribe(tradingPairs []string) error {
+	var first error
+	for i, tunnel := range m.tunnels {
+		if err := tunnel.Subscribe(tradingPairs); err != nil && first == nil {
+			first = fmt.Errorf("error while subscribing tunnel %d: %w", i, err)
+		}
+	}
+	return first
+}
+
+// Unsubscribe unsubscribes every Tunnel from the trading pairs, and returns the first error if any of them fails.
+func (m *Multi) Unsubscribe(tradingPairs []string) error {
+	var first error
+	for i, tunnel := range m.tunnels {
+		if err := tunnel.Unsubscribe(tradingPairs); err != nil && first == nil {
+			first = fmt.Errorf("error while unsubscribing tunnel %d: %w", i, err)
+		}
+	}
+	return first
+}
+
+// Read passes the trades of every Tunnel to the receiver channel, which is closed once all of them are done.
+// A Tunnel stopping on an error closes the others, so the error is returned by Err.
+func (m *Multi) Read(ctx context.Context, receiver chan *models.Trade) {
+	var wg sync.WaitGroup
+	for _, tunnel := range m.tunnels {
+		trades := make(chan *models.Trade)
+		tunnel.Read(ctx, trades)
+
+		wg.Add(1)
+		go func(tunnel Tunnel, trades chan *models.Trade) {
+			defer wg.Done()
+			// Trades are drained until the Tunnel closes its channel, even once ctx is done.
+			for trade := range trades {
+				select {
+				case receiver <- trade:
+				case <-ctx.Done():
+				}
+			}
+			if tunnel.Err() != nil {
+				m.Close()
+			}
+		}(tunnel, trades)
+	}
+
+	go func() {
+		wg.Wait()
+		close(receiver)
+	}()
+}
+
+// Err returns the first error a Tunnel stopped on, if any.
+func (m *Multi) Err() error {
+	for _, tunnel := range m.tunnels {
+		if err := tunnel.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every Tunnel.
+func (m *Multi) Close() {
+	for _, tunnel := range m.tunnels {
+		tunnel.Close()
+	}
+}
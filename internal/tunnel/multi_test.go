@@ -0,0 +1,109 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// fakeTunnel sends its trades once read.
+type fakeTunnel struct {
+	trades       []*models.Trade
+	subscribeErr error
+	tradingPairs []string
+	closed       bool
+}
+
+func (f *fakeTunnel) Subscribe(tradingPairs []string) error {
+	f.tradingPairs = tradingPairs
+	return f.subscribeErr
+}
+
+func (f *fakeTunnel) Unsubscribe(tradingPairs []string) error {
+	for _, tradingPair := range tradingPairs {
+		for i, subscribed := range f.tradingPairs {
+			if subscribed == tradingPair {
+				f.tradingPairs = append(f.tradingPairs[:i:i], f.tradingPairs[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeTunnel) Read(_ context.Context, receiver chan *models.Trade) {
+	go func() {
+		defer close(receiver)
+		for _, trade := range f.trades {
+			receiver <- trade
+		}
+	}()
+}
+
+func (f *fakeTunnel) Err() error {
+	return nil
+}
+
+func (f *fakeTunnel) Close() {
+	f.closed = true
+}
+
+func TestMulti_ShouldMergeTunnels_InOrder(t *testing.T) {
+	t.Parallel()
+
+	coinbase := &fakeTunnel{}
+	binance := &fakeTunnel{}
+	for i := 1; i <= 50; i++ {
+		coinbase.trades = append(coinbase.trades, &models.Trade{Venue: VenueCoinbase, ProductID: "BTC-USD", TradeID: i})
+		binance.trades = append(binance.trades, &models.Trade{Venue: VenueBinance, ProductID: "BTC-USD", TradeID: i})
+	}
+
+	multi := NewMulti(coinbase, binance)
+	require.NoError(t, multi.Subscribe([]string{"BTC-USD"}))
+	assert.Equal(t, []string{"BTC-USD"}, coinbase.tradingPairs)
+	assert.Equal(t, []string{"BTC-USD"}, binance.tradingPairs)
+
+	receiver := make(chan *models.Trade)
+	multi.Read(context.Background(), receiver)
+
+	last := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for count := 0; count < 100; count++ {
+		select {
+		case trade := <-receiver:
+			assert.Equal(t, last[trade.Venue]+1, trade.TradeID)
+			last[trade.Venue] = trade.TradeID
+		case <-timeout:
+			require.Fail(t, "trades not merged")
+		}
+	}
+
+	_, ok := <-receiver
+	assert.False(t, ok)
+
+	multi.Close()
+	assert.True(t, coinbase.closed)
+	assert.True(t, binance.closed)
+}
+
+func TestMulti_Subscribe_ShouldSubscribeAll_AndFail(t *testing.T) {
+	t.Parallel()
+
+	failing := &fakeTunnel{subscribeErr: errors.New("boom")}
+	other := &fakeTunnel{}
+
+	err := NewMulti(failing, other).Subscribe([]string{"BTC-USD"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+	assert.Equal(t, []string{"BTC-USD"}, other.tradingPairs)
+}
@@ -0,0 +1,287 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"strings"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// errPoolClosed is returned when a shard is needed once the Pool stopped reading.
+var errPoolClosed = errors.New("pool closed")
+
+// Pool is a Tunnel sharding the trading pairs of a venue across several connections, at most pairsPerConnection
+// trading pairs each, so that a single connection is neither a throughput bottleneck nor a single point of failure.
+// Every shard is a Tunnel of its own, e.g. a Receiver, reconnecting on its own.
+// A trading pair is read from a single shard, so the merged feed keeps the order of the trades of every trading pair.
+type Pool struct {
+	pairsPerConnection int
+	// newShard dials the connection of a new shard.
+	newShard func() (Tunnel, error)
+
+	// subMu serializes the (un)subscriptions, which dial and subscribe the shards without holding mu, so that the
+	// shards being read don't wait for the exchange.
+	subMu  sync.Mutex
+	mu     sync.Mutex
+	shards []*shard
+	// ctx and receiver are those of Read, once called, to read the shards added afterwards.
+	ctx      context.Context
+	receiver chan *models.Trade
+	// reading is the number of shards whose trades are still read. The receiver channel is closed once it drops to 0.
+	reading int
+	closed  bool
+}
+
+// shard is a connection of a Pool, with the trading pairs it is subscribed to. read is set once its trades are read.
+type shard struct {
+	tunnel       Tunnel
+	tradingPairs []string
+	read         bool
+}
+
+// NewPool creates a Tunnel sharding trading pairs across connections dialed with newShard, at most
+// pairsPerConnection trading pairs each. The first connection is dialed right away.
+func NewPool(pairsPerConnection int, newShard func() (Tunnel, error)) (Tunnel, error) {
+	if pairsPerConnection < 1 {
+		return nil, fmt.Errorf("invalid number of trading pairs per connection %d", pairsPerConnection)
+	}
+
+	tunnel, err := newShard()
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{
+		pairsPerConnection: pairsPerConnection,
+		newShard:           newShard,
+		shards:             []*shard{{tunnel: tunnel}},
+	}, nil
+}
+
+// Subscribe assigns every trading pair not subscribed yet to the first shard with room left, dialing new shards
+// once all of them are full, and subscribes the shards to their new trading pairs.
+// A shard only gets its trading pairs once subscribed to them, and a new shard is only added, and read once Read is
+// called, once subscribed: a receiver subscribing through the URL, e.g. of Binance, only connects then.
+// A new shard failing to subscribe is closed. It returns the first error if any of them fails.
+func (p *Pool) Subscribe(tradingPairs []string) error {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	p.mu.Lock()
+	assigned := make(map[*shard][]string)
+	var order []*shard
+	var unassigned []string
+	seen := make(map[string]bool, len(tradingPairs))
+	for _, tradingPair := range tradingPairs {
+		if seen[tradingPair] || p.shardOf(tradingPair) != nil {
+			continue
+		}
+		seen[tradingPair] = true
+		s := p.available(assigned)
+		if s == nil {
+			unassigned = append(unassigned, tradingPair)
+			continue
+		}
+		if _, ok := assigned[s]; !ok {
+			order = append(order, s)
+		}
+		assigned[s] = append(assigned[s], tradingPair)
+	}
+	closed := p.closed
+	p.mu.Unlock()
+
+	var first error
+	for len(unassigned) > 0 {
+		if closed {
+			first = fmt.Errorf("error while subscribing %s: %w", unassigned[0], errPoolClosed)
+			break
+		}
+		tunnel, err := p.newShard()
+		if err != nil {
+			first = fmt.Errorf("error while subscribing %s: %w", unassigned[0], err)
+			break
+		}
+		count := p.pairsPerConnection
+		if count > len(unassigned) {
+			count = len(unassigned)
+		}
+		s := &shard{tunnel: tunnel}
+		order = append(order, s)
+		assigned[s], unassigned = unassigned[:count], unassigned[count:]
+	}
+
+	for _, s := range order {
+		err := s.tunnel.Subscribe(assigned[s])
+		if err != nil && first == nil {
+			first = fmt.Errorf("error while subscribing %s: %w", strings.Join(assigned[s], ", "), err)
+		}
+		p.subscribed(s, assigned[s], err)
+	}
+	return first
+}
+
+// subscribed gives a shard the trading pairs it was subscribed to, unless err. A new shard is added to the shards,
+// and read once Read is called, or closed on err.
+func (p *Pool) subscribed(s *shard, tradingPairs []string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	added := p.index(s) >= 0
+	if err != nil {
+		if !added {
+			s.tunnel.Close()
+		}
+		return
+	}
+	s.tradingPairs = append(s.tradingPairs, tradingPairs...)
+	if !added {
+		p.shards = append(p.shards, s)
+	}
+	if !s.read && p.receiver != nil {
+		p.read(s)
+	}
+}
+
+// Unsubscribe unsubscribes the trading pairs from their shards, and returns the first error if any of them fails.
+// A shard keeps the trading pairs it failed to unsubscribe from. Shards left without trading pair stay connected,
+// to be reused.
+func (p *Pool) Unsubscribe(tradingPairs []string) error {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+
+	p.mu.Lock()
+	removed := make(map[*shard][]string)
+	var order []*shard
+	for _, tradingPair := range tradingPairs {
+		s := p.shardOf(tradingPair)
+		if s == nil || containsPair(removed[s], tradingPair) {
+			continue
+		}
+		if _, ok := removed[s]; !ok {
+			order = append(order, s)
+		}
+		removed[s] = append(removed[s], tradingPair)
+	}
+	p.mu.Unlock()
+
+	var first error
+	for _, s := range order {
+		if err := s.tunnel.Unsubscribe(removed[s]); err != nil {
+			if first == nil {
+				first = fmt.Errorf("error while unsubscribing %s: %w", strings.Join(removed[s], ", "), err)
+			}
+			continue
+		}
+		p.mu.Lock()
+		s.tradingPairs = withoutPairs(s.tradingPairs, removed[s])
+		p.mu.Unlock()
+	}
+	return first
+}
+
+// shardOf returns the shard subscribed to a trading pair, nil if none is. p.mu must be held.
+func (p *Pool) shardOf(tradingPair string) *shard {
+	for _, s := range p.shards {
+		if containsPair(s.tradingPairs, tradingPair) {
+			return s
+		}
+	}
+	return nil
+}
+
+// available returns the first shard with room for a trading pair, on top of those assigned to it already,
+// nil if all of them are full. p.mu must be held.
+func (p *Pool) available(assigned map[*shard][]string) *shard {
+	for _, s := range p.shards {
+		if len(s.tradingPairs)+len(assigned[s]) < p.pairsPerConnection {
+			return s
+		}
+	}
+	return nil
+}
+
+// index returns the position of a shard, -1 if it isn't one of the shards. p.mu must be held.
+func (p *Pool) index(s *shard) int {
+	for i, candidate := range p.shards {
+		if candidate == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Read passes the trades of every shard, those dialed later on included, to the receiver channel, which is closed
+// once all of them are done. A shard stopping on an error closes the others, so the error is returned by Err.
+func (p *Pool) Read(ctx context.Context, receiver chan *models.Trade) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ctx = ctx
+	p.receiver = receiver
+	for _, s := range p.shards {
+		p.read(s)
+	}
+}
+
+// read passes the trades of a shard to the receiver channel of Read. p.mu must be held.
+func (p *Pool) read(s *shard) {
+	s.read = true
+	trades := make(chan *models.Trade)
+	s.tunnel.Read(p.ctx, trades)
+	p.reading++
+
+	go func(ctx context.Context, receiver chan *models.Trade) {
+		// Trades are drained until the shard closes its channel, even once ctx is done.
+		for trade := range trades {
+			select {
+			case receiver <- trade:
+			case <-ctx.Done():
+			}
+		}
+		if s.tunnel.Err() != nil {
+			p.Close()
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.reading--
+		if p.reading == 0 {
+			p.closed = true
+			close(receiver)
+		}
+	}(p.ctx, p.receiver)
+}
+
+// Err returns the first error a shard stopped on, if any.
+func (p *Pool) Err() error {
+	for _, tunnel := range p.tunnels() {
+		if err := tunnel.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every shard.
+func (p *Pool) Close() {
+	for _, tunnel := range p.tunnels() {
+		tunnel.Close()
+	}
+}
+
+func (p *Pool) tunnels() []Tunnel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tunnels := make([]Tunnel, 0, len(p.shards))
+	for _, s := range p.shards {
+		tunnels = append(tunnels, s.tunnel)
+	}
+	return tunnels
+}
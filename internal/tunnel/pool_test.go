@@ -0,0 +1,239 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// fakeShards returns a newShard function dialing fakeTunnels, each sending trades, and the fakeTunnels dialed so far.
+func fakeShards(trades ...[]*models.Trade) (func() (Tunnel, error), *[]*fakeTunnel) {
+	var shards []*fakeTunnel
+	return func() (Tunnel, error) {
+		if len(shards) == len(trades) {
+			return nil, errors.New("no more connections")
+		}
+		shard := &fakeTunnel{trades: trades[len(shards)]}
+		shards = append(shards, shard)
+		return shard, nil
+	}, &shards
+}
+
+func TestPool_Subscribe_ShouldShardTradingPairs(t *testing.T) {
+	t.Parallel()
+
+	newShard, shards := fakeShards(nil, nil, nil, nil)
+	pool, err := NewPool(2, newShard)
+	require.NoError(t, err)
+
+	require.NoError(t, pool.Subscribe([]string{"BTC-USD", "ETH-USD", "SOL-USD", "ETH-BTC", "ADA-USD"}))
+	require.Len(t, *shards, 3)
+	assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, (*shards)[0].tradingPairs)
+	assert.Equal(t, []string{"SOL-USD", "ETH-BTC"}, (*shards)[1].tradingPairs)
+	assert.Equal(t, []string{"ADA-USD"}, (*shards)[2].tradingPairs)
+
+	// Subscribed trading pairs stay on their shard, freed room is reused before dialing a new shard.
+	require.NoError(t, pool.Unsubscribe([]string{"SOL-USD"}))
+	assert.Equal(t, []string{"ETH-BTC"}, (*shards)[1].tradingPairs)
+	require.NoError(t, pool.Subscribe([]string{"BTC-USD", "DOT-USD"}))
+	require.Len(t, *shards, 3)
+	assert.Equal(t, []string{"ETH-BTC", "DOT-USD"}, pool.(*Pool).shards[1].tradingPairs)
+
+	require.NoError(t, pool.Subscribe([]string{"XRP-USD", "LTC-USD"}))
+	require.Len(t, *shards, 4)
+
+	err = pool.Subscribe([]string{"DOGE-USD", "UNI-USD"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no more connections")
+
+	pool.Close()
+	for _, shard := range *shards {
+		assert.True(t, shard.closed)
+	}
+}
+
+func TestPool_Subscribe_ShouldRollBackFailedShards(t *testing.T) {
+	t.Parallel()
+
+	newShard, shards := fakeShards(nil, nil, nil)
+	pool, err := NewPool(2, func() (Tunnel, error) {
+		shard, err := newShard()
+		if len(*shards) == 2 {
+			shard.(*fakeTunnel).subscribeErr = errors.New("rejected")
+		}
+		return shard, err
+	})
+	require.NoError(t, err)
+
+	// The shard dialed for SOL-USD fails to subscribe: it is closed, and SOL-USD can be subscribed again.
+	require.Error(t, pool.Subscribe([]string{"BTC-USD", "ETH-USD", "SOL-USD"}))
+	require.Len(t, *shards, 2)
+	assert.True(t, (*shards)[1].closed)
+	require.Len(t, pool.(*Pool).shards, 1)
+	assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, pool.(*Pool).shards[0].tradingPairs)
+
+	// The existing shard failing keeps the trading pairs it had.
+	(*shards)[0].subscribeErr = errors.New("rejected")
+	require.NoError(t, pool.Unsubscribe([]string{"ETH-USD"}))
+	require.Error(t, pool.Subscribe([]string{"ADA-USD"}))
+	assert.Equal(t, []string{"BTC-USD"}, pool.(*Pool).shards[0].tradingPairs)
+
+	(*shards)[0].subscribeErr = nil
+	require.NoError(t, pool.Subscribe([]string{"SOL-USD"}))
+	assert.Equal(t, []string{"BTC-USD", "SOL-USD"}, pool.(*Pool).shards[0].tradingPairs)
+}
+
+func TestPool_Subscribe_ShouldNotBlockReadsWhileDialing(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	dialing := make(chan struct{})
+	first := true
+	pool, err := NewPool(1, func() (Tunnel, error) {
+		if !first {
+			close(dialing)
+			<-release
+		}
+		first = false
+		return &fakeTunnel{}, nil
+	})
+	require.NoError(t, err)
+
+	subscribed := make(chan error)
+	go func() { subscribed <- pool.Subscribe([]string{"BTC-USD", "ETH-USD"}) }()
+	<-dialing
+
+	// Err locks the Pool, as the shards being read do.
+	errs := make(chan error)
+	go func() { errs <- pool.Err() }()
+	select {
+	case err = <-errs:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "the Pool is locked while dialing a shard")
+	}
+
+	close(release)
+	require.NoError(t, <-subscribed)
+	assert.Len(t, pool.(*Pool).shards, 2)
+}
+
+func TestPool_Read_ShouldMergeShards_InOrderPerTradingPair(t *testing.T) {
+	t.Parallel()
+
+	var btc, eth, sol []*models.Trade
+	for i := 1; i <= 50; i++ {
+		btc = append(btc, &models.Trade{ProductID: "BTC-USD", TradeID: i})
+		eth = append(eth, &models.Trade{ProductID: "ETH-USD", TradeID: i})
+		sol = append(sol, &models.Trade{ProductID: "SOL-USD", TradeID: i})
+	}
+	newShard, shards := fakeShards(btc, eth, sol)
+	pool, err := NewPool(1, newShard)
+	require.NoError(t, err)
+	require.NoError(t, pool.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+
+	// The shard dialed after Read is read as well.
+	receiver := make(chan *models.Trade)
+	pool.Read(context.Background(), receiver)
+	require.NoError(t, pool.Subscribe([]string{"SOL-USD"}))
+	require.Len(t, *shards, 3)
+
+	last := make(map[string]int)
+	count := 0
+	for trade := range receiver {
+		require.Equal(t, last[trade.ProductID]+1, trade.TradeID, "trades of %s out of order", trade.ProductID)
+		last[trade.ProductID] = trade.TradeID
+		count++
+	}
+	assert.Equal(t, 150, count)
+	require.NoError(t, pool.Err())
+}
+
+func TestPool_Read_ShouldReconnectShardsIndependently(t *testing.T) {
+	subscriptions := make(chan models.CoinbaseRequest, 10)
+	server := setUpWSServer(wsDropAfterMatch(t, subscriptions))
+	defer server.Close()
+
+	pool, err := NewPool(1, func() (Tunnel, error) {
+		tunnel, err := NewReceiver(webSocketURL)
+		if err == nil {
+			tunnel.(*Receiver).backoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+		}
+		return tunnel, err
+	})
+	require.NoError(t, err)
+	defer pool.Close()
+	require.NoError(t, pool.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	pool.Read(ctx, receiver)
+
+	// Each connection sends a trade, then drops: both shards reconnect and resubscribe to their own trading pair.
+	for i := 0; i < 4; i++ {
+		select {
+		case _, ok := <-receiver:
+			require.True(t, ok, "receiver channel closed after a connection loss")
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trade")
+		}
+	}
+
+	resubscribed := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		request := <-subscriptions
+		require.Len(t, request.ProductIDs, 1)
+		resubscribed[request.ProductIDs[0]]++
+	}
+	assert.GreaterOrEqual(t, resubscribed["BTC-USD"], 1)
+	assert.GreaterOrEqual(t, resubscribed["ETH-USD"], 1)
+}
+
+func TestPool_Read_ShouldReadBinanceShardsOnceSubscribed(t *testing.T) {
+	streams := make(chan string, 10)
+	server := setUpWSServer(fakeBinanceServer(t, streams))
+	defer server.Close()
+
+	pool, err := NewPool(1, func() (Tunnel, error) { return NewBinanceReceiver(webSocketURL) })
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	pool.Read(ctx, receiver)
+
+	// The second shard is dialed by its subscription, once reading.
+	require.NoError(t, pool.Subscribe([]string{"BTC-USD", "ETH-BTC"}))
+	productIDs := make(map[string]bool)
+	for len(productIDs) < 2 {
+		select {
+		case trade := <-receiver:
+			productIDs[trade.ProductID] = true
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trades", "received %v", productIDs)
+		}
+	}
+	assert.ElementsMatch(t, []string{"btcusdt@trade", "ethbtc@trade"}, []string{<-streams, <-streams})
+}
+
+func TestNewPool_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewPool(0, func() (Tunnel, error) { return &fakeTunnel{}, nil })
+	require.Error(t, err)
+
+	_, err = NewPool(1, func() (Tunnel, error) { return nil, errors.New("connection refused") })
+	require.Error(t, err)
+}
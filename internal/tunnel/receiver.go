@@ -1,12 +1,15 @@
 package tunnel
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	ws "github.com/gorilla/websocket"
 	"github.com/reactivejson/vwap-engine/api/models"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -16,76 +19,272 @@ import (
  */
 
 const (
-	TunnelSubscribe string = "subscribe"
+	TunnelSubscribe   string = "subscribe"
+	TunnelUnsubscribe string = "unsubscribe"
 )
 
+// errReceiverClosed is returned when a reconnect is aborted because the Receiver was closed.
+var errReceiverClosed = errors.New("receiver closed")
+
 // Receiver connexion
 type Receiver struct {
+	mu sync.Mutex
+	// subMu serializes the (un)subscriptions, from the API or after a reconnect, on the connection.
+	subMu sync.Mutex
 	conn *ws.Conn
 	done chan struct{} // the Receiver will close done once it cannot read from the websocket anymore
+	once sync.Once
+	// dialed is closed once conn is first set, as exchanges subscribing through the URL, e.g. Binance, only dial on
+	// Subscribe.
+	dialed     chan struct{}
+	dialedOnce sync.Once
+
+	// websocketUrl, dialer and tradingPairs are kept to redial and resubscribe after a connection loss.
+	websocketUrl string
+	dialer       *ws.Dialer
+	tradingPairs []string
+	backoff      Backoff
+	keepalive    Keepalive
+	// exchange speaks the websocket protocol of the exchange, endpoint is the URL conn was dialed with.
+	exchange exchange
+	endpoint string
+
+	// recorder, when set, is given every raw frame read from the websocket.
+	recorder *Recorder
+	// rejections, when set, decides whether the trading pairs rejected by the exchange stop the Receiver.
+	rejections *Rejections
+	// err is the ExchangeError the Receiver stopped reading on, if any.
+	err error
+
+	// watchdog, when set, tracks the activity of the trading pairs. lastFrame is the time the last frame, ping or pong
+	// was read from conn, or conn was dialed. awaitingPong is set once a ping is sent, until something is read.
+	watchdog     *Watchdog
+	lastFrame    time.Time
+	awaitingPong bool
+}
+
+// heartbeats is implemented by the exchanges sending a heartbeat per product, e.g. coinbase.
+type heartbeats interface {
+	lastHeartbeat(tradingPair string) (Heartbeat, bool)
+	notify(onHeartbeat func(heartbeat Heartbeat))
+}
+
+// ReceiverOption configures optional behaviours of a Receiver.
+type ReceiverOption func(r *Receiver)
+
+// WithSymbols overrides the venue symbols of trading pairs, for the venue of the Receiver.
+func WithSymbols(symbolMap SymbolMap) ReceiverOption {
+	return func(r *Receiver) {
+		r.exchange.symbols().override(symbolMap[r.exchange.venue()])
+	}
+}
+
+// WithRecorder records every raw frame read by the Receiver, e.g. to replay the feed later on.
+func WithRecorder(recorder *Recorder) ReceiverOption {
+	return func(r *Receiver) {
+		r.recorder = recorder
+	}
+}
+
+// WithKeepalive replaces the DefaultKeepalive pings and read deadlines detecting dead connections.
+func WithKeepalive(keepalive Keepalive) ReceiverOption {
+	return func(r *Receiver) {
+		r.keepalive = keepalive
+	}
+}
+
+// WithWatchdog tracks the trades and heartbeats of the Receiver with watchdog, and reconnects once the connection
+// stays silent for the watchdog interval.
+func WithWatchdog(watchdog *Watchdog) ReceiverOption {
+	return func(r *Receiver) {
+		r.watchdog = watchdog
+		if exchange, ok := r.exchange.(heartbeats); ok {
+			venue := r.exchange.venue()
+			exchange.notify(func(heartbeat Heartbeat) {
+				watchdog.observe(venue, heartbeat.ProductID, heartbeat.ReceivedAt)
+			})
+		}
+	}
+}
+
+// WithRejections passes the ExchangeErrors rejecting trading pairs to rejections: unless its handler returns an error,
+// the Receiver drops them, no longer subscribing to them on reconnects, and keeps reading the others.
+func WithRejections(rejections *Rejections) ReceiverOption {
+	return func(r *Receiver) {
+		r.rejections = rejections
+	}
 }
 
 // NewReceiver initializes a new coinbase Tunnel object and dials the coinbase websocket. It takes a coinbase ws urr,
 // If a connection cannot be reached it returns an error.
 // NewReceiver returns a new websocket client Tunnel.
-func NewReceiver(websocketUrl string) (Tunnel, error) {
-	dialer := ws.Dialer{HandshakeTimeout: 5 * time.Second}
-	conn, _, err := dialer.Dial(websocketUrl, http.Header{})
+func NewReceiver(websocketUrl string, opts ...ReceiverOption) (Tunnel, error) {
+	r, err := dial(websocketUrl, newCoinbase(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error while creating websocket receiver: %v", err)
 	}
 
-	done := make(chan struct{})
-
 	log.Printf("Successfully connected to: %s", websocketUrl)
 
-	return &Receiver{
-		conn: conn,
-		done: done,
-	}, nil
+	return r, nil
 }
 
 // NewReceiverWithconn returns a new websocket client.
-func NewReceiverWithconn(websocketUrl string, conn *ws.Conn) (Tunnel, error) {
-	done := make(chan struct{})
+func NewReceiverWithconn(websocketUrl string, conn *ws.Conn, opts ...ReceiverOption) (Tunnel, error) {
+	return newReceiver(websocketUrl, newCoinbase(), newDialer(), conn, opts...), nil
+}
+
+func newReceiver(websocketUrl string, exchange exchange, dialer *ws.Dialer, conn *ws.Conn, opts ...ReceiverOption) *Receiver {
+	r := &Receiver{
+		conn:         conn,
+		done:         make(chan struct{}),
+		dialed:       make(chan struct{}),
+		websocketUrl: websocketUrl,
+		dialer:       dialer,
+		backoff:      DefaultBackoff,
+		keepalive:    DefaultKeepalive,
+		exchange:     exchange,
+		lastFrame:    time.Now(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if conn != nil {
+		r.endpoint = exchange.endpoint(websocketUrl, nil)
+		r.prepare(conn)
+		r.dialedOnce.Do(func() { close(r.dialed) })
+	}
+	return r
+}
 
-	return &Receiver{
-		conn: conn,
-		done: done,
-	}, nil
+// dial returns a Receiver of an exchange, configured by opts, connected to its websocket.
+func dial(websocketUrl string, exchange exchange, opts ...ReceiverOption) (*Receiver, error) {
+	r := newReceiver(websocketUrl, exchange, newDialer(), nil, opts...)
+	if _, err := r.connect(context.Background(), exchange.endpoint(websocketUrl, nil)); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 //Subscribe sends a subscribe request to the coinbase channel's websocket, using trading pairs (productIDs).
+//The trading pairs are added to those subscribed to before, remembered and replayed on every reconnect, once the
+//request is sent: a failed subscription leaves them as they were.
+//Exchanges subscribing through the URL, such as Binance combined streams, are (re)dialed with the trading pairs instead.
 func (r *Receiver) Subscribe(tradingPairs []string) error {
-	sbPayload := models.CoinbaseRequest{
-		Type:       TunnelSubscribe,
-		ProductIDs: tradingPairs,
-		Channels: []models.Channel{
-			{Name: "matches"},
-		},
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	r.mu.Lock()
+	subscribed := append([]string(nil), r.tradingPairs...)
+	for _, tradingPair := range tradingPairs {
+		if !containsPair(subscribed, tradingPair) {
+			subscribed = append(subscribed, tradingPair)
+		}
 	}
+	conn, endpoint := r.conn, r.endpoint
+	r.mu.Unlock()
 
-	if err := r.conn.WriteJSON(sbPayload); err != nil {
-		return fmt.Errorf("error writing JSON to subscribe: %v", err)
+	if target := r.exchange.endpoint(r.websocketUrl, subscribed); target != endpoint {
+		var err error
+		if conn, err = r.connect(context.Background(), target); err != nil {
+			return fmt.Errorf("error while subscribing: %w", err)
+		}
+	}
+	if err := r.exchange.subscribe(conn, tradingPairs); err != nil {
+		return err
 	}
 
+	r.mu.Lock()
+	r.tradingPairs = subscribed
+	r.mu.Unlock()
 	return nil
+}
+
+//Unsubscribe sends an unsubscribe request of trading pairs (productIDs), which are not replayed on reconnects anymore
+//once the request is sent: a failed unsubscription leaves them subscribed.
+//Exchanges subscribing through the URL are redialed without the trading pairs, and keep at least one of them, as an
+//endpoint without any stream is rejected.
+func (r *Receiver) Unsubscribe(tradingPairs []string) error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	r.mu.Lock()
+	subscribed := withoutPairs(r.tradingPairs, tradingPairs)
+	conn, endpoint := r.conn, r.endpoint
+	r.mu.Unlock()
+
+	target := r.exchange.endpoint(r.websocketUrl, subscribed)
+	if target != endpoint && len(subscribed) == 0 {
+		return fmt.Errorf("error while unsubscribing: %s subscribes through the URL, at least one trading pair must stay subscribed", r.exchange.venue())
+	}
+	if target != endpoint {
+		if _, err := r.connect(context.Background(), target); err != nil {
+			return fmt.Errorf("error while unsubscribing: %w", err)
+		}
+	} else if err := r.exchange.unsubscribe(conn, tradingPairs); err != nil {
+		return err
+	}
 
+	r.mu.Lock()
+	r.tradingPairs = subscribed
+	r.mu.Unlock()
+	if r.watchdog != nil {
+		r.watchdog.expire(r.exchange.venue(), tradingPairs)
+	}
+	return nil
 }
 
-// Read receives data points from the coinbase and passes them to the receiver channel.
-func (r *Receiver) Read(ctx context.Context, receiver chan *models.CoinbaseResponse) {
-	//defer close(r.done)
+func containsPair(tradingPairs []string, tradingPair string) bool {
+	for _, pair := range tradingPairs {
+		if pair == tradingPair {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPairs returns the trading pairs but the removed ones, in a new slice.
+func withoutPairs(tradingPairs []string, removed []string) []string {
+	kept := make([]string, 0, len(tradingPairs))
+	for _, tradingPair := range tradingPairs {
+		if !containsPair(removed, tradingPair) {
+			kept = append(kept, tradingPair)
+		}
+	}
+	return kept
+}
+
+// Read receives the trades from the exchange and passes them, normalized and stamped with their receive time,
+// to the receiver channel. When the connection is lost, it redials with a jittered exponential backoff and resubscribes to the last
+// trading pairs, then keeps feeding the same receiver channel. The channel is closed once ctx is done or the
+// Receiver is closed, even when the connection is half-open.
+// A connection that stops answering pings, or silent for the read timeout or the watchdog interval, is dead: it is
+// redialed right away. A Receiver not dialed yet, e.g. of Binance before its first subscription, waits for its
+// connection.
+func (r *Receiver) Read(ctx context.Context, receiver chan *models.Trade) {
+	stopped := make(chan struct{})
+	go r.keepAlive(ctx, stopped)
+	if r.watchdog != nil {
+		go r.watch(ctx, stopped)
+	}
 
 	go func() {
 		defer close(receiver)
+		defer close(stopped)
+		// Frames are read into the same buffer, decoded before the next one is read.
+		var buffer bytes.Buffer
 		for {
 			select {
 			case <-r.done:
 				return
 			case <-ctx.Done():
+				conn := r.connection()
+				if conn == nil {
+					return
+				}
 				// Close the connection completely by sending a close message and then waiting (with timeout) for the coinbase server to do so.
-				err := r.conn.WriteMessage(ws.CloseMessage, ws.FormatCloseMessage(ws.CloseNormalClosure, ""))
+				err := conn.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(ws.CloseNormalClosure, ""),
+					time.Now().Add(controlTimeout))
 				if err != nil {
 					log.Printf("error writing close message %v", err)
 					return
@@ -99,21 +298,273 @@ func (r *Receiver) Read(ctx context.Context, receiver chan *models.CoinbaseRespo
 				return
 
 			default:
-				response := &models.CoinbaseResponse{}
-				err := r.conn.ReadJSON(response)
+				conn := r.connection()
+				if conn == nil {
+					select {
+					case <-r.dialed:
+					case <-r.done:
+					case <-ctx.Done():
+					}
+					continue
+				}
+				frame, err := readFrame(conn, &buffer)
+				if err != nil && conn != r.connection() {
+					// The connection was replaced, e.g. redialed with the streams of a new subscription: read the new one.
+					continue
+				}
 				if err != nil {
+					err = deadConnection(r.exchange.venue(), err)
 					exceptionHandler(err)
+					if ctx.Err() != nil {
+						continue
+					}
+					if err = r.reconnect(ctx, err); err != nil {
+						return
+					}
+					continue
+				}
+				r.alive(conn)
+				receivedAt := time.Now()
+				r.record(frame, receivedAt)
+
+				trades, err := r.exchange.decode(frame)
+				var exchangeErr *ExchangeError
+				if errors.As(err, &exchangeErr) && r.reject(exchangeErr) {
+					continue
+				}
+				if exchangeErr != nil {
+					log.Printf("stopped reading on %v", exchangeErr)
+					r.mu.Lock()
+					r.err = exchangeErr
+					r.mu.Unlock()
 					return
 				}
-				receiver <- response
+				if err != nil {
+					log.Printf("error decoding frame: %v", err)
+					continue
+				}
+				for _, trade := range trades {
+					trade.ReceivedAt = receivedAt
+					if r.watchdog != nil {
+						r.watchdog.observe(trade.Venue, trade.ProductID, receivedAt)
+					}
+					select {
+					case receiver <- trade:
+					case <-ctx.Done():
+					case <-r.done:
+					}
+				}
 			}
 		}
 	}()
 }
 
+// reject drops the trading pairs an ExchangeError rejects, unless the rejections, if any, stop the Receiver on it.
+// It reports whether the Receiver keeps reading.
+func (r *Receiver) reject(err *ExchangeError) bool {
+	if r.rejections == nil || r.rejections.reject(err) != nil {
+		return false
+	}
+
+	r.subMu.Lock()
+	r.mu.Lock()
+	r.tradingPairs = withoutPairs(r.tradingPairs, err.TradingPairs)
+	r.mu.Unlock()
+	r.subMu.Unlock()
+	if r.watchdog != nil {
+		r.watchdog.expire(r.exchange.venue(), err.TradingPairs)
+	}
+	log.Printf("dropped trading pairs %v on %v", err.TradingPairs, err)
+	return true
+}
+
+// Err returns the ExchangeError the Receiver stopped reading on, e.g. a rejected subscription, once the receiver
+// channel is closed. It is nil when reading stopped on cancellation or Close.
+func (r *Receiver) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// LastHeartbeat returns the last heartbeat received for a trading pair, on exchanges sending heartbeats.
+func (r *Receiver) LastHeartbeat(tradingPair string) (Heartbeat, bool) {
+	if exchange, ok := r.exchange.(heartbeats); ok {
+		return exchange.lastHeartbeat(tradingPair)
+	}
+	return Heartbeat{}, false
+}
+
+// keepAlive pings the exchange every PingInterval, and interrupts the read blocked on the connection once ctx is done.
+// It returns once the Receiver is closed or Read stopped.
+func (r *Receiver) keepAlive(ctx context.Context, stopped chan struct{}) {
+	var ticks <-chan time.Time
+	if r.keepalive.PingInterval > 0 {
+		ticker := time.NewTicker(r.keepalive.PingInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// A read never returns on a half-open connection, unless its deadline expires.
+			if conn := r.connection(); conn != nil {
+				_ = conn.SetReadDeadline(time.Now())
+			}
+			return
+		case <-r.done:
+			return
+		case <-stopped:
+			return
+		case <-ticks:
+			conn := r.connection()
+			if conn == nil {
+				continue
+			}
+			if err := r.ping(conn); err != nil {
+				log.Printf("error pinging %s: %v", r.exchange.venue(), err)
+			}
+		}
+	}
+}
+
+// watch drops the connection once no frame was read from it for the watchdog interval, marking all its trading pairs
+// stale, so that Read reconnects. It returns once ctx is done, the Receiver is closed or Read stopped.
+func (r *Receiver) watch(ctx context.Context, stopped chan struct{}) {
+	ticker := time.NewTicker(r.watchdog.Interval() / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.done:
+			return
+		case <-stopped:
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			silent := now.Sub(r.lastFrame)
+			conn, tradingPairs := r.conn, r.tradingPairs
+			if silent >= r.watchdog.Interval() {
+				// Give the reconnect a full interval before dropping the next connection.
+				r.lastFrame = now
+			}
+			r.mu.Unlock()
+
+			if silent < r.watchdog.Interval() {
+				continue
+			}
+			log.Printf("no message from %s for %v, dropping the connection", r.exchange.venue(), silent.Round(time.Millisecond))
+			r.watchdog.expire(r.exchange.venue(), tradingPairs)
+			if conn != nil {
+				// The blocked read fails with a DeadConnectionError.
+				_ = conn.SetReadDeadline(now)
+			}
+		}
+	}
+}
+
+// reconnect redials the websocket, lost on cause, until it succeeds, ctx is done or the Receiver is closed.
+// A DeadConnectionError is redialed right away, as the exchange didn't drop the connection itself.
+func (r *Receiver) reconnect(ctx context.Context, cause error) error {
+	var dead *DeadConnectionError
+	immediate := errors.As(cause, &dead)
+	for attempt := 0; ; attempt++ {
+		delay := r.backoff.Duration(attempt)
+		if immediate && attempt == 0 {
+			delay = 0
+		}
+		log.Printf("reconnecting to %s in %v (attempt %d)", r.websocketUrl, delay, attempt+1)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.done:
+			return errReceiverClosed
+		case <-time.After(delay):
+		}
+
+		if err := r.resubscribe(ctx); err != nil {
+			log.Printf("error while reconnecting to %s: %v", r.websocketUrl, err)
+			continue
+		}
+
+		log.Printf("Successfully reconnected to: %s", r.websocketUrl)
+		return nil
+	}
+}
+
+// resubscribe dials a new connection and subscribes to the trading pairs subscribed to before the connection loss.
+func (r *Receiver) resubscribe(ctx context.Context) error {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	r.mu.Lock()
+	tradingPairs := r.tradingPairs
+	r.mu.Unlock()
+
+	conn, err := r.connect(ctx, r.exchange.endpoint(r.websocketUrl, tradingPairs))
+	if err != nil {
+		return err
+	}
+
+	if len(tradingPairs) > 0 {
+		if err = r.exchange.subscribe(conn, tradingPairs); err != nil {
+			return fmt.Errorf("error while resubscribing: %w", err)
+		}
+	}
+	return nil
+}
+
+// connect dials endpoint and replaces the current connection, if any, with the new one.
+func (r *Receiver) connect(ctx context.Context, endpoint string) (*ws.Conn, error) {
+	conn, _, err := r.dialer.DialContext(ctx, endpoint, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+
+	r.prepare(conn)
+
+	r.mu.Lock()
+	old := r.conn
+	r.conn = conn
+	r.endpoint = endpoint
+	r.mu.Unlock()
+	r.dialedOnce.Do(func() { close(r.dialed) })
+	r.exchange.reset()
+
+	if old != nil {
+		_ = old.Close()
+	}
+	return conn, nil
+}
+
+// record passes a raw frame to the recorder, if any. Recording errors are logged without interrupting the feed.
+func (r *Receiver) record(frame []byte, receivedAt time.Time) {
+	if r.recorder == nil {
+		return
+	}
+	if err := r.recorder.Record(r.exchange.venue(), frame, receivedAt); err != nil {
+		log.Printf("error recording frame: %v", err)
+	}
+}
+
+func (r *Receiver) connection() *ws.Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn
+}
+
 // Close shuts down the websocket connection tunnel and logs any close error.
 func (r *Receiver) Close() {
-	err := r.conn.Close()
+	r.once.Do(func() { close(r.done) })
+
+	conn := r.connection()
+	if conn == nil {
+		return
+	}
+	err := conn.Close()
 	if err != nil {
 		exceptionHandler(err)
 	} else {
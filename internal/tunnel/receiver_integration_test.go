@@ -22,7 +22,7 @@ var (
 
 type ReceiverSuite struct {
 	suite.Suite
-	receiver chan *models.CoinbaseResponse
+	receiver chan *models.Trade
 	ws       Tunnel
 }
 
@@ -33,7 +33,7 @@ func TestReceiverSuite(t *testing.T) {
 func (suite *ReceiverSuite) SetupTest() {
 
 	suite.ws, _ = NewReceiver(url)
-	suite.receiver = make(chan *models.CoinbaseResponse)
+	suite.receiver = make(chan *models.Trade)
 }
 
 func (suite *ReceiverSuite) TearDownTest() {
@@ -48,7 +48,7 @@ func (suite *ReceiverSuite) TestTunnelSubscribe_AndRead() {
 
 	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
 
-	suite.receiver = make(chan *models.CoinbaseResponse)
+	suite.receiver = make(chan *models.Trade)
 
 	err := suite.ws.Subscribe([]string{"BTC-USD"})
 	suite.ws.Read(ctx, suite.receiver)
@@ -66,14 +66,10 @@ func (suite *ReceiverSuite) TestTunnelSubscribe_AndRead() {
 					break
 				}
 
-				//check for a proper response type, since the first one is a subscription msg
-				//&{[{matches [BTC-USD]}]     subscriptions  0 }
-				//Received: &{[{matches [BTC-USD]}]     subscriptions  0 }
-				//Received: &{[]  29303.34 BTC-USD 0.00324023 last_match 2022-05-21T09:12:02.350239Z 341498073 buy}
-				//Received: &{[]  29303.35 BTC-USD 0.0000299 match 2022-05-21T09:12:04.862866Z 341498074 sell}
-				if response.Type == "match" {
-					require.Equal(suite.T(), "BTC-USD", response.ProductID)
-				}
+				//only trades are received, the subscription msg is skipped
+				//Received: &{coinbase BTC-USD 29303.34 0.00324023 buy 341498073 2022-05-21 09:12:02.350239 +0000 UTC ...}
+				//Received: &{coinbase BTC-USD 29303.35 0.0000299 sell 341498074 2022-05-21 09:12:04.862866 +0000 UTC ...}
+				require.Equal(suite.T(), "BTC-USD", response.ProductID)
 				limit++
 			}
 			<-suite.receiver
@@ -1,7 +1,9 @@
 package tunnel
 
 import (
+	"context"
 	ws "github.com/gorilla/websocket"
+	"github.com/reactivejson/vwap-engine/api/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net/http"
@@ -58,6 +60,21 @@ func TestNewTunnel(t *testing.T) {
 	}
 }
 
+func TestNewReceiver_Handshake(t *testing.T) {
+	for _, wantErr := range []bool{false, true} {
+		server := setUpWSServer(wsDial(t, wantErr))
+
+		tunnel, err := NewReceiver(webSocketURL)
+		if wantErr {
+			assert.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			tunnel.Close()
+		}
+		server.Close()
+	}
+}
+
 func TestTunnelr_Close(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -136,3 +153,87 @@ func TestTunnel_Subscribe(t *testing.T) {
 		})
 	}
 }
+
+func TestReceiver_Unsubscribe(t *testing.T) {
+	requests := make(chan models.CoinbaseRequest, 3)
+	server := setUpWSServer(wsRequests(requests))
+	defer server.Close()
+
+	tunnel, err := NewReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+	require.NoError(t, tunnel.Unsubscribe([]string{"ETH-USD"}))
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "SOL-USD"}))
+
+	for _, want := range []models.CoinbaseRequest{
+		{Type: TunnelSubscribe, ProductIDs: []string{"BTC-USD", "ETH-USD"}},
+		{Type: TunnelUnsubscribe, ProductIDs: []string{"ETH-USD"}},
+		{Type: TunnelSubscribe, ProductIDs: []string{"BTC-USD", "SOL-USD"}},
+	} {
+		request := <-requests
+		assert.Equal(t, want.Type, request.Type)
+		assert.Equal(t, want.ProductIDs, request.ProductIDs)
+		assert.Equal(t, []models.Channel{{Name: "matches"}, {Name: "heartbeat"}}, request.Channels)
+	}
+
+	// The trading pairs resubscribed on reconnects.
+	assert.Equal(t, []string{"BTC-USD", "SOL-USD"}, tunnel.(*Receiver).tradingPairs)
+}
+
+func TestReceiver_Read_ShouldReconnectAndResubscribe(t *testing.T) {
+	subscriptions := make(chan models.CoinbaseRequest, 2)
+	server := setUpWSServer(wsDropAfterMatch(t, subscriptions))
+	defer server.Close()
+
+	tunnel, err := NewReceiver(webSocketURL)
+	require.NoError(t, err)
+	defer tunnel.Close()
+	tunnel.(*Receiver).backoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	for _, tradeID := range []int{1, 2} {
+		select {
+		case response, ok := <-receiver:
+			require.True(t, ok, "receiver channel closed after a connection loss")
+			assert.Equal(t, tradeID, response.TradeID)
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trade", "trade_id %d", tradeID)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		sub := <-subscriptions
+		assert.Equal(t, TunnelSubscribe, sub.Type)
+		assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, sub.ProductIDs)
+	}
+}
+
+func TestReceiver_Read_ShouldStopReconnectingOnCancel(t *testing.T) {
+	server := setUpWSServer(wsDropAfterMatch(t, make(chan models.CoinbaseRequest, 2)))
+	tunnel, err := NewReceiver(webSocketURL)
+	require.NoError(t, err)
+	tunnel.(*Receiver).backoff = Backoff{Min: time.Hour, Max: time.Hour}
+
+	// No server to reconnect to: the Receiver keeps waiting for the next attempt until ctx is done.
+	server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+	cancel()
+
+	select {
+	case _, ok := <-receiver:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "receiver channel not closed after cancel")
+	}
+}
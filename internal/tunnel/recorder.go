@@ -0,0 +1,124 @@
+package tunnel
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	// recordingExt is the extension of the recording files.
+	recordingExt = ".ndjson"
+	// recordingTimeFormat names the recording files after their creation time, so they sort chronologically.
+	recordingTimeFormat = "20060102T150405.000000000Z"
+)
+
+// RecordedFrame is a line of a recording: a raw websocket frame with its receive time and the venue it was received from.
+/**
+Sample:
+{"venue":"coinbase","received_at":"2022-05-21T09:12:04.86345Z","frame":{"type":"match","trade_id":341498074,"product_id":"BTC-USD",...}}
+*/
+type RecordedFrame struct {
+	Venue      string          `json:"venue,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Frame      json.RawMessage `json:"frame"`
+}
+
+// Recorder writes every raw frame received by a Receiver to NDJSON files in a directory.
+// A new file is started once the current one would exceed maxBytes.
+type Recorder struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	file     *os.File
+	writer   *bufio.Writer
+	written  int64
+}
+
+// NewRecorder creates a Recorder writing files of at most maxBytes in dir, creating dir if needed.
+func NewRecorder(dir string, maxBytes int64) (*Recorder, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("invalid recording file size %d: must be positive", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating recording directory %s: %w", dir, err)
+	}
+
+	return &Recorder{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Record appends a raw frame received from venue at receivedAt to the current recording file.
+// Receivers of several venues can share a Recorder.
+func (r *Recorder) Record(venue string, frame []byte, receivedAt time.Time) error {
+	line, err := json.Marshal(RecordedFrame{Venue: venue, ReceivedAt: receivedAt.UTC(), Frame: frame})
+	if err != nil {
+		return fmt.Errorf("error encoding recorded frame: %w", err)
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil || (r.written > 0 && r.written+int64(len(line)) > r.maxBytes) {
+		if err = r.rotate(receivedAt); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.writer.Write(line)
+	r.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing recorded frame: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current recording file and starts a new one named after now.
+func (r *Recorder) rotate(now time.Time) error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+
+	name := filepath.Join(r.dir, "feed-"+now.UTC().Format(recordingTimeFormat)+recordingExt)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("error creating recording file %s: %w", name, err)
+	}
+
+	r.file = file
+	r.writer = bufio.NewWriter(file)
+	r.written = 0
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	if err := r.writer.Flush(); err != nil {
+		return fmt.Errorf("error flushing recording file %s: %w", r.file.Name(), err)
+	}
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("error closing recording file %s: %w", r.file.Name(), err)
+	}
+	r.file = nil
+	return nil
+}
+
+// Close flushes and closes the current recording file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.closeFile()
+}
@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+var recordStart = time.Date(2022, 5, 21, 9, 12, 0, 0, time.UTC)
+
+func TestNewRecorder_WithInvalidSize_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRecorder(t.TempDir(), 0)
+	require.Error(t, err)
+}
+
+func TestRecorder_Record_ShouldRotateFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, 150)
+	require.NoError(t, err)
+
+	frame := []byte(`{"type":"match","trade_id":1,"product_id":"BTC-USD","size":"1","price":"1"}`)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, recorder.Record(VenueCoinbase, frame, recordStart.Add(time.Duration(i)*time.Second)))
+	}
+	require.NoError(t, recorder.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "feed-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	f, err := os.Open(files[1])
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	require.True(t, scanner.Scan())
+	var recorded RecordedFrame
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &recorded))
+	assert.Equal(t, recordStart.Add(time.Second), recorded.ReceivedAt)
+	assert.JSONEq(t, string(frame), string(recorded.Frame))
+	assert.False(t, scanner.Scan())
+}
+
+func TestRecorder_ShouldReplayTheReceivedFeed(t *testing.T) {
+	server := setUpWSServer(wsDropAfterMatch(t, make(chan models.CoinbaseRequest, 2)))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, 1<<20)
+	require.NoError(t, err)
+
+	tunnel, err := NewReceiver(webSocketURL, WithRecorder(recorder))
+	require.NoError(t, err)
+	tunnel.(*Receiver).backoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	tunnel.Read(ctx, receiver)
+
+	var live []*models.Trade
+	for len(live) < 2 {
+		select {
+		case response := <-receiver:
+			live = append(live, response)
+		case <-ctx.Done():
+			require.Fail(t, "timeout waiting for trades")
+		}
+	}
+	tunnel.Close()
+	require.NoError(t, recorder.Close())
+
+	replayer, err := NewReplayer(VenueCoinbase, filepath.Join(dir, "*.ndjson"), 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, replayer.Subscribe([]string{"BTC-USD"}))
+
+	replayed := make(chan *models.Trade)
+	replayer.Read(context.Background(), replayed)
+	for _, trade := range live {
+		replayedTrade := <-replayed
+		assert.Equal(t, trade.TradeID, replayedTrade.TradeID)
+		assert.Equal(t, trade.Price, replayedTrade.Price)
+		assert.True(t, trade.ReceivedAt.Equal(replayedTrade.ReceivedAt))
+	}
+}
@@ -0,0 +1,232 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"log"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Redundant is a Tunnel merging hot-hot redundant legs, independent connections receiving the same trading pairs,
+// e.g. to two endpoints of a venue. The first copy of every (venue, product, trade ID) is passed on and the later
+// ones are discarded, so a leg dying leaves the feed without gap as long as another one is alive.
+// Trades without trade ID can't be deduplicated: they are only passed on from the primary leg, the first one, failing
+// over to the next leg still read once its channel is closed.
+type Redundant struct {
+	legs     []Tunnel
+	seen     *dedup
+	counters *metrics.Counters
+
+	mu sync.Mutex
+	// primary is the leg the trades without trade ID are passed on from. stopped is set for the legs whose channel
+	// is closed.
+	primary int
+	stopped []bool
+}
+
+// NewRedundant creates a Tunnel merging legs, remembering the last capacity trade IDs of every product to discard
+// duplicates. The trades delivered first and discarded by every leg are counted in counters.
+func NewRedundant(counters *metrics.Counters, capacity int, legs ...Tunnel) Tunnel {
+	return &Redundant{
+		legs:     legs,
+		seen:     newDedup(capacity),
+		counters: counters,
+		stopped:  make([]bool, len(legs)),
+	}
+}
+
+// Subscribe subscribes every leg to the trading pairs. It only fails when every leg fails, with the first error.
+func (r *Redundant) Subscribe(tradingPairs []string) error {
+	return r.each("subscribing", func(leg Tunnel) error { return leg.Subscribe(tradingPairs) })
+}
+
+// Unsubscribe unsubscribes every leg from the trading pairs. It only fails when every leg fails, with the first error.
+func (r *Redundant) Unsubscribe(tradingPairs []string) error {
+	return r.each("unsubscribing", func(leg Tunnel) error { return leg.Unsubscribe(tradingPairs) })
+}
+
+func (r *Redundant) each(action string, request func(leg Tunnel) error) error {
+	var first error
+	failed := 0
+	for i, leg := range r.legs {
+		if err := request(leg); err != nil {
+			log.Printf("error while %s leg %d: %v", action, i, err)
+			if first == nil {
+				first = fmt.Errorf("error while %s leg %d: %w", action, i, err)
+			}
+			failed++
+		}
+	}
+	if failed < len(r.legs) {
+		return nil
+	}
+	return first
+}
+
+// Read passes the first copy of every trade of the legs to the receiver channel, which is closed once all of them
+// are done. A leg stopping on an error doesn't stop the others.
+func (r *Redundant) Read(ctx context.Context, receiver chan *models.Trade) {
+	var wg sync.WaitGroup
+	for i, leg := range r.legs {
+		trades := make(chan *models.Trade)
+		leg.Read(ctx, trades)
+
+		wg.Add(1)
+		go func(i int, leg Tunnel, trades chan *models.Trade) {
+			defer wg.Done()
+			label := strconv.Itoa(i)
+			// Trades are drained until the leg closes its channel, even once ctx is done.
+			for trade := range trades {
+				if !r.first(i, trade) {
+					r.counters.Add(metrics.Name("redundant_duplicates_total", "leg", label), 1)
+					continue
+				}
+				r.counters.Add(metrics.Name("redundant_first_total", "leg", label), 1)
+				select {
+				case receiver <- trade:
+				case <-ctx.Done():
+				}
+			}
+			if err := leg.Err(); err != nil {
+				log.Printf("leg %d stopped: %v", i, err)
+			}
+			r.stop(i)
+		}(i, leg, trades)
+	}
+
+	go func() {
+		wg.Wait()
+		close(receiver)
+	}()
+}
+
+// first reports whether a trade received by a leg is the first copy of it.
+func (r *Redundant) first(leg int, trade *models.Trade) bool {
+	if trade.TradeID == 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return leg == r.primary
+	}
+	return r.seen.first(trade.Venue, trade.ProductID, trade.TradeID)
+}
+
+// stop marks a leg whose channel is closed, failing over to the first leg still read if it is the primary one.
+func (r *Redundant) stop(leg int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopped[leg] = true
+	if leg != r.primary {
+		return
+	}
+	for i, stopped := range r.stopped {
+		if !stopped {
+			r.primary = i
+			log.Printf("leg %d is now the primary leg of the trades without trade ID", i)
+			return
+		}
+	}
+}
+
+// Err returns the first error a leg stopped on, if any.
+func (r *Redundant) Err() error {
+	for _, leg := range r.legs {
+		if err := leg.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every leg.
+func (r *Redundant) Close() {
+	for _, leg := range r.legs {
+		leg.Close()
+	}
+}
+
+// dedup remembers the last trade IDs seen per venue and product, at most capacity each.
+type dedup struct {
+	capacity int
+
+	mu      sync.Mutex
+	windows map[string]*dedupWindow
+}
+
+// dedupWindow is a FIFO of the last trade IDs of a product. Trade IDs increasing, those at or below floor, the highest
+// one evicted, are considered seen as well.
+type dedupWindow struct {
+	ids   map[int]struct{}
+	ring  []int
+	next  int
+	floor int
+}
+
+func newDedup(capacity int) *dedup {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &dedup{capacity: capacity, windows: make(map[string]*dedupWindow)}
+}
+
+// first reports whether a trade ID of a product is seen for the first time, and remembers it.
+func (d *dedup) first(venue, productID string, tradeID int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := venue + "|" + productID
+	window, ok := d.windows[key]
+	if !ok {
+		window = &dedupWindow{ids: make(map[int]struct{}, d.capacity), ring: make([]int, 0, d.capacity)}
+		d.windows[key] = window
+	}
+
+	if _, seen := window.ids[tradeID]; seen || tradeID <= window.floor {
+		return false
+	}
+
+	if len(window.ring) < d.capacity {
+		window.ring = append(window.ring, tradeID)
+	} else {
+		evicted := window.ring[window.next]
+		delete(window.ids, evicted)
+		if evicted > window.floor {
+			window.floor = evicted
+		}
+		window.ring[window.next] = tradeID
+		window.next = (window.next + 1) % d.capacity
+	}
+	window.ids[tradeID] = struct{}{}
+	return true
+}
+
+// ParseLegURLs parses the endpoints of the redundant legs of venues, as venue=url entries, e.g.
+// coinbase=wss://ws-feed-backup.example.com. They are returned in order by venue.
+func ParseLegURLs(entries []string) (map[string][]string, error) {
+	legURLs := make(map[string][]string)
+	for _, entry := range entries {
+		venue, websocketUrl, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid leg %q: must be venue=url", entry)
+		}
+		if _, err := newExchange(venue); err != nil {
+			return nil, fmt.Errorf("invalid leg %q: %w", entry, err)
+		}
+		parsed, err := neturl.Parse(websocketUrl)
+		if err != nil || (parsed.Scheme != "ws" && parsed.Scheme != "wss") {
+			return nil, fmt.Errorf("invalid leg %q: the URL must be ws:// or wss://", entry)
+		}
+		legURLs[venue] = append(legURLs[venue], websocketUrl)
+	}
+	return legURLs, nil
+}
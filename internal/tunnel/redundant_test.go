@@ -0,0 +1,183 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/reactivejson/vwap-engine/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func trades(productID string, tradeIDs ...int) []*models.Trade {
+	result := make([]*models.Trade, 0, len(tradeIDs))
+	for _, tradeID := range tradeIDs {
+		result = append(result, &models.Trade{Venue: VenueCoinbase, ProductID: productID, TradeID: tradeID})
+	}
+	return result
+}
+
+func TestRedundant_Read_ShouldKeepFirstCopy(t *testing.T) {
+	t.Parallel()
+
+	counters := metrics.NewCounters()
+	// The second leg is missing trade 3, as if it had reconnected, and has trade 6 only.
+	primary := &fakeTunnel{trades: trades("BTC-USD", 1, 2, 3, 4, 5)}
+	backup := &fakeTunnel{trades: append(trades("BTC-USD", 1, 2, 4, 5, 6), trades("ETH-USD", 1)...)}
+	redundant := NewRedundant(counters, 100, primary, backup)
+
+	receiver := make(chan *models.Trade)
+	redundant.Read(context.Background(), receiver)
+
+	received := make(map[string][]int)
+	for trade := range receiver {
+		received[trade.ProductID] = append(received[trade.ProductID], trade.TradeID)
+	}
+	assert.ElementsMatch(t, []int{1, 2, 3, 4, 5, 6}, received["BTC-USD"])
+	assert.Equal(t, []int{1}, received["ETH-USD"])
+
+	first := counters.Get(metrics.Name("redundant_first_total", "leg", "0")) +
+		counters.Get(metrics.Name("redundant_first_total", "leg", "1"))
+	duplicates := counters.Get(metrics.Name("redundant_duplicates_total", "leg", "0")) +
+		counters.Get(metrics.Name("redundant_duplicates_total", "leg", "1"))
+	assert.Equal(t, uint64(7), first)
+	assert.Equal(t, uint64(4), duplicates)
+	require.NoError(t, redundant.Err())
+
+	redundant.Close()
+	assert.True(t, primary.closed)
+	assert.True(t, backup.closed)
+}
+
+func TestRedundant_Read_ShouldPassTradesWithoutIDFromFirstLeg(t *testing.T) {
+	t.Parallel()
+
+	redundant := NewRedundant(metrics.NewCounters(), 100,
+		&fakeTunnel{trades: trades("BTC-USD", 0, 0)},
+		&fakeTunnel{trades: trades("BTC-USD", 0, 0, 0)})
+
+	receiver := make(chan *models.Trade)
+	redundant.Read(context.Background(), receiver)
+
+	count := 0
+	for range receiver {
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+// feedTunnel passes on the trades sent to feed once read, until feed is closed.
+type feedTunnel struct {
+	fakeTunnel
+	feed chan *models.Trade
+}
+
+func (f *feedTunnel) Read(_ context.Context, receiver chan *models.Trade) {
+	go func() {
+		defer close(receiver)
+		for trade := range f.feed {
+			receiver <- trade
+		}
+	}()
+}
+
+func TestRedundant_Read_ShouldFailOverTradesWithoutIDWhenFirstLegStops(t *testing.T) {
+	t.Parallel()
+
+	counters := metrics.NewCounters()
+	first := &feedTunnel{feed: make(chan *models.Trade)}
+	second := &feedTunnel{feed: make(chan *models.Trade)}
+	redundant := NewRedundant(counters, 100, first, second).(*Redundant)
+
+	receiver := make(chan *models.Trade)
+	redundant.Read(context.Background(), receiver)
+
+	first.feed <- &models.Trade{ProductID: "BTC-USD", Price: "1"}
+	assert.Equal(t, "1", (<-receiver).Price)
+	second.feed <- &models.Trade{ProductID: "BTC-USD", Price: "1"}
+	require.Eventually(t, func() bool {
+		return counters.Get(metrics.Name("redundant_duplicates_total", "leg", "1")) == 1
+	}, time.Second, time.Millisecond)
+
+	close(first.feed)
+	require.Eventually(t, func() bool {
+		redundant.mu.Lock()
+		defer redundant.mu.Unlock()
+		return redundant.primary == 1
+	}, time.Second, time.Millisecond)
+
+	second.feed <- &models.Trade{ProductID: "BTC-USD", Price: "2"}
+	assert.Equal(t, "2", (<-receiver).Price)
+	close(second.feed)
+	_, ok := <-receiver
+	assert.False(t, ok)
+}
+
+func TestRedundant_Subscribe_ShouldFailOnlyWhenEveryLegFails(t *testing.T) {
+	t.Parallel()
+
+	healthy := &fakeTunnel{}
+	redundant := NewRedundant(metrics.NewCounters(), 100, &fakeTunnel{subscribeErr: errors.New("connection lost")}, healthy)
+	require.NoError(t, redundant.Subscribe([]string{"BTC-USD"}))
+	assert.Equal(t, []string{"BTC-USD"}, healthy.tradingPairs)
+
+	redundant = NewRedundant(metrics.NewCounters(), 100,
+		&fakeTunnel{subscribeErr: errors.New("connection lost")},
+		&fakeTunnel{subscribeErr: errors.New("connection refused")})
+	err := redundant.Subscribe([]string{"BTC-USD"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection lost")
+}
+
+func TestDedup_First_ShouldBeBounded(t *testing.T) {
+	t.Parallel()
+
+	seen := newDedup(3)
+	for _, tradeID := range []int{1, 2, 3} {
+		assert.True(t, seen.first(VenueCoinbase, "BTC-USD", tradeID))
+	}
+	assert.False(t, seen.first(VenueCoinbase, "BTC-USD", 2))
+	// Trade IDs are per venue and product.
+	assert.True(t, seen.first(VenueBinance, "BTC-USD", 2))
+	assert.True(t, seen.first(VenueCoinbase, "ETH-USD", 2))
+
+	// 5 evicts 1, then 6 evicts 2: both are still seen, being at or below the highest trade ID evicted.
+	assert.True(t, seen.first(VenueCoinbase, "BTC-USD", 5))
+	assert.True(t, seen.first(VenueCoinbase, "BTC-USD", 6))
+	window := seen.windows[VenueCoinbase+"|BTC-USD"]
+	assert.Len(t, window.ids, 3)
+	assert.Equal(t, 2, window.floor)
+	assert.False(t, seen.first(VenueCoinbase, "BTC-USD", 1))
+	assert.False(t, seen.first(VenueCoinbase, "BTC-USD", 2))
+	// A late trade ID above the floor is still accepted once.
+	assert.True(t, seen.first(VenueCoinbase, "BTC-USD", 4))
+	assert.False(t, seen.first(VenueCoinbase, "BTC-USD", 4))
+}
+
+func TestParseLegURLs(t *testing.T) {
+	t.Parallel()
+
+	legURLs, err := ParseLegURLs([]string{
+		"coinbase=wss://ws-feed.exchange.coinbase.com",
+		"coinbase=wss://ws-feed-backup.example.com",
+		"kraken=wss://ws.kraken.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		VenueCoinbase: {"wss://ws-feed.exchange.coinbase.com", "wss://ws-feed-backup.example.com"},
+		VenueKraken:   {"wss://ws.kraken.com"},
+	}, legURLs)
+
+	for _, entry := range []string{"wss://ws.kraken.com", "ftx=wss://ftx.com/ws", "coinbase=https://api.coinbase.com"} {
+		_, err = ParseLegURLs([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
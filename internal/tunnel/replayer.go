@@ -0,0 +1,270 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// maxRecordedFrameSize is the longest line of a recording the Replayer can read.
+const maxRecordedFrameSize = 1 << 20
+
+// Replayer is a Tunnel reading the frames of recordings written by a Recorder instead of the websocket.
+// Frames are replayed with the delays they were received with, divided by speed: 1 replays in real time,
+// N replays N times faster and 0 replays as fast as the consumer reads.
+// Trades are stamped with the time their frame was received at when it was recorded.
+// Frames are decoded with the protocol of the venue they were recorded from, so recordings of several venues
+// replay their consolidated feed.
+type Replayer struct {
+	files     []string
+	speed     float64
+	venue     string
+	symbolMap SymbolMap
+
+	mu           sync.Mutex
+	exchanges    map[string]exchange // exchange by venue
+	tradingPairs map[string]bool
+	err          error
+	done         chan struct{}
+	once         sync.Once
+}
+
+// NewReplayer creates a Replayer of the recording files matching pattern (e.g. /data/feed-*.ndjson), in name order,
+// which is the order they were written in by a Recorder. Frames recorded without their venue are decoded with
+// the protocol of venue, e.g. coinbase. symbolMap overrides the venue symbols of trading pairs, as for a Receiver.
+func NewReplayer(venue, pattern string, speed float64, symbolMap SymbolMap) (Tunnel, error) {
+	if _, err := newExchange(venue); err != nil {
+		return nil, err
+	}
+	if speed < 0 {
+		return nil, fmt.Errorf("invalid replay speed %v: must be positive, or 0 for maximum speed", speed)
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay pattern %s: %w", pattern, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recording matches %s", pattern)
+	}
+	sort.Strings(files)
+
+	return &Replayer{
+		files:     files,
+		speed:     speed,
+		venue:     venue,
+		symbolMap: symbolMap,
+		exchanges: make(map[string]exchange),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Subscribe restricts the replayed trades to the trading pairs (productIDs), added to those subscribed to before.
+func (r *Replayer) Subscribe(tradingPairs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tradingPairs == nil {
+		r.tradingPairs = make(map[string]bool, len(tradingPairs))
+	}
+	for _, tradingPair := range tradingPairs {
+		r.tradingPairs[tradingPair] = true
+	}
+
+	// Exchanges map the symbols of the subscribed trading pairs back to them.
+	for _, exchange := range r.exchanges {
+		exchange.endpoint("", r.subscribedPairs())
+	}
+	return nil
+}
+
+// Unsubscribe stops replaying the trades of the trading pairs.
+func (r *Replayer) Unsubscribe(tradingPairs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tradingPairs == nil {
+		r.tradingPairs = make(map[string]bool)
+	}
+	for _, tradingPair := range tradingPairs {
+		delete(r.tradingPairs, tradingPair)
+	}
+	return nil
+}
+
+// subscribedPairs returns the subscribed trading pairs. r.mu must be held.
+func (r *Replayer) subscribedPairs() []string {
+	tradingPairs := make([]string, 0, len(r.tradingPairs))
+	for tradingPair := range r.tradingPairs {
+		tradingPairs = append(tradingPairs, tradingPair)
+	}
+	return tradingPairs
+}
+
+// Read replays the trades of the recorded frames to the receiver channel, which is closed at the end of the recording,
+// once ctx is done or the Replayer is closed.
+func (r *Replayer) Read(ctx context.Context, receiver chan *models.Trade) {
+	go func() {
+		defer close(receiver)
+
+		var previous time.Time
+		for _, file := range r.files {
+			err := r.replay(ctx, file, &previous, receiver)
+			if err != nil {
+				log.Printf("error replaying %s: %v", file, err)
+				r.mu.Lock()
+				r.err = fmt.Errorf("error replaying %s: %w", file, err)
+				r.mu.Unlock()
+				return
+			}
+		}
+		log.Printf("Replay completed: %d recording(s)", len(r.files))
+	}()
+}
+
+// replay sends the frames of a recording file. previous is the receive time of the last frame sent,
+// carried across files to keep the delays between them.
+func (r *Replayer) replay(ctx context.Context, file string, previous *time.Time, receiver chan *models.Trade) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordedFrameSize)
+	for line := 1; scanner.Scan(); line++ {
+		var recorded RecordedFrame
+		if err = json.Unmarshal(scanner.Bytes(), &recorded); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		exchange, err := r.exchange(recorded.Venue)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		trades, err := exchange.decode(recorded.Frame)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		trades = r.subscribed(trades)
+		if len(trades) == 0 {
+			continue
+		}
+
+		if err = r.wait(ctx, *previous, recorded.ReceivedAt); err != nil {
+			return nil
+		}
+		*previous = recorded.ReceivedAt
+
+		for _, trade := range trades {
+			trade.ReceivedAt = recorded.ReceivedAt
+			select {
+			case receiver <- trade:
+			case <-ctx.Done():
+				return nil
+			case <-r.done:
+				return nil
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// exchange returns the exchange decoding the frames of venue, the default venue if empty.
+func (r *Replayer) exchange(venue string) (exchange, error) {
+	if venue == "" {
+		venue = r.venue
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if exchange, ok := r.exchanges[venue]; ok {
+		return exchange, nil
+	}
+	exchange, err := newExchange(venue)
+	if err != nil {
+		return nil, err
+	}
+	exchange.symbols().override(r.symbolMap[venue])
+	exchange.endpoint("", r.subscribedPairs())
+
+	r.exchanges[venue] = exchange
+	return exchange, nil
+}
+
+// wait sleeps for the delay between two received frames, scaled by speed.
+// It returns an error once ctx is done or the Replayer is closed.
+func (r *Replayer) wait(ctx context.Context, previous, receivedAt time.Time) error {
+	var delay time.Duration
+	if r.speed > 0 && !previous.IsZero() {
+		delay = time.Duration(float64(receivedAt.Sub(previous)) / r.speed)
+	}
+
+	if delay <= 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.done:
+			return errReceiverClosed
+		default:
+			return nil
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.done:
+		return errReceiverClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+// subscribed filters the trades of the subscribed trading pairs, all of them without subscription.
+func (r *Replayer) subscribed(trades []*models.Trade) []*models.Trade {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tradingPairs == nil {
+		return trades
+	}
+
+	filtered := trades[:0]
+	for _, trade := range trades {
+		if r.tradingPairs[trade.ProductID] {
+			filtered = append(filtered, trade)
+		}
+	}
+	return filtered
+}
+
+// Err returns the error the replay stopped on, if any, once the receiver channel is closed.
+func (r *Replayer) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close stops the replay.
+func (r *Replayer) Close() {
+	r.once.Do(func() { close(r.done) })
+	log.Printf("Replay closed")
+}
@@ -0,0 +1,150 @@
+package tunnel
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// writeRecording records a match for each product, one every interval.
+func writeRecording(t *testing.T, interval time.Duration, productIDs ...string) string {
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, 1<<20)
+	require.NoError(t, err)
+
+	for i, productID := range productIDs {
+		frame := []byte(`{"type":"match","trade_id":` + strconv.Itoa(i+1) + `,"product_id":"` + productID + `","size":"1","price":"1"}`)
+		require.NoError(t, recorder.Record(VenueCoinbase, frame, recordStart.Add(time.Duration(i)*interval)))
+	}
+	require.NoError(t, recorder.Close())
+
+	return filepath.Join(dir, "*.ndjson")
+}
+
+func TestNewReplayer_WithoutRecording_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewReplayer(VenueCoinbase, filepath.Join(t.TempDir(), "*.ndjson"), 1, nil)
+	require.Error(t, err)
+
+	_, err = NewReplayer(VenueCoinbase, writeRecording(t, time.Second, "BTC-USD"), -1, nil)
+	require.Error(t, err)
+}
+
+func TestReplayer_Read_ShouldReplaySubscribedPairs(t *testing.T) {
+	t.Parallel()
+
+	// At maximum speed, the hour between the recorded frames is skipped.
+	replayer, err := NewReplayer(VenueCoinbase, writeRecording(t, time.Hour, "BTC-USD", "ETH-USD", "BTC-USD"), 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, replayer.Subscribe([]string{"BTC-USD"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiver := make(chan *models.Trade)
+	replayer.Read(ctx, receiver)
+
+	var tradeIDs []int
+	for response := range receiver {
+		assert.Equal(t, "BTC-USD", response.ProductID)
+		tradeIDs = append(tradeIDs, response.TradeID)
+	}
+	require.NoError(t, ctx.Err())
+	assert.Equal(t, []int{1, 3}, tradeIDs)
+}
+
+func TestReplayer_Read_ShouldScaleDelays(t *testing.T) {
+	t.Parallel()
+
+	// 400ms between frames replayed 4 times faster.
+	replayer, err := NewReplayer(VenueCoinbase, writeRecording(t, 400*time.Millisecond, "BTC-USD", "BTC-USD"), 4, nil)
+	require.NoError(t, err)
+
+	receiver := make(chan *models.Trade)
+	replayer.Read(context.Background(), receiver)
+
+	<-receiver
+	start := time.Now()
+	<-receiver
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.Less(t, elapsed, 400*time.Millisecond)
+}
+
+func TestReplayer_Close_ShouldStopTheReplay(t *testing.T) {
+	t.Parallel()
+
+	replayer, err := NewReplayer(VenueCoinbase, writeRecording(t, time.Hour, "BTC-USD", "BTC-USD"), 1, nil)
+	require.NoError(t, err)
+
+	receiver := make(chan *models.Trade)
+	replayer.Read(context.Background(), receiver)
+	<-receiver
+	replayer.Close()
+
+	select {
+	case _, ok := <-receiver:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "receiver channel not closed after Close")
+	}
+}
+
+func TestReplayer_ShouldDecodeFrames_WithTheirVenue(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, 1<<20)
+	require.NoError(t, err)
+	require.NoError(t, recorder.Record(VenueCoinbase,
+		[]byte(`{"type":"match","trade_id":1,"product_id":"BTC-USD","size":"1","price":"1"}`), recordStart))
+	require.NoError(t, recorder.Record(VenueKraken,
+		[]byte(`{"channel":"trade","type":"update","data":[{"symbol":"XBT/USD","side":"buy","price":2,"qty":1,"trade_id":2,"timestamp":"2022-05-21T09:12:04.862866Z"}]}`),
+		recordStart.Add(time.Second)))
+	require.NoError(t, recorder.Close())
+
+	replayer, err := NewReplayer(VenueCoinbase, filepath.Join(dir, "*.ndjson"), 0,
+		SymbolMap{VenueKraken: {"BTC-USD": "XBT/USD"}})
+	require.NoError(t, err)
+	require.NoError(t, replayer.Subscribe([]string{"BTC-USD"}))
+
+	receiver := make(chan *models.Trade)
+	replayer.Read(context.Background(), receiver)
+
+	var venues []string
+	for trade := range receiver {
+		assert.Equal(t, "BTC-USD", trade.ProductID)
+		venues = append(venues, trade.Venue)
+	}
+	assert.Equal(t, []string{VenueCoinbase, VenueKraken}, venues)
+}
+
+func TestReplayer_Unsubscribe_ShouldFilterTradingPairs(t *testing.T) {
+	t.Parallel()
+
+	replayer, err := NewReplayer(VenueCoinbase, writeRecording(t, time.Hour, "BTC-USD", "ETH-USD", "SOL-USD"), 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, replayer.Subscribe([]string{"BTC-USD", "ETH-USD"}))
+	require.NoError(t, replayer.Subscribe([]string{"SOL-USD"}))
+	require.NoError(t, replayer.Unsubscribe([]string{"ETH-USD"}))
+
+	receiver := make(chan *models.Trade)
+	replayer.Read(context.Background(), receiver)
+
+	var productIDs []string
+	for trade := range receiver {
+		productIDs = append(productIDs, trade.ProductID)
+	}
+	assert.Equal(t, []string{"BTC-USD", "SOL-USD"}, productIDs)
+}
@@ -0,0 +1,108 @@
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// SymbolMap overrides the venue symbols of our canonical trading pairs: venue symbol by trading pair, by venue.
+// e.g. {"binance": {"BTC-USD": "BTCFDUSD"}} subscribes to BTCFDUSD on Binance and reports its trades as BTC-USD.
+type SymbolMap map[string]map[string]string
+
+// ParseSymbolMap parses overrides written as <venue>/<trading pair> keys and venue symbol values,
+// e.g. {"binance/BTC-USD": "BTCFDUSD", "kraken/BTC-USD": "XBT/USD"}.
+func ParseSymbolMap(overrides map[string]string) (SymbolMap, error) {
+	symbolMap := make(SymbolMap)
+	for key, symbol := range overrides {
+		venue, tradingPair, ok := strings.Cut(key, "/")
+		if !ok || venue == "" || tradingPair == "" || symbol == "" {
+			return nil, fmt.Errorf("invalid symbol override %s:%s, expecting <venue>/<trading pair>:<symbol>", key, symbol)
+		}
+		if _, err := newExchange(venue); err != nil {
+			return nil, fmt.Errorf("invalid symbol override %s:%s: %w", key, symbol, err)
+		}
+
+		if symbolMap[venue] == nil {
+			symbolMap[venue] = make(map[string]string)
+		}
+		symbolMap[venue][tradingPair] = symbol
+	}
+	return symbolMap, nil
+}
+
+// symbols maps our canonical trading pairs (e.g. BTC-USD) to the symbols of a venue (e.g. BTCUSDT) and back.
+// Overrides take precedence over the venue's naming convention, and the symbol of a subscribed trading pair
+// always maps back to the pair it was subscribed with.
+type symbols struct {
+	mu        sync.RWMutex
+	toVenue   func(tradingPair string) string
+	toPair    func(symbol string) string
+	overrides map[string]string // venue symbol by trading pair
+	pairs     map[string]string // trading pair by venue symbol
+}
+
+func newSymbols(toVenue, toPair func(string) string) *symbols {
+	return &symbols{
+		toVenue:   toVenue,
+		toPair:    toPair,
+		overrides: make(map[string]string),
+		pairs:     make(map[string]string),
+	}
+}
+
+// identity is the naming convention of venues using our canonical trading pairs, such as Coinbase.
+func identity(name string) string {
+	return name
+}
+
+// override replaces the venue symbols of trading pairs.
+func (s *symbols) override(overrides map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tradingPair, symbol := range overrides {
+		s.overrides[tradingPair] = symbol
+		s.pairs[symbol] = tradingPair
+	}
+}
+
+// venue returns the venue symbol of a trading pair and remembers the way back.
+func (s *symbols) venue(tradingPair string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol, ok := s.overrides[tradingPair]
+	if !ok {
+		symbol = s.toVenue(tradingPair)
+	}
+	s.pairs[symbol] = tradingPair
+	return symbol
+}
+
+// pair returns the trading pair of a venue symbol.
+func (s *symbols) pair(symbol string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if tradingPair, ok := s.pairs[symbol]; ok {
+		return tradingPair
+	}
+	return s.toPair(symbol)
+}
+
+// pairOf returns the trading pair of a venue symbol read from a frame, without allocating when it is known.
+func (s *symbols) pairOf(symbol []byte) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if tradingPair, ok := s.pairs[string(symbol)]; ok {
+		return tradingPair
+	}
+	return s.toPair(string(symbol))
+}
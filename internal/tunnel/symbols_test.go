@@ -0,0 +1,57 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestParseSymbolMap(t *testing.T) {
+	t.Parallel()
+
+	symbolMap, err := ParseSymbolMap(map[string]string{
+		"binance/BTC-USD": "BTCFDUSD",
+		"kraken/BTC-USD":  "XBT/USD",
+		"kraken/ETH-USD":  "ETH/USD",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SymbolMap{
+		VenueBinance: {"BTC-USD": "BTCFDUSD"},
+		VenueKraken:  {"BTC-USD": "XBT/USD", "ETH-USD": "ETH/USD"},
+	}, symbolMap)
+
+	for _, overrides := range []map[string]string{
+		{"BTC-USD": "BTCUSDT"},
+		{"binance/": "BTCUSDT"},
+		{"binance/BTC-USD": ""},
+		{"ftx/BTC-USD": "BTC/USD"},
+	} {
+		_, err = ParseSymbolMap(overrides)
+		assert.Error(t, err, overrides)
+	}
+}
+
+func TestSymbols_ShouldMapOverrides_BothWays(t *testing.T) {
+	t.Parallel()
+
+	b := newBinance()
+	b.symbols().override(map[string]string{"BTC-USD": "BTCFDUSD"})
+
+	assert.Equal(t, "wss://stream.binance.com:9443/stream?streams=btcfdusd@trade/ethusdt@trade",
+		b.endpoint("wss://stream.binance.com:9443", []string{"BTC-USD", "ETH-USD"}))
+	assert.Equal(t, "BTC-USD", b.symbols().pair("BTCFDUSD"))
+	assert.Equal(t, "ETH-USD", b.symbols().pair("ETHUSDT"))
+	// Symbols of trading pairs never subscribed follow the naming convention of the venue.
+	assert.Equal(t, "SOL-USD", b.symbols().pair("SOLUSDT"))
+
+	c := newCoinbase()
+	trades, err := c.decode([]byte(`{"type":"match","trade_id":1,"product_id":"BTC-USD","size":"1","price":"1"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "BTC-USD", trades[0].ProductID)
+}
@@ -2,6 +2,7 @@ package tunnel
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	ws "github.com/gorilla/websocket"
 	"github.com/reactivejson/vwap-engine/api/models"
@@ -9,6 +10,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 )
 
@@ -64,6 +69,233 @@ func wsSuccess(t *testing.T) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// wsDropAfterMatch accepts a subscription, sends a single match whose trade_id is the connection number,
+// then drops the connection to force the Receiver to reconnect.
+func wsDropAfterMatch(t *testing.T, subscriptions chan models.CoinbaseRequest) func(w http.ResponseWriter, r *http.Request) {
+	var connections int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		subMsg := models.CoinbaseRequest{}
+		if err = conn.ReadJSON(&subMsg); err != nil {
+			return
+		}
+		subscriptions <- subMsg
+
+		tradeID := int(atomic.AddInt32(&connections, 1))
+		err = conn.WriteJSON(models.CoinbaseResponse{
+			Type:      "match",
+			ProductID: "BTC-USD",
+			Price:     "1",
+			Size:      "1",
+			TradeID:   tradeID,
+		})
+		assert.NoError(t, err)
+	}
+}
+
+// wsRequests sends every request read from the connection to the requests channel, without answering.
+func wsRequests(requests chan models.CoinbaseRequest) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			request := models.CoinbaseRequest{}
+			if err = conn.ReadJSON(&request); err != nil {
+				return
+			}
+			requests <- request
+		}
+	}
+}
+
+// wsAnswers answers every request read with the next message of answers, then only reads.
+func wsAnswers(t *testing.T, answers ...string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for i := 0; ; i++ {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+			if i < len(answers) {
+				assert.NoError(t, conn.WriteMessage(ws.TextMessage, []byte(answers[i])))
+			}
+		}
+	}
+}
+
+// wsUnresponsive reads a subscription, sent to the requests channel, then neither reads nor writes anymore until
+// release is closed, like the peer of a half-open connection: pings are never answered.
+func wsUnresponsive(requests chan models.CoinbaseRequest, release chan struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		request := models.CoinbaseRequest{}
+		if err = conn.ReadJSON(&request); err != nil {
+			return
+		}
+		requests <- request
+		<-release
+	}
+}
+
+// wsReject reads a subscription and answers it with message, e.g. an error.
+func wsReject(t *testing.T, message string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		request := models.CoinbaseRequest{}
+		if err = conn.ReadJSON(&request); err != nil {
+			return
+		}
+		assert.NoError(t, conn.WriteMessage(ws.TextMessage, []byte(message)))
+
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// fakeTradesServer serves the Coinbase /products/{id}/trades endpoint for trade IDs 1 to last,
+// newest first and at most pageSize trades per page, like the exchange does with the `after` cursor.
+func fakeTradesServer(t *testing.T, productID string, last, pageSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/products/"+productID+"/trades", r.URL.Path)
+
+		after, err := strconv.Atoi(r.URL.Query().Get("after"))
+		assert.NoError(t, err)
+
+		newest := after - 1
+		if newest > last {
+			newest = last
+		}
+
+		page := []models.CoinbaseResponse{}
+		for id := newest; id >= 1 && len(page) < pageSize; id-- {
+			page = append(page, models.CoinbaseResponse{
+				Time:    "2022-05-21T09:12:04.862866Z",
+				TradeID: id,
+				Price:   strconv.Itoa(id),
+				Size:    "1",
+				Side:    "buy",
+			})
+		}
+		sort.Slice(page, func(i, j int) bool { return page[i].TradeID > page[j].TradeID })
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(page))
+	}
+}
+
+// fakeBinanceServer serves a Binance combined stream: it sends the requested streams to the streams channel,
+// a message without trade, then a trade per <symbol>@trade stream, and keeps the connection open until it's closed.
+func fakeBinanceServer(t *testing.T, streams chan string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/stream", r.URL.Path)
+		requested := r.URL.Query().Get("streams")
+		streams <- requested
+
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		assert.NoError(t, conn.WriteMessage(ws.TextMessage, []byte(`{"result":null,"id":1}`)))
+		for i, stream := range strings.Split(requested, "/") {
+			err = conn.WriteJSON(models.BinanceStream{
+				Stream: stream,
+				Data: models.BinanceTrade{
+					EventType:    "trade",
+					Symbol:       strings.ToUpper(strings.TrimSuffix(stream, "@trade")),
+					TradeID:      i + 1,
+					Price:        "29303.35000000",
+					Quantity:     "0.00029900",
+					TradeTime:    1653124324862,
+					BuyerIsMaker: i%2 == 0,
+				},
+			})
+			assert.NoError(t, err)
+		}
+
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// fakeKrakenServer serves the Kraken v2 websocket: it acknowledges a trade subscription, sent to the subscriptions
+// channel, then sends a heartbeat and a batch of 3 trades whose trade_ids follow the connection number
+// (1-3, then 4-6...). It then drops the connection to force a reconnect, or keeps it open until it's closed.
+func fakeKrakenServer(t *testing.T, subscriptions chan models.KrakenRequest, drop bool) http.HandlerFunc {
+	var connections int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		var upgrader = ws.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		request := models.KrakenRequest{}
+		if err = conn.ReadJSON(&request); err != nil {
+			return
+		}
+		subscriptions <- request
+
+		first := 3*int(atomic.AddInt32(&connections, 1)) - 2
+		messages := []string{
+			`{"method":"subscribe","result":{"channel":"trade","symbol":"BTC/USD"},"success":true}`,
+			`{"channel":"heartbeat"}`,
+			fmt.Sprintf(`{"channel":"trade","type":"update","data":[`+
+				`{"symbol":"XBT/USD","side":"buy","price":29303.3,"qty":0.000299,"ord_type":"market","trade_id":%d,"timestamp":"2022-05-21T09:12:04.862866Z"},`+
+				`{"symbol":"BTC/USD","side":"sell","price":29303.2,"qty":0.01,"ord_type":"limit","trade_id":%d,"timestamp":"2022-05-21T09:12:04.862866Z"},`+
+				`{"symbol":"ETH/USD","side":"buy","price":1975.12,"qty":1.5,"ord_type":"market","trade_id":%d,"timestamp":"2022-05-21T09:12:05Z"}]}`,
+				first, first+1, first+2),
+		}
+		for _, message := range messages {
+			assert.NoError(t, conn.WriteMessage(ws.TextMessage, []byte(message)))
+		}
+
+		for !drop {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func scannerHelper(t *testing.T) (*bufio.Scanner, *os.File, *os.File) {
 	reader, writer, err := os.Pipe()
 	if err != nil {
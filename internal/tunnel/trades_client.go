@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/reactivejson/vwap-engine/api/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+const (
+	// tradesPageLimit is the maximum page size of the Coinbase trades endpoint.
+	tradesPageLimit = 1000
+	// tradeMatch is the type of the live trades of the matches channel.
+	tradeMatch = "match"
+)
+
+// TradesClient fetches historical trades from the Coinbase REST API, to backfill gaps of the websocket feed.
+type TradesClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewTradesClient creates a REST client for the exchange at baseURL, e.g. https://api.exchange.coinbase.com.
+func NewTradesClient(baseURL string, timeout time.Duration) *TradesClient {
+	return &TradesClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Trades returns the trades of a product whose trade ID is between from and to (both included), in trade ID order.
+// The Coinbase endpoint returns the newest trades first and pages backwards with the `after` cursor,
+// so pages are requested from to+1 until a trade older than from is reached.
+func (c *TradesClient) Trades(ctx context.Context, productID string, from, to int) ([]*models.Trade, error) {
+	var trades []*models.Trade
+
+	for cursor := to + 1; cursor > from; {
+		page, err := c.page(ctx, productID, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		previous := cursor
+		for _, trade := range page {
+			if trade.TradeID < cursor {
+				cursor = trade.TradeID
+			}
+			if trade.TradeID >= from && trade.TradeID <= to {
+				trade.ProductID = productID
+				normalized, err := coinbaseTrade(trade)
+				if err != nil {
+					return nil, err
+				}
+				normalized.ReceivedAt = time.Now()
+				trades = append(trades, normalized)
+			}
+		}
+		if cursor == previous {
+			return nil, fmt.Errorf("error paging trades of %s: no trade older than %d", productID, cursor)
+		}
+	}
+
+	sort.Slice(trades, func(i, j int) bool { return trades[i].TradeID < trades[j].TradeID })
+	return trades, nil
+}
+
+// page returns the trades of a product older than the cursor trade ID.
+func (c *TradesClient) page(ctx context.Context, productID string, cursor int) ([]*models.CoinbaseResponse, error) {
+	endpoint := fmt.Sprintf("%s/products/%s/trades?after=%d&limit=%d", c.baseURL, productID, cursor, tradesPageLimit)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trades request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting trades of %s: %w", productID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting trades of %s: unexpected status %s", productID, resp.Status)
+	}
+
+	var page []*models.CoinbaseResponse
+	if err = json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("error decoding trades of %s: %w", productID, err)
+	}
+	return page, nil
+}
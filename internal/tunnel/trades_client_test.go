@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestTradesClient_Trades(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(fakeTradesServer(t, "BTC-USD", 100, 7))
+	defer server.Close()
+
+	client := NewTradesClient(server.URL+"/", time.Second)
+
+	trades, err := client.Trades(context.Background(), "BTC-USD", 12, 40)
+	require.NoError(t, err)
+	require.Len(t, trades, 29)
+	for i, trade := range trades {
+		require.Equal(t, 12+i, trade.TradeID)
+		require.Equal(t, "BTC-USD", trade.ProductID)
+		require.Equal(t, VenueCoinbase, trade.Venue)
+		require.False(t, trade.Time.IsZero())
+	}
+}
+
+func TestTradesClient_Trades_WithServerError_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewTradesClient(server.URL, time.Second).Trades(context.Background(), "BTC-USD", 1, 2)
+	require.Error(t, err)
+}
+
+func TestTradesClient_Trades_WithoutOlderTrades_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"trade_id": 50, "price": "1", "size": "1"}]`))
+	}))
+	defer server.Close()
+
+	_, err := NewTradesClient(server.URL, time.Second).Trades(context.Background(), "BTC-USD", 1, 10)
+	require.Error(t, err)
+}
@@ -11,12 +11,20 @@ import (
  */
 
 //Tunnel is a coinbase websocket stream client to receive data from coinbase websocket server
+//Exchange adapters implement it for other venues, normalizing their trades to models.Trade.
 type Tunnel interface {
 	//Subscribe sends a subscribe request to the coinbase channel's websocket, using trading pairs (productIDs).
 	Subscribe(tradingPairs []string) error
 
-	// Read receives data points from the coinbase and passes them to the receiver channel.
-	Read(ctx context.Context, receiver chan *models.CoinbaseResponse)
+	// Unsubscribe stops receiving the trades of trading pairs (productIDs) subscribed to before.
+	Unsubscribe(tradingPairs []string) error
+
+	// Read receives the trades from the coinbase and passes them, normalized, to the receiver channel.
+	Read(ctx context.Context, receiver chan *models.Trade)
+
+	// Err returns the error Read stopped on, if any, once the receiver channel is closed,
+	// e.g. an ExchangeError rejecting a subscription.
+	Err() error
 
 	// Close closes the websocket connection.
 	Close()
@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+// Watchdog tells the trading pairs of a frozen feed apart: a trading pair is stale on a venue once neither a trade
+// nor a heartbeat of it arrived within the interval. Receivers sharing a Watchdog also mark all their trading pairs
+// stale, and reconnect, once their connection stays silent for the interval.
+type Watchdog struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]map[string]time.Time // last activity by venue, then trading pair
+}
+
+// NewWatchdog returns a Watchdog marking trading pairs stale after interval without activity.
+func NewWatchdog(interval time.Duration) *Watchdog {
+	return &Watchdog{
+		interval: interval,
+		now:      time.Now,
+		seen:     make(map[string]map[string]time.Time),
+	}
+}
+
+// Interval returns the time without activity after which a trading pair or a connection is stale.
+func (w *Watchdog) Interval() time.Duration {
+	return w.interval
+}
+
+// observe records the activity of a trading pair on a venue, a trade or a heartbeat received at a time.
+func (w *Watchdog) observe(venue, tradingPair string, at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pairs, ok := w.seen[venue]
+	if !ok {
+		pairs = make(map[string]time.Time)
+		w.seen[venue] = pairs
+	}
+	if at.After(pairs[tradingPair]) {
+		pairs[tradingPair] = at
+	}
+}
+
+// expire marks the trading pairs of a venue stale until their next trade or heartbeat,
+// e.g. those of a dead connection or unsubscribed from.
+func (w *Watchdog) expire(venue string, tradingPairs []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, tradingPair := range tradingPairs {
+		delete(w.seen[venue], tradingPair)
+	}
+}
+
+// Stale reports whether a trading pair had no activity on a venue within the interval, never seen included.
+// With an empty venue, the trading pair is stale when it is stale on every venue.
+func (w *Watchdog) Stale(tradingPair, venue string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	deadline := w.now().Add(-w.interval)
+	if venue != "" {
+		return !w.seen[venue][tradingPair].After(deadline)
+	}
+	for _, pairs := range w.seen {
+		if pairs[tradingPair].After(deadline) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/reactivejson/vwap-engine/api/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/**
+ * @author Mohamed-Aly Bou-Hanane
+ * © 2022
+ */
+
+func TestWatchdog_Stale(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 5, 21, 9, 12, 0, 0, time.UTC)
+	watchdog := NewWatchdog(10 * time.Second)
+	watchdog.now = func() time.Time { return now }
+
+	assert.True(t, watchdog.Stale("BTC-USD", VenueCoinbase), "never seen")
+
+	watchdog.observe(VenueCoinbase, "BTC-USD", now.Add(-5*time.Second))
+	watchdog.observe(VenueBinance, "BTC-USD", now.Add(-15*time.Second))
+	watchdog.observe(VenueCoinbase, "ETH-USD", now.Add(-15*time.Second))
+
+	assert.False(t, watchdog.Stale("BTC-USD", VenueCoinbase))
+	assert.True(t, watchdog.Stale("BTC-USD", VenueBinance))
+	assert.True(t, watchdog.Stale("ETH-USD", VenueCoinbase))
+	// A trading pair is live as long as one of its venues is.
+	assert.False(t, watchdog.Stale("BTC-USD", ""))
+	assert.True(t, watchdog.Stale("ETH-USD", ""))
+
+	watchdog.expire(VenueCoinbase, []string{"BTC-USD"})
+	assert.True(t, watchdog.Stale("BTC-USD", VenueCoinbase))
+	assert.True(t, watchdog.Stale("BTC-USD", ""))
+}
+
+func TestReceiver_WithWatchdog_ShouldTrackHeartbeats(t *testing.T) {
+	t.Parallel()
+
+	watchdog := NewWatchdog(time.Minute)
+	r := newReceiver("", newCoinbase(), newDialer(), nil, WithWatchdog(watchdog))
+
+	_, err := r.exchange.decode([]byte(`{"type":"heartbeat","last_trade_id":20,"product_id":"BTC-USD","time":"2022-05-21T09:12:04.862866Z"}`))
+	require.NoError(t, err)
+
+	assert.False(t, watchdog.Stale("BTC-USD", VenueCoinbase))
+	assert.True(t, watchdog.Stale("ETH-USD", VenueCoinbase))
+}
+
+func TestReceiver_Read_WithWatchdog_ShouldReconnectSilentConnection(t *testing.T) {
+	requests := make(chan models.CoinbaseRequest, 10)
+	server := setUpWSServer(wsRequests(requests))
+	defer server.Close()
+
+	watchdog := NewWatchdog(200 * time.Millisecond)
+	tunnel, err := NewReceiver(webSocketURL, WithWatchdog(watchdog))
+	require.NoError(t, err)
+	defer tunnel.Close()
+	tunnel.(*Receiver).backoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}
+
+	require.NoError(t, tunnel.Subscribe([]string{"BTC-USD"}))
+	watchdog.observe(VenueCoinbase, "BTC-USD", time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tunnel.Read(ctx, make(chan *models.Trade))
+
+	// The server never answers: the connection is dropped, its trading pairs are stale, and they are resubscribed.
+	for i := 0; i < 2; i++ {
+		select {
+		case request := <-requests:
+			assert.Equal(t, TunnelSubscribe, request.Type)
+			assert.Equal(t, []string{"BTC-USD"}, request.ProductIDs)
+		case <-ctx.Done():
+			require.Fail(t, "silent connection not reconnected")
+		}
+	}
+	assert.True(t, watchdog.Stale("BTC-USD", VenueCoinbase))
+}